@@ -0,0 +1,164 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Adobe font metrics (AFM) and the metrics of the standard 14 fonts.
+package afm
+
+import (
+	"embed"
+	"strings"
+	"sync"
+
+	"github.com/grokify/pdfreader/strm"
+)
+
+// The AFM files of the standard 14 fonts, see core14/MustRead.html.
+//
+//go:embed core14/*.afm
+var core14 embed.FS
+
+type FontT struct {
+	Name     string
+	Widths   map[string]int    // advance widths by glyph name
+	Kerning  map[[2]string]int // kerning pairs by glyph names
+	Encoding [256]string       // built-in encoding, "" for unused codes
+}
+
+// f.Kern() returns the kerning of the glyph pair a, b.
+func (f *FontT) Kern(a, b string) int {
+	return f.Kerning[[2]string{a, b}]
+}
+
+// charMetrics() reads a line like "C 32 ; WX 278 ; N space ; B 0 0 0 0 ;".
+func (f *FontT) charMetrics(l string) {
+	code, wx, name := -1, 0, ""
+	for _, e := range strings.Split(l, ";") {
+		kv := strings.Fields(e)
+		if len(kv) < 2 {
+			continue
+		}
+		switch kv[0] {
+		case "C":
+			code = strm.Int(kv[1], 1)
+		case "WX":
+			wx = strm.Int(kv[1], 1)
+		case "N":
+			name = kv[1]
+		}
+	}
+	if name == "" {
+		return
+	}
+	f.Widths[name] = wx
+	if code >= 0 && code < 256 {
+		f.Encoding[code] = name
+	}
+}
+
+// Read() parses AFM data. Only the font name, widths and kerning pairs are
+// kept.
+func Read(data []byte) *FontT {
+	f := new(FontT)
+	f.Widths = make(map[string]int)
+	f.Kerning = make(map[[2]string]int)
+	for _, l := range strings.Split(string(data), "\n") {
+		l = strings.TrimRight(l, "\r")
+		switch {
+		case strings.HasPrefix(l, "FontName "):
+			f.Name = strings.TrimSpace(l[9:])
+		case strings.HasPrefix(l, "C "):
+			f.charMetrics(l)
+		case strings.HasPrefix(l, "KPX "):
+			if kv := strings.Fields(l); len(kv) == 4 {
+				f.Kerning[[2]string{kv[1], kv[2]}] = strm.Int(kv[3], 1)
+			}
+		}
+	}
+	return f
+}
+
+var (
+	standardMu sync.Mutex
+	standard   = make(map[string]*FontT)
+)
+
+// styles of standard font families for regular, bold, italic and bold
+// italic.
+var families = map[string][4]string{
+	"Courier":   {"Courier", "Courier-Bold", "Courier-Oblique", "Courier-BoldOblique"},
+	"Helvetica": {"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique"},
+	"Times":     {"Times-Roman", "Times-Bold", "Times-Italic", "Times-BoldItalic"},
+}
+
+var aliases = []struct{ prefix, family string }{
+	{"CourierNew", "Courier"},
+	{"Courier", "Courier"},
+	{"Arial", "Helvetica"},
+	{"Helvetica", "Helvetica"},
+	{"TimesNewRoman", "Times"},
+	{"Times", "Times"},
+}
+
+// StandardName() maps a font name like "ABCDEF+Arial,Bold" or
+// "TimesNewRomanPS-ItalicMT" to the name of a standard 14 font, "" if it
+// is none of them or an alias of one.
+func StandardName(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if p := strings.IndexByte(name, '+'); p >= 0 {
+		name = name[p+1:]
+	}
+	if name == "Symbol" || name == "ZapfDingbats" {
+		return name
+	}
+	for _, a := range aliases {
+		if !strings.HasPrefix(name, a.prefix) {
+			continue
+		}
+		style := 0
+		for s := name[len(a.prefix):]; s != ""; {
+			l := len(s)
+			for _, w := range []string{",", "-", " ", "PS", "MT", "Roman", "Regular", "Normal", "Bold", "Italic", "Oblique"} {
+				if strings.HasPrefix(s, w) {
+					switch w {
+					case "Bold":
+						style |= 1
+					case "Italic", "Oblique":
+						style |= 2
+					}
+					s = s[len(w):]
+					break
+				}
+			}
+			if len(s) == l {
+				return ""
+			}
+		}
+		return families[a.family][style]
+	}
+	return ""
+}
+
+// Standard() returns the metrics of a standard 14 font or one of its
+// aliases, nil for other fonts. The metrics are shared and must not be
+// modified.
+func Standard(name string) *FontT {
+	if name = StandardName(name); name == "" {
+		return nil
+	}
+	standardMu.Lock()
+	defer standardMu.Unlock()
+	if f, ok := standard[name]; ok {
+		return f
+	}
+	data, err := core14.ReadFile("core14/" + name + ".afm")
+	if err != nil {
+		return nil
+	}
+	f := Read(data)
+	standard[name] = f
+	return f
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Object caches with memory limits.
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache is the policy used by a PDF reader to keep resolved objects. All
+// methods have to be safe for concurrent use. size is the estimated
+// memory use of an entry in bytes.
+type Cache interface {
+	Get(key string) (value interface{}, ok bool)
+	Put(key string, value interface{}, size int)
+	Reset()
+	Stats() StatsT
+}
+
+type StatsT struct {
+	Hits, Misses int64
+	Entries      int
+	Bytes        int64 // estimated memory use of the entries
+}
+
+// ------------------------------------------------------------------
+
+type entryT struct {
+	key   string
+	value interface{}
+	size  int
+}
+
+// LRUT drops the least recently used entries if the byte budget is
+// exceeded. A budget <= 0 means no limit.
+type LRUT struct {
+	mu     sync.Mutex
+	budget int64
+	lru    *list.List // front is the most recently used
+	items  map[string]*list.Element
+	stats  StatsT
+}
+
+func NewLRU(budget int64) *LRUT {
+	r := new(LRUT)
+	r.budget = budget
+	r.lru = list.New()
+	r.items = make(map[string]*list.Element)
+	return r
+}
+
+func (c *LRUT) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.stats.Hits++
+		c.lru.MoveToFront(e)
+		return e.Value.(*entryT).value, true
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *LRUT) Put(key string, value interface{}, size int) {
+	size += len(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.budget > 0 && int64(size) > c.budget {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+	c.items[key] = c.lru.PushFront(&entryT{key, value, size})
+	c.stats.Bytes += int64(size)
+	for c.budget > 0 && c.stats.Bytes > c.budget {
+		c.remove(c.lru.Back())
+	}
+	c.stats.Entries = len(c.items)
+}
+
+func (c *LRUT) remove(e *list.Element) {
+	t := c.lru.Remove(e).(*entryT)
+	delete(c.items, t.key)
+	c.stats.Bytes -= int64(t.size)
+	c.stats.Entries = len(c.items)
+}
+
+func (c *LRUT) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = make(map[string]*list.Element)
+	c.stats = StatsT{}
+}
+
+func (c *LRUT) Stats() StatsT {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// ------------------------------------------------------------------
+
+// NoneT is a cache which keeps nothing.
+type NoneT struct {
+	mu    sync.Mutex
+	stats StatsT
+}
+
+func NewNone() *NoneT { return new(NoneT) }
+
+func (c *NoneT) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	c.stats.Misses++
+	c.mu.Unlock()
+	return nil, false
+}
+
+func (c *NoneT) Put(key string, value interface{}, size int) {}
+
+func (c *NoneT) Reset() {
+	c.mu.Lock()
+	c.stats = StatsT{}
+	c.mu.Unlock()
+}
+
+func (c *NoneT) Stats() StatsT {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,380 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Compact Font Format (FontFile3 /Type1C, /CIDFontType0C and OpenType CFF).
+package cff
+
+import (
+	"strconv"
+)
+
+// operators of DICTs, two byte operators are 1200 + second byte.
+const (
+	OP_CHARSET       = 15
+	OP_ENCODING      = 16
+	OP_CHARSTRINGS   = 17
+	OP_PRIVATE       = 18
+	OP_SUBRS         = 19
+	OP_DEFAULTWIDTHX = 20
+	OP_NOMINALWIDTHX = 21
+	OP_FONTMATRIX    = 1207
+	OP_ROS           = 1230
+	OP_FDARRAY       = 1236
+	OP_FDSELECT      = 1237
+)
+
+type privateT struct {
+	subrs                        [][]byte
+	defaultWidthX, nominalWidthX float64
+}
+
+type FontT struct {
+	Name        string
+	FontMatrix  []float64
+	CharStrings [][]byte
+	Charset     []string    // glyph names by glyph index, nil if CID-keyed
+	CIDs        []int       // CIDs by glyph index, nil if name-keyed
+	Encoding    [256]string // built-in encoding of name-keyed fonts
+	data        []byte
+	strings     [][]byte
+	gsubrs      [][]byte
+	privates    []privateT // one per Font DICT of CID-keyed fonts
+	fdSelect    []int      // glyph index -> privates
+	gids        map[string]int
+	cids        map[int]int
+}
+
+// f.index() reads an INDEX at p and returns its entries and the end.
+func (f *FontT) index(p int) ([][]byte, int) {
+	d := f.data
+	n := int(d[p])<<8 | int(d[p+1])
+	if n == 0 {
+		return nil, p + 2
+	}
+	os := int(d[p+2])
+	off := func(k int) int {
+		r := 0
+		for q := p + 3 + k*os; q < p+3+(k+1)*os; q++ {
+			r = r<<8 | int(d[q])
+		}
+		return r
+	}
+	base := p + 2 + (n+1)*os
+	r := make([][]byte, n)
+	for k := range r {
+		r[k] = d[base+off(k) : base+off(k+1)]
+	}
+	return r, base + off(n)
+}
+
+// realNumber() decodes the nibbles of a real number in a DICT.
+func realNumber(s []byte) (float64, int) {
+	b := []byte{}
+	for k := 0; k < len(s); k++ {
+		for _, n := range []byte{s[k] >> 4, s[k] & 15} {
+			switch {
+			case n <= 9:
+				b = append(b, '0'+n)
+			case n == 0xa:
+				b = append(b, '.')
+			case n == 0xb:
+				b = append(b, 'E')
+			case n == 0xc:
+				b = append(b, 'E', '-')
+			case n == 0xe:
+				b = append(b, '-')
+			case n == 0xf:
+				r, _ := strconv.ParseFloat(string(b), 64)
+				return r, k + 1
+			}
+		}
+	}
+	return 0, len(s)
+}
+
+// dict() decodes a DICT to its operands by operator.
+func dict(s []byte) map[int][]float64 {
+	r := make(map[int][]float64)
+	var ops []float64
+	for k := 0; k < len(s); {
+		b := int(s[k])
+		switch {
+		case b <= 21:
+			if b == 12 && k+1 < len(s) {
+				b = 1200 + int(s[k+1])
+				k++
+			}
+			r[b] = ops
+			ops = nil
+			k++
+		case b == 28:
+			ops = append(ops, float64(int16(int(s[k+1])<<8|int(s[k+2]))))
+			k += 3
+		case b == 29:
+			ops = append(ops, float64(int32(int(s[k+1])<<24|int(s[k+2])<<16|int(s[k+3])<<8|int(s[k+4]))))
+			k += 5
+		case b == 30:
+			v, l := realNumber(s[k+1:])
+			ops = append(ops, v)
+			k += 1 + l
+		case b >= 32 && b <= 246:
+			ops = append(ops, float64(b-139))
+			k++
+		case b >= 247 && b <= 250:
+			ops = append(ops, float64((b-247)*256+int(s[k+1])+108))
+			k += 2
+		case b >= 251 && b <= 254:
+			ops = append(ops, float64(-(b-251)*256-int(s[k+1])-108))
+			k += 2
+		default:
+			k++
+		}
+	}
+	return r
+}
+
+// f.String() returns the string of a SID.
+func (f *FontT) String(sid int) string {
+	if sid < len(standardStrings) {
+		return standardStrings[sid]
+	}
+	if sid -= len(standardStrings); sid < len(f.strings) {
+		return string(f.strings[sid])
+	}
+	return ""
+}
+
+// f.private() reads a Private DICT given by the operands of OP_PRIVATE.
+func (f *FontT) private(op []float64) (r privateT) {
+	if len(op) < 2 {
+		return
+	}
+	p, l := int(op[1]), int(op[0])
+	d := dict(f.data[p : p+l])
+	if v := d[OP_DEFAULTWIDTHX]; len(v) > 0 {
+		r.defaultWidthX = v[0]
+	}
+	if v := d[OP_NOMINALWIDTHX]; len(v) > 0 {
+		r.nominalWidthX = v[0]
+	}
+	if v := d[OP_SUBRS]; len(v) > 0 {
+		r.subrs, _ = f.index(p + int(v[0]))
+	}
+	return
+}
+
+// f.charset() reads the charset at p as SIDs (or CIDs) by glyph index.
+func (f *FontT) charset(p, n int) []int {
+	d := f.data
+	r := make([]int, 1, n)
+	switch format := d[p]; format {
+	case 0:
+		for q := p + 1; len(r) < n; q += 2 {
+			r = append(r, int(d[q])<<8|int(d[q+1]))
+		}
+	case 1, 2:
+		for q := p + 1; len(r) < n; {
+			first := int(d[q])<<8 | int(d[q+1])
+			left := int(d[q+2])
+			q += 3
+			if format == 2 {
+				left = left<<8 | int(d[q])
+				q++
+			}
+			for k := 0; k <= left && len(r) < n; k++ {
+				r = append(r, first+k)
+			}
+		}
+	}
+	return r
+}
+
+// f.encoding() reads a custom encoding at p.
+func (f *FontT) encoding(p int) {
+	d := f.data
+	gid := 1
+	set := func(code, g int) {
+		if g < len(f.Charset) {
+			f.Encoding[code] = f.Charset[g]
+		}
+	}
+	q := p + 2
+	switch d[p] & 0x7f {
+	case 0:
+		for k := 0; k < int(d[p+1]); k++ {
+			set(int(d[q]), gid)
+			gid++
+			q++
+		}
+	case 1:
+		for k := 0; k < int(d[p+1]); k++ {
+			for c := int(d[q]); c <= int(d[q])+int(d[q+1]) && c < 256; c++ {
+				set(c, gid)
+				gid++
+			}
+			q += 2
+		}
+	}
+	if d[p]&0x80 != 0 {
+		for k := 0; k < int(d[q]); k++ {
+			s := q + 1 + 3*k
+			f.Encoding[d[s]] = f.String(int(d[s+1])<<8 | int(d[s+2]))
+		}
+	}
+}
+
+// f.readFDSelect() reads the FDSelect at p.
+func (f *FontT) readFDSelect(p int) {
+	d := f.data
+	n := len(f.CharStrings)
+	f.fdSelect = make([]int, n)
+	switch d[p] {
+	case 0:
+		for k := 0; k < n; k++ {
+			f.fdSelect[k] = int(d[p+1+k])
+		}
+	case 3:
+		nr := int(d[p+1])<<8 | int(d[p+2])
+		for k := 0; k < nr; k++ {
+			q := p + 3 + 3*k
+			first, fd := int(d[q])<<8|int(d[q+1]), int(d[q+2])
+			last := int(d[q+3])<<8 | int(d[q+4])
+			for g := first; g < last && g < n; g++ {
+				f.fdSelect[g] = fd
+			}
+		}
+	}
+}
+
+// sfnt() finds the CFF table of an OpenType font.
+func sfnt(data []byte) []byte {
+	n := int(data[4])<<8 | int(data[5])
+	for k := 0; k < n; k++ {
+		p := 12 + 16*k
+		if string(data[p:p+4]) == "CFF " {
+			u32 := func(q int) int {
+				return int(data[q])<<24 | int(data[q+1])<<16 | int(data[q+2])<<8 | int(data[q+3])
+			}
+			return data[u32(p+8) : u32(p+8)+u32(p+12)]
+		}
+	}
+	return nil
+}
+
+// Read() parses the first font of a CFF font set, which may be wrapped in
+// an OpenType font. It returns nil if this fails.
+func Read(data []byte) (f *FontT) {
+	defer func() {
+		if recover() != nil {
+			f = nil
+		}
+	}()
+	if len(data) > 4 && string(data[0:4]) == "OTTO" {
+		data = sfnt(data)
+	}
+	if len(data) < 4 || data[0] != 1 {
+		return nil
+	}
+	f = &FontT{data: data}
+	names, p := f.index(int(data[2]))
+	tops, p := f.index(p)
+	f.strings, p = f.index(p)
+	f.gsubrs, _ = f.index(p)
+	if len(names) == 0 || len(tops) == 0 {
+		return nil
+	}
+	f.Name = string(names[0])
+	top := dict(tops[0])
+	f.FontMatrix = []float64{0.001, 0, 0, 0.001, 0, 0}
+	if m := top[OP_FONTMATRIX]; len(m) == 6 {
+		f.FontMatrix = m
+	}
+	cs, ok := top[OP_CHARSTRINGS]
+	if !ok || len(cs) == 0 {
+		return nil
+	}
+	f.CharStrings, _ = f.index(int(cs[0]))
+	n := len(f.CharStrings)
+	var sids []int
+	switch c := top[OP_CHARSET]; {
+	case len(c) > 0 && c[0] > 2:
+		sids = f.charset(int(c[0]), n)
+	case len(c) == 0 || c[0] == 0:
+		for k := 0; k < n && k < 229; k++ {
+			sids = append(sids, k)
+		}
+	}
+	if _, ok := top[OP_ROS]; ok {
+		f.CIDs = sids
+		fds, _ := f.index(int(top[OP_FDARRAY][0]))
+		for _, fd := range fds {
+			f.privates = append(f.privates, f.private(dict(fd)[OP_PRIVATE]))
+		}
+		if s := top[OP_FDSELECT]; len(s) > 0 {
+			f.readFDSelect(int(s[0]))
+		}
+		return f
+	}
+	f.privates = []privateT{f.private(top[OP_PRIVATE])}
+	f.Charset = make([]string, n)
+	for k := range f.Charset {
+		switch c := top[OP_CHARSET]; {
+		case k < len(sids):
+			f.Charset[k] = f.String(sids[k])
+		case len(c) > 0 && c[0] == 1 && k < len(expertCharset):
+			f.Charset[k] = expertCharset[k]
+		case len(c) > 0 && c[0] == 2 && k < len(expertSubsetCharset):
+			f.Charset[k] = expertSubsetCharset[k]
+		}
+	}
+	switch e := top[OP_ENCODING]; {
+	case len(e) == 0 || e[0] == 0:
+		for k, sid := range standardEncoding {
+			if sid != 0 {
+				f.Encoding[k] = standardStrings[sid]
+			}
+		}
+	case e[0] > 1:
+		f.encoding(int(e[0]))
+	}
+	return f
+}
+
+// f.GlyphIndex() finds a glyph by name, -1 if it is not there.
+func (f *FontT) GlyphIndex(name string) int {
+	if f.gids == nil {
+		f.gids = make(map[string]int)
+		for k, n := range f.Charset {
+			f.gids[n] = k
+		}
+	}
+	if g, ok := f.gids[name]; ok {
+		return g
+	}
+	return -1
+}
+
+// f.CIDGlyph() finds the glyph of a CID of a CID-keyed font, -1 if it is
+// not there. Name-keyed fonts take the CID as glyph index.
+func (f *FontT) CIDGlyph(cid int) int {
+	if f.CIDs == nil {
+		if cid < len(f.CharStrings) {
+			return cid
+		}
+		return -1
+	}
+	if f.cids == nil {
+		f.cids = make(map[int]int)
+		for k, c := range f.CIDs {
+			f.cids[c] = k
+		}
+	}
+	if g, ok := f.cids[cid]; ok {
+		return g
+	}
+	return -1
+}
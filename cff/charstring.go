@@ -0,0 +1,491 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package cff
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader/type1"
+)
+
+// Type 2 charstring "interpreter" - hints are skipped.
+
+const (
+	MAX_CHARSTRING_STACK = 48
+	MAX_SUBR_DEPTH       = 10
+	TRANSIENT_SIZE       = 32
+)
+
+func number(f float64) []byte {
+	return strconv.AppendFloat(nil, math.Round(f*1000)/1000, 'f', -1, 64)
+}
+
+// bias of subroutine numbers.
+func bias(subrs [][]byte) int {
+	switch {
+	case len(subrs) < 1240:
+		return 107
+	case len(subrs) < 33900:
+		return 1131
+	}
+	return 32768
+}
+
+type charStringT struct {
+	f      *FontT
+	priv   *privateT
+	r      *type1.GlyphT
+	st     []float64
+	trans  [TRANSIENT_SIZE]float64
+	x, y   float64
+	dx, dy float64 // offset of seac accents
+	stems  int
+	open   bool // path is started
+	width  bool // width is known
+	done   bool
+	seac   bool
+}
+
+func (c *charStringT) out(v ...float64) {
+	for k := range v {
+		if k&1 == 0 {
+			v[k] += c.dx
+		} else {
+			v[k] += c.dy
+		}
+		c.r.Path = append(c.r.Path, number(v[k])...)
+		c.r.Path = append(c.r.Path, ' ')
+	}
+}
+
+func (c *charStringT) op(o string) {
+	c.r.Path = append(c.r.Path, o...)
+	c.r.Path = append(c.r.Path, '\n')
+}
+
+func (c *charStringT) closePath() {
+	if c.open {
+		c.op("h")
+		c.open = false
+	}
+}
+
+func (c *charStringT) moveTo(dx, dy float64) {
+	c.closePath()
+	c.x += dx
+	c.y += dy
+}
+
+func (c *charStringT) start() {
+	if !c.open {
+		c.out(c.x, c.y)
+		c.op("m")
+		c.open = true
+	}
+}
+
+func (c *charStringT) lineTo(dx, dy float64) {
+	c.start()
+	c.x += dx
+	c.y += dy
+	c.out(c.x, c.y)
+	c.op("l")
+}
+
+func (c *charStringT) curveTo(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	c.start()
+	x1, y1 := c.x+dx1, c.y+dy1
+	x2, y2 := x1+dx2, y1+dy2
+	c.x, c.y = x2+dx3, y2+dy3
+	c.out(x1, y1, x2, y2, c.x, c.y)
+	c.op("c")
+}
+
+// c.setWidth() takes the width off the stack at the first stack clearing
+// operator if odd tells that it is there. Accents of seac keep the width
+// of the base glyph.
+func (c *charStringT) setWidth(odd bool) {
+	if c.width {
+		return
+	}
+	c.width = true
+	w := c.priv.defaultWidthX
+	if odd && len(c.st) > 0 {
+		w = c.priv.nominalWidthX + c.st[0]
+		c.st = c.st[1:]
+	}
+	if !c.seac {
+		c.r.Wx = w
+	}
+}
+
+func (c *charStringT) args(n int) []float64 {
+	if len(c.st) < n {
+		panic("charstring stack underflow\n")
+	}
+	return c.st[len(c.st)-n:]
+}
+
+func (c *charStringT) push(v float64) {
+	if len(c.st) >= MAX_CHARSTRING_STACK {
+		panic("charstring stack overflow\n")
+	}
+	c.st = append(c.st, v)
+}
+
+// c.alternate() draws the lines of hlineto and vlineto.
+func (c *charStringT) alternate(h bool) {
+	for _, v := range c.st {
+		if h {
+			c.lineTo(v, 0)
+		} else {
+			c.lineTo(0, v)
+		}
+		h = !h
+	}
+}
+
+// c.alternateCurves() draws the curves of hvcurveto and vhcurveto.
+func (c *charStringT) alternateCurves(h bool) {
+	a := c.st
+	for k := 0; len(a)-k >= 4; k += 4 {
+		last := 0.0
+		if len(a)-k == 5 {
+			last = a[k+4]
+		}
+		if h {
+			c.curveTo(a[k], 0, a[k+1], a[k+2], last, a[k+3])
+		} else {
+			c.curveTo(0, a[k], a[k+1], a[k+2], a[k+3], last)
+		}
+		h = !h
+	}
+}
+
+// c.escape() runs the two byte operators.
+func (c *charStringT) escape(v int) {
+	a := c.st
+	switch v {
+	case 35: // flex
+		a = c.args(13)
+		c.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		c.curveTo(a[6], a[7], a[8], a[9], a[10], a[11])
+	case 34: // hflex
+		a = c.args(7)
+		c.curveTo(a[0], 0, a[1], a[2], a[3], 0)
+		c.curveTo(a[4], 0, a[5], -a[2], a[6], 0)
+	case 36: // hflex1
+		a = c.args(9)
+		c.curveTo(a[0], a[1], a[2], a[3], a[4], 0)
+		c.curveTo(a[5], 0, a[6], a[7], a[8], -(a[1] + a[3] + a[7]))
+	case 37: // flex1
+		a = c.args(11)
+		dx, dy := 0.0, 0.0
+		for k := 0; k < 10; k += 2 {
+			dx, dy = dx+a[k], dy+a[k+1]
+		}
+		c.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		if math.Abs(dx) > math.Abs(dy) {
+			c.curveTo(a[6], a[7], a[8], a[9], a[10], -dy)
+		} else {
+			c.curveTo(a[6], a[7], a[8], a[9], -dx, a[10])
+		}
+	default:
+		c.arithmetic(v)
+		return
+	}
+	c.st = c.st[0:0]
+}
+
+func b2f(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// c.arithmetic() runs the arithmetic, storage and conditional operators.
+func (c *charStringT) arithmetic(v int) {
+	n := len(c.st)
+	pop := func(k int) []float64 {
+		a := c.args(k)
+		c.st = c.st[0 : n-k]
+		return a
+	}
+	switch v {
+	case 3: // and
+		a := pop(2)
+		c.push(b2f(a[0] != 0 && a[1] != 0))
+	case 4: // or
+		a := pop(2)
+		c.push(b2f(a[0] != 0 || a[1] != 0))
+	case 5: // not
+		a := pop(1)
+		c.push(b2f(a[0] == 0))
+	case 9: // abs
+		a := pop(1)
+		c.push(math.Abs(a[0]))
+	case 10: // add
+		a := pop(2)
+		c.push(a[0] + a[1])
+	case 11: // sub
+		a := pop(2)
+		c.push(a[0] - a[1])
+	case 12: // div
+		a := pop(2)
+		r := 0.0
+		if a[1] != 0 {
+			r = a[0] / a[1]
+		}
+		c.push(r)
+	case 14: // neg
+		a := pop(1)
+		c.push(-a[0])
+	case 15: // eq
+		a := pop(2)
+		c.push(b2f(a[0] == a[1]))
+	case 18: // drop
+		pop(1)
+	case 20: // put
+		a := pop(2)
+		if i := int(a[1]); i >= 0 && i < TRANSIENT_SIZE {
+			c.trans[i] = a[0]
+		}
+	case 21: // get
+		a := pop(1)
+		r := 0.0
+		if i := int(a[0]); i >= 0 && i < TRANSIENT_SIZE {
+			r = c.trans[i]
+		}
+		c.push(r)
+	case 22: // ifelse
+		a := pop(4)
+		r := a[0]
+		if a[2] > a[3] {
+			r = a[1]
+		}
+		c.push(r)
+	case 23: // random
+		c.push(0.5)
+	case 24: // mul
+		a := pop(2)
+		c.push(a[0] * a[1])
+	case 26: // sqrt
+		a := pop(1)
+		c.push(math.Sqrt(math.Abs(a[0])))
+	case 27: // dup
+		a := c.args(1)
+		c.push(a[0])
+	case 28: // exch
+		a := c.args(2)
+		a[0], a[1] = a[1], a[0]
+	case 29: // index
+		a := pop(1)
+		i := int(a[0])
+		if i < 0 {
+			i = 0
+		}
+		c.push(c.args(i + 1)[0])
+	case 30: // roll
+		a := pop(2)
+		k, j := int(a[0]), int(a[1])
+		if k <= 0 {
+			break
+		}
+		s := c.args(k)
+		j = ((j % k) + k) % k
+		r := append(append([]float64{}, s[k-j:]...), s[:k-j]...)
+		copy(s, r)
+	default:
+		c.st = c.st[0:0]
+	}
+}
+
+// c.endChar() finishes the glyph, with four operands it is composed of
+// two glyphs of the standard encoding like by seac of Type 1.
+func (c *charStringT) endChar(depth int) {
+	c.setWidth(len(c.st) == 1 || len(c.st) == 5)
+	c.closePath()
+	c.done = true
+	if len(c.st) < 4 || c.seac {
+		return
+	}
+	a := c.args(4)
+	adx, ady, bchar, achar := a[0], a[1], int(a[2]), int(a[3])
+	if bchar < 0 || bchar > 255 || achar < 0 || achar > 255 {
+		return
+	}
+	c.seac = true
+	base := c.f.GlyphIndex(standardStrings[standardEncoding[bchar]])
+	accent := c.f.GlyphIndex(standardStrings[standardEncoding[achar]])
+	for _, g := range []int{base, accent} {
+		if g > 0 {
+			c.x, c.y = 0, 0
+			c.st = c.st[0:0]
+			c.width, c.done, c.stems = false, false, 0
+			c.run(c.f.CharStrings[g], depth)
+			c.closePath()
+		}
+		c.dx, c.dy = adx, ady
+	}
+	c.done = true
+}
+
+// c.run() executes a charstring.
+func (c *charStringT) run(s []byte, depth int) {
+	if depth > MAX_SUBR_DEPTH {
+		panic("charstring subroutines nested too deep\n")
+	}
+	for p := 0; p < len(s) && !c.done; {
+		v := int(s[p])
+		p++
+		switch {
+		case v >= 32 && v <= 246:
+			c.push(float64(v - 139))
+			continue
+		case v >= 247 && v <= 250 && p < len(s):
+			c.push(float64((v-247)*256 + int(s[p]) + 108))
+			p++
+			continue
+		case v >= 251 && v <= 254 && p < len(s):
+			c.push(float64(-(v-251)*256 - int(s[p]) - 108))
+			p++
+			continue
+		case v == 28 && p+2 <= len(s):
+			c.push(float64(int16(uint16(s[p])<<8 | uint16(s[p+1]))))
+			p += 2
+			continue
+		case v == 255 && p+4 <= len(s):
+			c.push(float64(int32(uint32(s[p])<<24|uint32(s[p+1])<<16|uint32(s[p+2])<<8|uint32(s[p+3]))) / 65536)
+			p += 4
+			continue
+		case v == 12 && p < len(s):
+			p++
+			c.escape(int(s[p-1]))
+			continue
+		}
+		switch v {
+		case 1, 3, 18, 23: // hstem, vstem, hstemhm, vstemhm
+			c.setWidth(len(c.st)&1 == 1)
+			c.stems += len(c.st) / 2
+		case 19, 20: // hintmask, cntrmask
+			c.setWidth(len(c.st)&1 == 1)
+			c.stems += len(c.st) / 2
+			p += (c.stems + 7) / 8
+		case 4: // vmoveto
+			c.setWidth(len(c.st) > 1)
+			c.moveTo(0, c.args(1)[0])
+		case 21: // rmoveto
+			c.setWidth(len(c.st) > 2)
+			a := c.args(2)
+			c.moveTo(a[0], a[1])
+		case 22: // hmoveto
+			c.setWidth(len(c.st) > 1)
+			c.moveTo(c.args(1)[0], 0)
+		case 5: // rlineto
+			for k := 0; k+1 < len(c.st); k += 2 {
+				c.lineTo(c.st[k], c.st[k+1])
+			}
+		case 6: // hlineto
+			c.alternate(true)
+		case 7: // vlineto
+			c.alternate(false)
+		case 8: // rrcurveto
+			for a := c.st; len(a) >= 6; a = a[6:] {
+				c.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			}
+		case 24: // rcurveline
+			a := c.st
+			for ; len(a) >= 8; a = a[6:] {
+				c.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			}
+			if len(a) >= 2 {
+				c.lineTo(a[0], a[1])
+			}
+		case 25: // rlinecurve
+			a := c.st
+			for ; len(a) >= 8; a = a[2:] {
+				c.lineTo(a[0], a[1])
+			}
+			if len(a) >= 6 {
+				c.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			}
+		case 26: // vvcurveto
+			a, dx := c.st, 0.0
+			if len(a)&1 == 1 {
+				dx, a = a[0], a[1:]
+			}
+			for ; len(a) >= 4; a = a[4:] {
+				c.curveTo(dx, a[0], a[1], a[2], 0, a[3])
+				dx = 0
+			}
+		case 27: // hhcurveto
+			a, dy := c.st, 0.0
+			if len(a)&1 == 1 {
+				dy, a = a[0], a[1:]
+			}
+			for ; len(a) >= 4; a = a[4:] {
+				c.curveTo(a[0], dy, a[1], a[2], a[3], 0)
+				dy = 0
+			}
+		case 30: // vhcurveto
+			c.alternateCurves(false)
+		case 31: // hvcurveto
+			c.alternateCurves(true)
+		case 10, 29: // callsubr, callgsubr
+			a := c.args(1)
+			subrs := c.f.gsubrs
+			if v == 10 {
+				subrs = c.priv.subrs
+			}
+			n := int(a[0]) + bias(subrs)
+			c.st = c.st[0 : len(c.st)-1]
+			if n >= 0 && n < len(subrs) {
+				c.run(subrs[n], depth+1)
+			}
+			continue
+		case 11: // return
+			return
+		case 14: // endchar
+			c.endChar(depth)
+		}
+		c.st = c.st[0:0]
+	}
+}
+
+// f.Glyph() runs the charstring of a glyph, nil if it is not there or can
+// not be interpreted.
+func (f *FontT) Glyph(gid int) (r *type1.GlyphT) {
+	if gid < 0 || gid >= len(f.CharStrings) || len(f.privates) == 0 {
+		return nil
+	}
+	defer func() {
+		if recover() != nil {
+			r = nil
+		}
+	}()
+	c := &charStringT{f: f, priv: &f.privates[0], r: new(type1.GlyphT)}
+	if gid < len(f.fdSelect) && f.fdSelect[gid] < len(f.privates) {
+		c.priv = &f.privates[f.fdSelect[gid]]
+	}
+	c.run(f.CharStrings[gid], 0)
+	if !c.width {
+		c.r.Wx = c.priv.defaultWidthX
+	}
+	return c.r
+}
+
+// f.Width() returns the advance of a glyph in glyph space, -1 if it is
+// not there.
+func (f *FontT) Width(gid int) float64 {
+	if g := f.Glyph(gid); g != nil {
+		return g.Wx
+	}
+	return -1
+}
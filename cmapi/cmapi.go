@@ -8,26 +8,87 @@
 package cmapi
 
 import (
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
 	"github.com/grokify/pdfreader/cmapt"
 	"github.com/grokify/pdfreader/fancy"
 	"github.com/grokify/pdfreader/ps"
 	"github.com/grokify/pdfreader/stacks"
+	"github.com/grokify/pdfreader/strm"
 	"github.com/grokify/pdfreader/xchar"
 )
 
 // CMap "interpreter" - this PS btw.
 
+// The predefined CMaps of Adobe and the CID to Unicode mappings of the
+// Adobe character collections, see cmaps/README.TXT.
+//
+//go:embed cmaps/*.gz
+var cmaps embed.FS
+
+var (
+	predefinedMu sync.Mutex
+	predefined   = make(map[string]*CharMapperT)
+)
+
+// Ranges maps the first byte of a code to the code length (codespace), Uni
+// maps codes to Unicode and CID codes to CIDs. Strings maps the codes of
+// more than one character, like ligatures, instead of Uni.
 type CharMapperT struct {
-	Ranges, Uni *cmapt.CMapT
+	Ranges, Uni, CID *cmapt.CMapT
+	Strings          map[int][]rune
+	WMode            int // 1 for vertical writing
 }
 
 func NewCharMapperT() *CharMapperT {
 	r := new(CharMapperT)
 	r.Ranges = cmapt.New()
 	r.Uni = cmapt.New()
+	r.CID = cmapt.New()
+	return r
+}
+
+// Identity() returns the mapping of the Identity-H and Identity-V CMaps
+// for n-byte codes.
+func Identity(n int) *CharMapperT {
+	r := NewCharMapperT()
+	r.Ranges.AddDef(0, 256, n)
+	r.CID.AddRange(0, 1<<(uint(n)*8), 0)
+	r.Uni.AddRange(0, 1<<(uint(n)*8), 0)
 	return r
 }
 
+// unicode() decodes the UTF-16BE destination of a bf mapping.
+func unicode(s []byte) []rune {
+	if len(s) < 4 {
+		return []rune{rune(ps.StrInt(s))}
+	}
+	u := make([]uint16, len(s)/2)
+	for k := range u {
+		u[k] = uint16(s[2*k])<<8 | uint16(s[2*k+1])
+	}
+	return utf16.Decode(u)
+}
+
+// m.add() maps a code to the characters of a bf mapping, strings of more
+// than one character go to m.Strings.
+func (m *CharMapperT) add(code int, u []rune) {
+	if len(u) == 1 {
+		m.Uni.Add(code, int(u[0]))
+		return
+	}
+	if m.Strings == nil {
+		m.Strings = make(map[int][]rune)
+	}
+	m.Strings[code] = u
+}
+
 type CharMapperI struct {
 	Target *CharMapperT
 	St     stacks.Stack
@@ -113,34 +174,60 @@ var ops = map[string]func(t *CharMapperI){
 	},
 	"endbfchar": func(t *CharMapperI) {
 		a := t.St.Drop(t.St.Depth() - t.Marker)
-		for k := 0; k < len(a); k += 2 {
-			t.Target.Uni.Add(ps.StrInt(ps.String(a[k])), ps.StrInt(ps.String(a[k+1])))
+		for k := 0; k+1 < len(a); k += 2 {
+			t.Target.add(ps.StrInt(ps.String(a[k])), unicode(ps.String(a[k+1])))
 		}
 	},
 	"endbfrange": func(t *CharMapperI) {
 		a := t.St.Drop(t.St.Depth() - t.Marker)
-		for k := 0; k < len(a); k += 3 {
-			// leaving the array expression as it is: invalidate - we do not have char names to unicode now
-			t.Target.Uni.AddRange(ps.StrInt(ps.String(a[k])),
-				ps.StrInt(ps.String(a[k+1])), ps.StrInt(ps.String(a[k+2])))
+		for k := 0; k+2 < len(a); k += 3 {
+			from, to := ps.StrInt(ps.String(a[k])), ps.StrInt(ps.String(a[k+1]))
+			if a[k+2][0] != '[' {
+				u := unicode(ps.String(a[k+2]))
+				if len(u) == 1 {
+					t.Target.Uni.AddRange(from, to+1, int(u[0]))
+					continue
+				}
+				// the last character counts up, within the last byte of the codes.
+				for c := from; c <= to && c <= from|0xFF; c++ {
+					r := append([]rune(nil), u...)
+					r[len(r)-1] += rune(c - from)
+					t.Target.add(c, r)
+				}
+				continue
+			}
+			rdr := fancy.SliceReader(a[k+2][1 : len(a[k+2])-1])
+			for c := from; c <= to; c++ {
+				d, _ := ps.Token(rdr)
+				if len(d) == 0 {
+					break
+				}
+				t.Target.add(c, unicode(ps.String(d)))
+			}
 		}
 	},
 	"endcidchar": func(t *CharMapperI) {
 		a := t.St.Drop(t.St.Depth() - t.Marker)
-		_ = a
+		for k := 0; k+1 < len(a); k += 2 {
+			t.Target.CID.Add(ps.StrInt(ps.String(a[k])), strm.Int(string(a[k+1]), 1))
+		}
 	},
 	"endcidrange": func(t *CharMapperI) {
 		a := t.St.Drop(t.St.Depth() - t.Marker)
-		_ = a
+		for k := 0; k+2 < len(a); k += 3 {
+			t.Target.CID.AddRange(ps.StrInt(ps.String(a[k])),
+				ps.StrInt(ps.String(a[k+1]))+1, strm.Int(string(a[k+2]), 1))
+		}
 	},
 	"endcmap": func(t *CharMapperI) {
 	},
 	"endcodespacerange": func(t *CharMapperI) {
 		a := t.St.Drop(t.St.Depth() - t.Marker)
-		for k := 0; k < len(a); k += 2 {
-			to, l := ps.StrIntL(ps.String(a[k+1]))
-			t.Target.Ranges.AddDef(int(a[k][0]), int(a[k+1][0])+1, l)
-			t.Target.Ranges.AddDef(ps.StrInt(ps.String(a[k])), to+1, l) // just not used.
+		for k := 0; k+1 < len(a); k += 2 {
+			from, to := ps.String(a[k]), ps.String(a[k+1])
+			if len(from) > 0 && len(to) > 0 {
+				t.Target.Ranges.AddDef(int(from[0]), int(to[0])+1, len(from))
+			}
 		}
 	},
 	"endnotdefchar": func(t *CharMapperI) {
@@ -166,23 +253,28 @@ var ops = map[string]func(t *CharMapperI){
 	},
 	"findresource": func(t *CharMapperI) {
 		a := t.St.Drop(2)
-		t.St.Push([]byte{'?'})
-		_ = a
+		t.St.Push(a[0])
 	},
 	"pop": func(t *CharMapperI) {
 		a := t.St.Pop()
 		_ = a
 	},
-	"usecmap": func(t *CharMapperI) {
-		a := t.St.Pop()
-		_ = a
-	},
 	"usefont": func(t *CharMapperI) {
 		a := t.St.Pop()
 		_ = a
 	},
 }
 
+// used to solve an initialization loop
+func init() {
+	ops["usecmap"] = func(t *CharMapperI) {
+		a := t.St.Pop()
+		if p := Predefined(string(a)); p != nil {
+			t.Target.Use(p)
+		}
+	}
+}
+
 func Read(rdr fancy.Reader) (r *CharMapperT) {
 	r = NewCharMapperT()
 	if rdr == nil { // make identity setup
@@ -202,17 +294,80 @@ func Read(rdr fancy.Reader) (r *CharMapperT) {
 			cm.St.Push(t)
 		}
 	}
+	r.WMode = strm.Int(string(cm.Dic["/WMode"]), 1)
 	return
 }
 
-func Decode(s []byte, to *CharMapperT) (r []byte) {
-	r = make([]byte, len(s)*6)
-	p := 0
+// Predefined() returns a CMap bundled with the package like
+// "/UniJIS-UCS2-H" or "Adobe-Japan1-UCS2", nil if it is not known. The
+// CMaps are read on first use and shared, they must not be modified.
+func Predefined(name string) *CharMapperT {
+	name = strings.TrimPrefix(name, "/")
+	predefinedMu.Lock()
+	r, ok := predefined[name]
+	predefinedMu.Unlock()
+	if ok {
+		return r
+	}
+	if data, err := cmaps.ReadFile("cmaps/" + name + ".gz"); err == nil {
+		if z, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+			if cm, err := io.ReadAll(z); err == nil {
+				r = Read(fancy.SliceReader(cm))
+			}
+		}
+	}
+	predefinedMu.Lock()
+	predefined[name] = r
+	predefinedMu.Unlock()
+	return r
+}
+
+// m.Use() adds the mappings of p not defined in m, like "usecmap".
+func (m *CharMapperT) Use(p *CharMapperT) {
+	for c, r := range p.Strings {
+		if _, ok := m.Strings[c]; !ok && m.Uni.Code(c) < 0 {
+			if m.Strings == nil {
+				m.Strings = make(map[int][]rune)
+			}
+			m.Strings[c] = r
+		}
+	}
+	m.Ranges.Use(p.Ranges)
+	m.Uni.Use(p.Uni)
+	m.CID.Use(p.CID)
+}
+
+// Codes() splits a string into character codes by the codespace of m.
+// Bytes outside of the codespace are taken as single byte codes.
+func Codes(s []byte, m *CharMapperT) []int {
+	r := make([]int, 0, len(s))
 	for k := 0; k < len(s); {
-		l := to.Ranges.Code(int(s[k]))
-		a := ps.StrInt(s[k : k+l])
+		l := m.Ranges.Code(int(s[k]))
+		if l < 1 {
+			l = 1
+		}
+		if k+l > len(s) {
+			l = len(s) - k
+		}
+		r = append(r, ps.StrInt(s[k:k+l]))
 		k += l
-		p += xchar.EncodeRune(to.Uni.Code(a), r[p:len(r)])
 	}
-	return r[0:p]
+	return r
+}
+
+// UnicodeOf() returns UTF-8 for codes by the Unicode mapping of to.
+func UnicodeOf(codes []int, to *CharMapperT) []byte {
+	r := make([]byte, 0, len(codes)*4)
+	for _, c := range codes {
+		if s, ok := to.Strings[c]; ok {
+			r = append(r, string(s)...)
+		} else {
+			r = append(r, xchar.Utf8(to.Uni.Code(c))...)
+		}
+	}
+	return r
+}
+
+func Decode(s []byte, to *CharMapperT) []byte {
+	return UnicodeOf(Codes(s, to), to)
 }
@@ -114,3 +114,43 @@ func (m *CMapT) Add(k, dest int) {
 		m.Extended[k] = dest
 	}
 }
+
+// appendRanges() appends a copy of the chain p to the end of chain m.
+func appendRanges(m, p *CMapRangeT) *CMapRangeT {
+	var head, tail *CMapRangeT
+	for ; p != nil; p = p.Prev {
+		r := new(CMapRangeT)
+		r.From, r.To, r.Dest = p.From, p.To, p.Dest
+		if tail == nil {
+			head = r
+		} else {
+			tail.Prev = r
+		}
+		tail = r
+	}
+	if m == nil {
+		return head
+	}
+	t := m
+	for t.Prev != nil {
+		t = t.Prev
+	}
+	t.Prev = head
+	return m
+}
+
+// m.Use() adds the mappings of p which are not defined in m.
+func (m *CMapT) Use(p *CMapT) {
+	for k := range m.Basic {
+		if m.Basic[k] == -1 {
+			m.Basic[k] = p.Basic[k]
+		}
+	}
+	for k, v := range p.Extended {
+		if m.Code(k) == -1 {
+			m.Extended[k] = v
+		}
+	}
+	m.Ranges = appendRanges(m.Ranges, p.Ranges)
+	m.DRanges = appendRanges(m.DRanges, p.DRanges)
+}
@@ -0,0 +1,368 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Color spaces of PDF, resolved to device colors for graf.
+package colorspace
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/function"
+	"github.com/grokify/pdfreader/graf"
+	"github.com/grokify/pdfreader/icc"
+	"github.com/grokify/pdfreader/ps"
+)
+
+// color spaces are nested by /Indexed, /Pattern and alternates.
+const MAX_DEPTH = 4
+
+// TintT is a tint transform of /Separation or /DeviceN spaces.
+type TintT interface {
+	Eval(in []float64) []float64
+}
+
+type SpaceT struct {
+	Family     string  // like "/DeviceRGB" or "/Indexed"
+	N          int     // number of components
+	Base       *SpaceT // of /Indexed and /Pattern, alternate of the others
+	Hival      int     // of /Indexed
+	Lookup     []byte  // of /Indexed
+	Names      []string
+	Tint       TintT         // nil if it can not be read, gray is taken then
+	TintRef    []byte        // the function of the tint transform
+	ICC        []byte        // the stream of /ICCBased
+	Profile    *icc.ProfileT // of ICC, nil if profiles are not used
+	WhitePoint [3]float64
+	Gamma      [3]float64
+	Matrix     [9]float64 // of /CalRGB
+	Range      []float64  // min and max by component
+}
+
+// Device() returns a device color space: "/DeviceGray", "/DeviceRGB" or
+// "/DeviceCMYK" and the abbreviations of inline images. nil for other names.
+func Device(name string) *SpaceT {
+	switch name {
+	case "/DeviceGray", "/G":
+		return &SpaceT{Family: "/DeviceGray", N: 1}
+	case "/DeviceRGB", "/RGB":
+		return &SpaceT{Family: "/DeviceRGB", N: 3}
+	case "/DeviceCMYK", "/CMYK":
+		return &SpaceT{Family: "/DeviceCMYK", N: 4}
+	}
+	return nil
+}
+
+func numbers(pd *pdfreader.PDFReader, o []byte) []float64 {
+	a := pd.Arr(o)
+	r := make([]float64, len(a))
+	for k := range a {
+		r[k], _ = strconv.ParseFloat(string(pd.Obj(a[k])), 64)
+	}
+	return r
+}
+
+func number(pd *pdfreader.PDFReader, o []byte, def float64) float64 {
+	if v, err := strconv.ParseFloat(string(pd.Obj(o)), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// cie() reads the dictionary of /CalGray, /CalRGB and /Lab.
+func (s *SpaceT) cie(pd *pdfreader.PDFReader, d pdfreader.Dictionary) {
+	s.WhitePoint = [3]float64{0.9505, 1, 1.089}
+	if w := numbers(pd, d["/WhitePoint"]); len(w) == 3 {
+		copy(s.WhitePoint[:], w)
+	}
+	s.Gamma = [3]float64{1, 1, 1}
+	if g := numbers(pd, d["/Gamma"]); len(g) == 3 {
+		copy(s.Gamma[:], g)
+	} else {
+		g := number(pd, d["/Gamma"], 1)
+		s.Gamma = [3]float64{g, g, g}
+	}
+	s.Matrix = [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+	if m := numbers(pd, d["/Matrix"]); len(m) == 9 {
+		copy(s.Matrix[:], m)
+	}
+	if r := numbers(pd, d["/Range"]); len(r) == 4 {
+		s.Range = append([]float64{0, 100}, r...)
+	}
+}
+
+type Options struct {
+	ICC bool // convert /ICCBased colors by their profiles
+}
+
+// Read() resolves a color space object, nil if it is not one.
+func Read(pd *pdfreader.PDFReader, o []byte) *SpaceT {
+	return read(pd, o, 0, &Options{})
+}
+
+// ReadWith() is Read() with options, opts may be nil.
+func ReadWith(pd *pdfreader.PDFReader, o []byte, opts *Options) *SpaceT {
+	if opts == nil {
+		opts = &Options{}
+	}
+	return read(pd, o, 0, opts)
+}
+
+func read(pd *pdfreader.PDFReader, o []byte, depth int, opts *Options) *SpaceT {
+	if depth > MAX_DEPTH {
+		return nil
+	}
+	o = pd.Obj(o)
+	if len(o) > 0 && o[0] == '/' {
+		if string(o) == "/Pattern" {
+			return &SpaceT{Family: "/Pattern"}
+		}
+		return Device(string(o))
+	}
+	a := pd.Arr(o)
+	if len(a) == 0 {
+		return nil
+	}
+	r := &SpaceT{Family: string(pd.Obj(a[0]))}
+	arg := func(k int) []byte {
+		if k < len(a) {
+			return a[k]
+		}
+		return nil
+	}
+	switch r.Family {
+	case "/DeviceGray", "/DeviceRGB", "/DeviceCMYK", "/G", "/RGB", "/CMYK":
+		return Device(r.Family)
+	case "/CalGray":
+		r.N = 1
+		r.cie(pd, pd.Dic(arg(1)))
+	case "/CalRGB":
+		r.N = 3
+		r.cie(pd, pd.Dic(arg(1)))
+	case "/Lab":
+		r.N = 3
+		r.cie(pd, pd.Dic(arg(1)))
+		if r.Range == nil {
+			r.Range = []float64{0, 100, -100, 100, -100, 100}
+		}
+	case "/ICCBased":
+		d, prf := pd.DecodedStream(arg(1))
+		r.ICC = arg(1)
+		r.N = int(number(pd, d["/N"], 3))
+		if p := icc.Read(prf); opts.ICC && p != nil && p.N == r.N {
+			r.Profile = p
+		}
+		if alt, ok := d["/Alternate"]; ok {
+			r.Base = read(pd, alt, depth+1, opts)
+		}
+		if r.Base == nil || r.Base.N != r.N {
+			r.Base = Device(map[int]string{1: "/DeviceGray", 4: "/DeviceCMYK"}[r.N])
+			if r.Base == nil {
+				r.Base = Device("/DeviceRGB")
+			}
+		}
+		if rg := numbers(pd, d["/Range"]); len(rg) == 2*r.N {
+			r.Range = rg
+		}
+	case "/Indexed", "/I":
+		r.Family, r.N = "/Indexed", 1
+		if r.Base = read(pd, arg(1), depth+1, opts); r.Base == nil {
+			return nil
+		}
+		r.Hival = int(number(pd, arg(2), 0))
+		if l := pd.Obj(arg(3)); len(l) > 0 && (l[0] == '(' || l[0] == '<') {
+			r.Lookup = ps.String(l)
+		} else {
+			_, r.Lookup = pd.DecodedStream(arg(3))
+		}
+	case "/Pattern":
+		r.Base = read(pd, arg(1), depth+1, opts)
+		if r.Base != nil {
+			r.N = r.Base.N
+		}
+	case "/Separation":
+		r.N = 1
+		r.Names = []string{string(pd.Obj(arg(1)))}
+		r.Base, r.TintRef = read(pd, arg(2), depth+1, opts), arg(3)
+	case "/DeviceN":
+		for _, n := range pd.Arr(arg(1)) {
+			r.Names = append(r.Names, string(pd.Obj(n)))
+		}
+		r.N = len(r.Names)
+		r.Base, r.TintRef = read(pd, arg(2), depth+1, opts), arg(3)
+	default:
+		return nil
+	}
+	if r.TintRef != nil {
+		if f := function.Read(pd, r.TintRef); f != nil {
+			r.Tint = f
+		}
+	}
+	return r
+}
+
+func (s *SpaceT) NComps() int { return s.N }
+
+// s.Initial() returns the color set by selecting the space.
+func (s *SpaceT) Initial() []float64 {
+	r := make([]float64, s.N)
+	switch s.Family {
+	case "/DeviceCMYK":
+		r[3] = 1
+	case "/Separation", "/DeviceN":
+		for k := range r {
+			r[k] = 1
+		}
+	case "/Lab", "/ICCBased":
+		for k := range r {
+			r[k] = min(s.ComponentRange(k)[1], max(s.ComponentRange(k)[0], 0))
+		}
+	}
+	return r
+}
+
+// s.ComponentRange() returns the minimum and maximum of a component.
+func (s *SpaceT) ComponentRange(k int) [2]float64 {
+	if 2*k+1 < len(s.Range) {
+		return [2]float64{s.Range[2*k], s.Range[2*k+1]}
+	}
+	if s.Family == "/Indexed" {
+		return [2]float64{0, float64(s.Hival)}
+	}
+	return [2]float64{0, 1}
+}
+
+// s.Device() resolves a color to a device color space, "" for patterns.
+func (s *SpaceT) Device(c []float64) (string, []float64) {
+	v := make([]float64, s.N)
+	for k := range v {
+		rg := s.ComponentRange(k)
+		if k < len(c) {
+			v[k] = min(rg[1], max(rg[0], c[k]))
+		}
+	}
+	switch s.Family {
+	case "/DeviceGray", "/DeviceRGB", "/DeviceCMYK":
+		return s.Family, v
+	case "/CalGray":
+		return "/DeviceGray", []float64{icc.Encode(math.Pow(v[0], s.Gamma[0]))}
+	case "/CalRGB":
+		abc := [3]float64{}
+		for k := range abc {
+			abc[k] = math.Pow(v[k], s.Gamma[k])
+		}
+		m := s.Matrix
+		return "/DeviceRGB", s.sRGB(
+			m[0]*abc[0]+m[3]*abc[1]+m[6]*abc[2],
+			m[1]*abc[0]+m[4]*abc[1]+m[7]*abc[2],
+			m[2]*abc[0]+m[5]*abc[1]+m[8]*abc[2])
+	case "/Lab":
+		g := func(x float64) float64 {
+			if x >= 6.0/29 {
+				return x * x * x
+			}
+			return 108.0 / 841 * (x - 4.0/29)
+		}
+		l := (v[0] + 16) / 116
+		w := s.WhitePoint
+		return "/DeviceRGB", s.sRGB(w[0]*g(l+v[1]/500), w[1]*g(l), w[2]*g(l-v[2]/200))
+	case "/ICCBased":
+		if s.Profile != nil {
+			for k := range v {
+				rg := s.ComponentRange(k)
+				v[k] = (v[k] - rg[0]) / (rg[1] - rg[0])
+			}
+			return "/DeviceRGB", s.Profile.SRGB(v)
+		}
+		return s.Base.Device(v)
+	case "/Indexed":
+		n := s.Base.N
+		i := int(math.Round(v[0]))
+		b := make([]float64, n)
+		for k := range b {
+			if p := i*n + k; p < len(s.Lookup) {
+				rg := s.Base.ComponentRange(k)
+				b[k] = rg[0] + float64(s.Lookup[p])/255*(rg[1]-rg[0])
+			}
+		}
+		return s.Base.Device(b)
+	case "/Separation", "/DeviceN":
+		if s.Tint != nil && s.Base != nil {
+			return s.Base.Device(s.Tint.Eval(v))
+		}
+		// without tint transform the colorants are taken as black ink.
+		sum := 0.0
+		for _, t := range v {
+			sum += t
+		}
+		return "/DeviceGray", []float64{1 - min(1, sum)}
+	}
+	return "", nil
+}
+
+// s.sRGB() converts CIE XYZ of the white point of s to sRGB, the white
+// points are matched by scaling.
+func (s *SpaceT) sRGB(x, y, z float64) []float64 {
+	w := s.WhitePoint
+	x, y, z = x/w[0]*0.9505, y/w[1], z/w[2]*1.089
+	return []float64{
+		icc.Encode(3.2406*x - 1.5372*y - 0.4986*z),
+		icc.Encode(-0.9689*x + 1.8758*y + 0.0415*z),
+		icc.Encode(0.0557*x - 0.2040*y + 1.0570*z),
+	}
+}
+
+// CMYKToRGB() converts a DeviceCMYK color to sRGB by a profile, naive if
+// it is nil. Drawers and image decoding share it.
+func CMYKToRGB(c []float64, profile *icc.ProfileT) []float64 {
+	if profile != nil && profile.N == 4 {
+		return profile.SRGB(c)
+	}
+	return []float64{(1 - c[0]) * (1 - c[3]), (1 - c[1]) * (1 - c[3]), (1 - c[2]) * (1 - c[3])}
+}
+
+// ResourcesT resolves the names of CS and cs by /ColorSpace resources.
+type ResourcesT struct {
+	Opts   *Options
+	pd     *pdfreader.PDFReader
+	spaces pdfreader.Dictionary
+	cache  map[string]graf.ColorSpace
+}
+
+// New() returns the color spaces of a /Resources dictionary.
+func New(pd *pdfreader.PDFReader, resources []byte) *ResourcesT {
+	return NewWith(pd, resources, nil)
+}
+
+// NewWith() is New() with options, opts may be nil.
+func NewWith(pd *pdfreader.PDFReader, resources []byte, opts *Options) *ResourcesT {
+	if opts == nil {
+		opts = &Options{}
+	}
+	r := &ResourcesT{Opts: opts, pd: pd, cache: make(map[string]graf.ColorSpace)}
+	if resources != nil {
+		r.spaces = pd.Dic(pd.Dic(resources)["/ColorSpace"])
+	}
+	return r
+}
+
+func (r *ResourcesT) ColorSpace(name []byte) graf.ColorSpace {
+	if cs, ok := r.cache[string(name)]; ok {
+		return cs
+	}
+	var cs graf.ColorSpace
+	o, ok := r.spaces[string(name)]
+	if !ok {
+		o = name // like /Pattern
+	}
+	if s := ReadWith(r.pd, o, r.Opts); s != nil {
+		cs = s
+	}
+	r.cache[string(name)] = cs
+	return cs
+}
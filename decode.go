@@ -0,0 +1,129 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package pdfreader
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"github.com/grokify/pdfreader/limits"
+)
+
+// Predictors of /FlateDecode and /LZWDecode, and /DCTDecode.
+
+// pd.predict() undoes the /Predictor of /DecodeParms deco on data.
+func (pd *PDFReader) predict(data []byte, deco Dictionary) []byte {
+	param := func(key string, def int) int {
+		if v, ok := deco[key]; ok {
+			return pd.num(v)
+		}
+		return def
+	}
+	predictor := param("/Predictor", 1)
+	colors, bpc, columns := param("/Colors", 1), param("/BitsPerComponent", 8), param("/Columns", 1)
+	if predictor < 2 || colors < 1 || colors > 32 || bpc < 1 || bpc > 16 || columns < 1 ||
+		columns > len(data)*8/(colors*bpc) {
+		return data
+	}
+	bpp := max(1, colors*bpc/8)
+	row := (colors*bpc*columns + 7) / 8
+	if predictor == 2 {
+		if bpc == 8 {
+			for p := 0; p+row <= len(data); p += row {
+				for k := bpp; k < row; k++ {
+					data[p+k] += data[p+k-bpp]
+				}
+			}
+		}
+		return data
+	}
+	// PNG predictors, every row starts with the type of its predictor.
+	r := make([]byte, 0, len(data)/(row+1)*row)
+	prev := make([]byte, row)
+	for p := 0; p+row+1 <= len(data); p += row + 1 {
+		t, cur := data[p], data[p+1:p+1+row]
+		for k := range cur {
+			a, b, c := byte(0), prev[k], byte(0)
+			if k >= bpp {
+				a, c = cur[k-bpp], prev[k-bpp]
+			}
+			switch t {
+			case 1:
+				cur[k] += a
+			case 2:
+				cur[k] += b
+			case 3:
+				cur[k] += byte((int(a) + int(b)) / 2)
+			case 4:
+				cur[k] += paeth(a, b, c)
+			}
+		}
+		r = append(r, cur...)
+		prev = cur
+	}
+	return r
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// dct() decodes /DCTDecode data into samples of 8 bits, gray, RGB or
+// CMYK by the components of the JPEG, with at most max bytes.
+func dct(data []byte, max int64) []byte {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return []byte{}
+	}
+	n := 3
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		n = 1
+	case color.CMYKModel:
+		n = 4
+	}
+	limits.Check("MaxStreamSize", int64(cfg.Width)*int64(cfg.Height)*int64(n), max)
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return []byte{}
+	}
+	b := img.Bounds()
+	r := make([]byte, 0, b.Dx()*b.Dy()*n)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			switch m := img.(type) {
+			case *image.Gray:
+				r = append(r, m.GrayAt(x, y).Y)
+			case *image.CMYK:
+				c := m.CMYKAt(x, y)
+				r = append(r, c.C, c.M, c.Y, c.K)
+			default:
+				c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				r = append(r, c.R, c.G, c.B)
+			}
+		}
+	}
+	return r
+}
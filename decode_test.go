@@ -0,0 +1,174 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package pdfreader
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// streamFile() writes a PDF file with the streams as objects 1, 2, ...
+// and returns its name.
+func streamFile(t *testing.T, streams ...[]byte) string {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	var offs []int
+	for k, s := range streams {
+		offs = append(offs, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", k+1, s)
+	}
+	root := len(streams) + 1
+	offs = append(offs, b.Len())
+	fmt.Fprintf(&b, "%d 0 obj\n<< /Type /Catalog >>\nendobj\n", root)
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", root+1)
+	for _, o := range offs {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", root+1, root, xref)
+	fn := filepath.Join(t.TempDir(), "streams.pdf")
+	if err := os.WriteFile(fn, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func stream(dic string, data []byte) []byte {
+	return append([]byte(fmt.Sprintf("<< %s /Length %d >>\nstream\n", dic, len(data))),
+		append(data, "\nendstream"...)...)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestPredictors(t *testing.T) {
+	// 3 rows of 2 RGB samples, 8 bits.
+	want := []byte{
+		10, 20, 30, 40, 50, 60,
+		11, 22, 33, 44, 55, 66,
+		200, 100, 0, 250, 5, 7,
+	}
+	row := 6
+	// PNG rows with the predictor types None, Sub, Up, Average and Paeth.
+	png := func(types ...byte) []byte {
+		var r []byte
+		prev := make([]byte, row)
+		for y, typ := range types {
+			cur := want[y*row : (y+1)*row]
+			r = append(r, typ)
+			for k := range cur {
+				a, b, c := byte(0), prev[k], byte(0)
+				if k >= 3 {
+					a, c = cur[k-3], prev[k-3]
+				}
+				switch typ {
+				case 0:
+					r = append(r, cur[k])
+				case 1:
+					r = append(r, cur[k]-a)
+				case 2:
+					r = append(r, cur[k]-b)
+				case 3:
+					r = append(r, cur[k]-byte((int(a)+int(b))/2))
+				case 4:
+					r = append(r, cur[k]-paeth(a, b, c))
+				}
+			}
+			prev = cur
+		}
+		return r
+	}
+	tiff := make([]byte, len(want))
+	for p := 0; p < len(want); p += row {
+		copy(tiff[p:p+3], want[p:p+3])
+		for k := 3; k < row; k++ {
+			tiff[p+k] = want[p+k] - want[p+k-3]
+		}
+	}
+	parms := "/DecodeParms << /Predictor %d /Colors 3 /BitsPerComponent 8 /Columns 2 >>"
+	fn := streamFile(t,
+		stream("/Filter /FlateDecode "+fmt.Sprintf(parms, 12), deflate(png(0, 1, 2))),
+		stream("/Filter /FlateDecode "+fmt.Sprintf(parms, 15), deflate(png(3, 4, 1))),
+		stream("/Filter /FlateDecode "+fmt.Sprintf(parms, 2), deflate(tiff)),
+		stream("/Filter [/FlateDecode] /DecodeParms ["+fmt.Sprintf(parms, 2)[13:]+"]", deflate(tiff)),
+		stream("/Filter /FlateDecode", deflate(want)),
+	)
+	pd := Load(fn)
+	if pd == nil {
+		t.Fatal("could not load")
+	}
+	for k, name := range []string{"PNG None/Sub/Up", "PNG Average/Paeth/Sub", "TIFF", "TIFF in arrays", "no predictor"} {
+		_, data := pd.DecodedStream([]byte(fmt.Sprintf("%d 0 R", k+1)))
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: got %v, want %v", name, data, want)
+		}
+	}
+}
+
+func TestDCT(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 16, 8))
+	for k := range img.Pix {
+		img.Pix[k] = 128
+	}
+	var gray bytes.Buffer
+	if err := jpeg.Encode(&gray, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			rgba.Set(x, y, color.RGBA{200, 40, 40, 255})
+		}
+	}
+	var rgb bytes.Buffer
+	if err := jpeg.Encode(&rgb, rgba, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	pd := Load(streamFile(t,
+		stream("/Filter /DCTDecode", gray.Bytes()),
+		stream("/Filter /DCTDecode", rgb.Bytes()),
+		stream("/Filter /DCTDecode", []byte("no JPEG")),
+	))
+	if pd == nil {
+		t.Fatal("could not load")
+	}
+	near := func(a, b byte) bool { return int(a)-int(b) <= 4 && int(b)-int(a) <= 4 }
+	_, data := pd.DecodedStream([]byte("1 0 R"))
+	if len(data) != 16*8 {
+		t.Fatalf("gray: got %d bytes, want %d", len(data), 16*8)
+	}
+	for _, v := range data {
+		if !near(v, 128) {
+			t.Fatalf("gray: got sample %d, want 128", v)
+		}
+	}
+	_, data = pd.DecodedStream([]byte("2 0 R"))
+	if len(data) != 8*8*3 {
+		t.Fatalf("RGB: got %d bytes, want %d", len(data), 8*8*3)
+	}
+	for p := 0; p < len(data); p += 3 {
+		if !near(data[p], 200) || !near(data[p+1], 40) || !near(data[p+2], 40) {
+			t.Fatalf("RGB: got %v, want near [200 40 40]", data[p:p+3])
+		}
+	}
+	if _, data = pd.DecodedStream([]byte("3 0 R")); len(data) != 0 {
+		t.Errorf("broken JPEG: got %d bytes, want none", len(data))
+	}
+}
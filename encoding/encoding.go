@@ -0,0 +1,268 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Encodings of simple fonts and glyph names to Unicode.
+package encoding
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/cff"
+	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/limits"
+	"github.com/grokify/pdfreader/strm"
+	"github.com/grokify/pdfreader/type1"
+)
+
+// The Adobe Glyph List and its ZapfDingbats companion, see the copyright
+// notices inside of the files.
+
+//go:embed glyphlist.txt
+var glyphlist string
+
+//go:embed zapfdingbats.txt
+var zapfdingbats string
+
+var (
+	agl     map[string]int
+	aglOnce sync.Once
+)
+
+func aglLoad() {
+	agl = make(map[string]int)
+	for _, list := range []string{glyphlist, zapfdingbats} {
+		for _, l := range strings.Split(list, "\n") {
+			if len(l) == 0 || l[0] == '#' {
+				continue
+			}
+			f := strings.SplitN(l, ";", 2)
+			if len(f) != 2 || len(f[1]) < 4 {
+				continue
+			}
+			if u, err := strconv.ParseInt(f[1][0:4], 16, 32); err == nil {
+				agl[f[0]] = int(u)
+			}
+		}
+	}
+}
+
+func upperHex(s string) (int, bool) {
+	for k := range s {
+		if !(s[k] >= '0' && s[k] <= '9' || s[k] >= 'A' && s[k] <= 'F') {
+			return 0, false
+		}
+	}
+	u, err := strconv.ParseInt(s, 16, 32)
+	if err != nil || u >= 0xD800 && u <= 0xDFFF || u > 0x10FFFF {
+		return 0, false
+	}
+	return int(u), true
+}
+
+// Text() maps a glyph name to Unicode following the Adobe Glyph List
+// specification: suffixes after "." are dropped, the components of
+// ligatures like "f_f_i" are mapped one by one, "uniXXXX" with one or more
+// characters like "uni00660069" and "uXXXX" to "uXXXXXX" are decoded.
+// Unknown components are dropped, nil if none is known.
+func Text(glyph string) (r []rune) {
+	if len(glyph) > 0 && glyph[0] == '/' {
+		glyph = glyph[1:]
+	}
+	if p := strings.IndexByte(glyph, '.'); p >= 0 {
+		glyph = glyph[0:p]
+	}
+	aglOnce.Do(aglLoad)
+	for _, c := range strings.Split(glyph, "_") {
+		r = append(r, component(c)...)
+	}
+	return
+}
+
+// component() maps a component of a glyph name, nil if it is not known.
+func component(c string) []rune {
+	if u, ok := agl[c]; ok {
+		return []rune{rune(u)}
+	}
+	if len(c) >= 7 && c[0:3] == "uni" && (len(c)-3)%4 == 0 {
+		r := make([]rune, 0, (len(c)-3)/4)
+		for p := 3; p < len(c); p += 4 {
+			u, ok := upperHex(c[p : p+4])
+			if !ok {
+				return nil
+			}
+			r = append(r, rune(u))
+		}
+		return r
+	}
+	if len(c) >= 5 && len(c) <= 7 && c[0] == 'u' {
+		if u, ok := upperHex(c[1:]); ok {
+			return []rune{rune(u)}
+		}
+	}
+	return nil
+}
+
+// Unicode() maps a glyph name to its character by Text(), -1 if it has
+// none or more than one like ligatures.
+func Unicode(glyph string) int {
+	if r := Text(glyph); len(r) == 1 {
+		return int(r[0])
+	}
+	return -1
+}
+
+// Named() returns the table of a predefined encoding like
+// "/WinAnsiEncoding", nil for unknown names.
+func Named(name string) *[256]string {
+	switch name {
+	case "/StandardEncoding":
+		return &Standard
+	case "/WinAnsiEncoding":
+		return &WinAnsi
+	case "/MacRomanEncoding":
+		return &MacRoman
+	case "/PDFDocEncoding":
+		return &PDFDoc
+	}
+	return nil
+}
+
+// Differences() applies a /Differences array to a copy of enc.
+func Differences(enc *[256]string, diff [][]byte) *[256]string {
+	r := new([256]string)
+	if enc != nil {
+		*r = *enc
+	}
+	code := 0
+	for _, d := range diff {
+		if len(d) == 0 {
+			continue
+		}
+		if d[0] != '/' {
+			code = strm.Int(string(d), 1)
+			continue
+		}
+		if code >= 0 && code < 256 {
+			r[code] = string(d[1:])
+		}
+		code++
+	}
+	return r
+}
+
+// Builtin() returns the encoding of a font program read by type1.Read(),
+// nil if it has none.
+func Builtin(t *type1.TypeOneI) *[256]string {
+	var e []byte
+	for _, id := range t.Fonts {
+		if len(id) > 0 && id[0] == 'D' {
+			e = t.Dic(id)["/Encoding"]
+		}
+	}
+	for k := 0; e == nil && k < t.DicNo; k++ {
+		e = t.Dicts[k].Defs["/Encoding"]
+	}
+	switch {
+	case e == nil:
+		return nil
+	case string(e) == "StandardEncoding":
+		return &Standard
+	case e[0] != 'A':
+		return nil
+	}
+	r := new([256]string)
+	for k, n := range t.Array(string(e)) {
+		if k < 256 && len(n) > 1 && n[0] == '/' && string(n) != "/.notdef" {
+			r[k] = string(n[1:])
+		}
+	}
+	return r
+}
+
+// embedded() reads the built-in encoding of an embedded Type 1 font.
+// Font programs the interpreter can not handle give nil.
+func embedded(pd *pdfreader.PDFReader, ff []byte) (r *[256]string) {
+	defer limits.Recover(func(interface{}) { r = nil })
+	_, prg := pd.DecodedStream(ff)
+	if len(prg) == 0 {
+		return nil
+	}
+	return Builtin(type1.Read(fancy.SliceReader(prg)))
+}
+
+// embeddedCFF() reads the built-in encoding of an embedded Type1C font.
+func embeddedCFF(pd *pdfreader.PDFReader, ff []byte) *[256]string {
+	d, prg := pd.DecodedStream(ff)
+	if string(d["/Subtype"]) != "/Type1C" {
+		return nil
+	}
+	if f := cff.Read(prg); f != nil && f.CIDs == nil {
+		return &f.Encoding
+	}
+	return nil
+}
+
+// base() finds the encoding of a simple font without /Encoding or
+// /BaseEncoding.
+func base(pd *pdfreader.PDFReader, d pdfreader.Dictionary) *[256]string {
+	if fd, ok := d["/FontDescriptor"]; ok {
+		if ff, ok := pd.Dic(fd)["/FontFile"]; ok {
+			if r := embedded(pd, ff); r != nil {
+				return r
+			}
+		}
+		if ff, ok := pd.Dic(fd)["/FontFile3"]; ok {
+			if r := embeddedCFF(pd, ff); r != nil {
+				return r
+			}
+		}
+	}
+	bf := string(d["/BaseFont"])
+	if p := strings.IndexByte(bf, '+'); p >= 0 {
+		bf = "/" + bf[p+1:]
+	}
+	switch {
+	case bf == "/Symbol":
+		return &Symbol
+	case bf == "/ZapfDingbats":
+		return &ZapfDingbats
+	case string(d["/Subtype"]) == "/TrueType", string(d["/Subtype"]) == "/Type3":
+		return nil
+	}
+	return &Standard
+}
+
+// Font() returns the encoding of the simple font with dictionary d, nil
+// for composite fonts and if the encoding is not known.
+func Font(pd *pdfreader.PDFReader, d pdfreader.Dictionary) *[256]string {
+	if string(d["/Subtype"]) == "/Type0" {
+		return nil
+	}
+	e, ok := d["/Encoding"]
+	if !ok {
+		return base(pd, d)
+	}
+	if e = pd.Obj(e); len(e) > 0 && e[0] == '/' {
+		if r := Named(string(e)); r != nil {
+			return r
+		}
+		return base(pd, d)
+	}
+	ed := pd.Dic(e)
+	r := Named(string(ed["/BaseEncoding"]))
+	if r == nil {
+		r = base(pd, d)
+	}
+	if diff, ok := ed["/Differences"]; ok {
+		r = Differences(r, pd.Arr(diff))
+	}
+	return r
+}
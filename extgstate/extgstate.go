@@ -0,0 +1,69 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Graphics state parameter dictionaries (/ExtGState resources) for graf.go.
+package extgstate
+
+import (
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/util"
+)
+
+// ResourcesT resolves the names of gs by /ExtGState resources.
+type ResourcesT struct {
+	pd     *pdfreader.PDFReader
+	states pdfreader.Dictionary
+	cache  map[string]map[string][][]byte
+}
+
+// New() returns the graphics states of a /Resources dictionary.
+func New(pd *pdfreader.PDFReader, resources []byte) *ResourcesT {
+	r := &ResourcesT{pd: pd, cache: make(map[string]map[string][][]byte)}
+	if resources != nil {
+		r.states = pd.Dic(pd.Dic(resources)["/ExtGState"])
+	}
+	return r
+}
+
+// r.resolve() returns an object with the references in it resolved, for
+// the operands of an operator.
+func (r *ResourcesT) resolve(o []byte) []byte {
+	o = r.pd.Obj(o)
+	if len(o) == 0 || o[0] != '[' {
+		return o
+	}
+	a := r.pd.Arr(o)
+	s := make([]string, len(a))
+	for k := range a {
+		s[k] = string(r.resolve(a[k]))
+	}
+	return append(append([]byte{'['}, util.JoinStrings(s, ' ')...), ']')
+}
+
+// r.GState() returns the entries of a graphics state parameter dictionary
+// as operands, nil if there is none of the name.
+func (r *ResourcesT) GState(name []byte) map[string][][]byte {
+	if g, ok := r.cache[string(name)]; ok {
+		return g
+	}
+	var g map[string][][]byte
+	if o, ok := r.states[string(name)]; ok {
+		g = make(map[string][][]byte)
+		for key, v := range r.pd.Dic(o) {
+			switch key {
+			case "/D": // [array phase]
+				if a := r.pd.Arr(v); len(a) == 2 {
+					g[key] = [][]byte{r.resolve(a[0]), r.resolve(a[1])}
+				}
+			default:
+				g[key] = [][]byte{r.resolve(v)}
+			}
+		}
+	}
+	r.cache[string(name)] = g
+	return g
+}
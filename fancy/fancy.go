@@ -10,8 +10,10 @@ package fancy
 
 import (
 	"bufio"
+	"container/list"
 	"io"
 	"os"
+	"sync"
 )
 
 type Reader interface {
@@ -31,10 +33,20 @@ const (
 	_SECTOR_COUNT = 32
 )
 
+type sectorT struct {
+	pos  int64
+	data []byte
+}
+
+// SecReaderT is a sector cache on top of an io.ReaderAt. ReadAt() is safe
+// for concurrent use, the read position of Read() and Seek() is not - use
+// Cursor() for that.
 type SecReaderT struct {
-	cache     map[int64][]byte
-	age       map[int64]int
-	ticker    int
+	mu        sync.Mutex
+	cache     map[int64]*list.Element
+	lru       *list.List // front is the most recently used sector
+	secSize   int64
+	secCount  int
 	pos, size int64
 	f         io.ReaderAt
 }
@@ -47,32 +59,19 @@ func min(a, b int64) int64 {
 }
 
 func (sr *SecReaderT) access(pos int64) (sl []byte, p int) {
-	p = int(pos % _SECTOR_SIZE)
-	pos /= _SECTOR_SIZE
-	if s, ok := sr.cache[pos]; ok {
-		if sr.age[pos] != sr.ticker {
-			sr.ticker++
-			sr.age[pos] = sr.ticker
-		}
-		return s, p
+	p = int(pos % sr.secSize)
+	pos /= sr.secSize
+	if e, ok := sr.cache[pos]; ok {
+		sr.lru.MoveToFront(e)
+		return e.Value.(*sectorT).data, p
 	}
-	if len(sr.cache) >= _SECTOR_COUNT {
-		a := sr.ticker
-		old := int64(0)
-		for k := range sr.age {
-			if sr.age[k] < a {
-				old = k
-				a = sr.age[k]
-			}
-		}
-		delete(sr.cache, old)
-		delete(sr.age, old)
+	if len(sr.cache) >= sr.secCount {
+		old := sr.lru.Remove(sr.lru.Back()).(*sectorT)
+		delete(sr.cache, old.pos)
 	}
-	sr.ticker++
-	sl = make([]byte, min(sr.size-pos*_SECTOR_SIZE, _SECTOR_SIZE))
-	sr.f.ReadAt(sl, pos*_SECTOR_SIZE)
-	sr.cache[pos] = sl
-	sr.age[pos] = sr.ticker
+	sl = make([]byte, min(sr.size-pos*sr.secSize, sr.secSize))
+	sr.f.ReadAt(sl, pos*sr.secSize)
+	sr.cache[pos] = sr.lru.PushFront(&sectorT{pos, sl})
 	return
 }
 
@@ -80,14 +79,19 @@ func (sr *SecReaderT) ReadAt(buf []byte, pos int64) (n int, err error) {
 	if pos >= sr.size {
 		return 0, io.EOF
 	}
+	if int64(len(buf)) > sr.size-pos {
+		buf = buf[0 : sr.size-pos]
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	b, p := sr.access(pos)
-	for ; p < _SECTOR_SIZE && n < len(buf); p++ {
+	for ; p < len(b) && n < len(buf); p++ {
 		buf[n] = b[p]
 		n++
 	}
-	if secs := (len(buf) - n) / _SECTOR_SIZE; secs > 0 {
-		sr.f.ReadAt(buf[n:n+secs*_SECTOR_SIZE], pos+int64(n))
-		n += secs * _SECTOR_SIZE
+	if secs := int64(len(buf)-n) / sr.secSize; secs > 0 {
+		sr.f.ReadAt(buf[n:int64(n)+secs*sr.secSize], pos+int64(n))
+		n += int(secs * sr.secSize)
 	}
 	if len(buf)-n > 0 {
 		b, p = sr.access(pos + int64(n))
@@ -96,9 +100,6 @@ func (sr *SecReaderT) ReadAt(buf []byte, pos int64) (n int, err error) {
 			n++
 		}
 	}
-	if pos+int64(n) >= sr.size {
-		n -= int(pos + int64(n) - sr.size)
-	}
 	return
 }
 
@@ -122,7 +123,9 @@ func (sr *SecReaderT) Seek(off int64, whence int) (ret int64, err error) {
 
 func (sr *SecReaderT) ReadByte() (c byte, err error) {
 	if sr.pos < sr.size {
+		sr.mu.Lock()
 		b, p := sr.access(sr.pos)
+		sr.mu.Unlock()
 		c = b[p]
 		sr.pos++
 	} else {
@@ -151,14 +154,36 @@ func (sr *SecReaderT) ReadBytes(delim byte) ([]byte, error) {
 }
 
 func SecReader(f io.ReaderAt, size int64) Reader {
+	return SecReaderN(f, size, _SECTOR_SIZE, _SECTOR_COUNT)
+}
+
+// SecReaderN() is SecReader() with a cache of secCount sectors of secSize
+// bytes. Values < 1 select the defaults.
+func SecReaderN(f io.ReaderAt, size int64, secSize, secCount int) Reader {
+	if secSize < 1 {
+		secSize = _SECTOR_SIZE
+	}
+	if secCount < 1 {
+		secCount = _SECTOR_COUNT
+	}
 	sr := new(SecReaderT)
 	sr.f = f
 	sr.size = size
-	sr.cache = make(map[int64][]byte)
-	sr.age = make(map[int64]int)
+	sr.secSize = int64(secSize)
+	sr.secCount = secCount
+	sr.cache = make(map[int64]*list.Element)
+	sr.lru = list.New()
 	return sr
 }
 
+// sr.Reset() drops all cached sectors.
+func (sr *SecReaderT) Reset() {
+	sr.mu.Lock()
+	sr.cache = make(map[int64]*list.Element)
+	sr.lru.Init()
+	sr.mu.Unlock()
+}
+
 // ------------------------------------------------------------------
 
 type SliceReaderT struct {
@@ -234,6 +259,85 @@ func SliceReader(bin []byte) Reader {
 
 // ------------------------------------------------------------------
 
+const _CURSOR_SIZE = 512
+
+// CursorT is a private read position on shared data. Only ReadAt() of the
+// underlying data is used, so many cursors can work on the same data
+// concurrently if its ReadAt() allows that.
+type CursorT struct {
+	f         io.ReaderAt
+	pos, size int64
+	buf       []byte // window of data at bpos
+	bpos      int64
+}
+
+func (c *CursorT) ReadAt(b []byte, off int64) (n int, err error) {
+	if off >= c.size {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > c.size-off {
+		b = b[0 : c.size-off]
+	}
+	return c.f.ReadAt(b, off)
+}
+
+func (c *CursorT) Read(b []byte) (n int, err error) {
+	n, err = c.ReadAt(b, c.pos)
+	c.pos += int64(n)
+	return
+}
+
+func (c *CursorT) Seek(off int64, whence int) (ret int64, err error) {
+	ret = c.pos
+	switch whence {
+	case 0:
+		c.pos = 0
+	case 2:
+		c.pos = c.size
+	}
+	c.pos += off
+	return
+}
+
+func (c *CursorT) Size() int64 { return c.size }
+
+func (c *CursorT) ReadByte() (b byte, err error) {
+	if c.pos < 0 || c.pos >= c.size {
+		return 0, io.EOF
+	}
+	if c.pos < c.bpos || c.pos >= c.bpos+int64(len(c.buf)) {
+		if c.buf == nil {
+			c.buf = make([]byte, _CURSOR_SIZE)
+		}
+		c.buf = c.buf[0:min(int64(cap(c.buf)), c.size-c.pos)]
+		c.f.ReadAt(c.buf, c.pos)
+		c.bpos = c.pos
+	}
+	b = c.buf[c.pos-c.bpos]
+	c.pos++
+	return
+}
+
+func (c *CursorT) UnreadByte() error {
+	c.pos--
+	return nil
+}
+
+func (c *CursorT) Slice(n int) []byte {
+	r := make([]byte, n)
+	c.Read(r)
+	return r
+}
+
+func Cursor(f io.ReaderAt, size int64) Reader {
+	c := new(CursorT)
+	c.f = f
+	c.size = size
+	return c
+}
+
+// ------------------------------------------------------------------
+
 func ReadAndClose(f io.ReadCloser, err error) []byte {
 	if err != nil {
 		return []byte{}
@@ -244,6 +348,12 @@ func ReadAndClose(f io.ReadCloser, err error) []byte {
 }
 
 func FileReader(fn string) Reader {
+	return FileReaderN(fn, _SECTOR_SIZE, _SECTOR_COUNT)
+}
+
+// FileReaderN() is FileReader() with a configurable sector cache, see
+// SecReaderN().
+func FileReaderN(fn string, secSize, secCount int) Reader {
 	dir, err := os.Stat(fn)
 	if err != nil {
 		return nil
@@ -252,7 +362,7 @@ func FileReader(fn string) Reader {
 	if err != nil {
 		return nil
 	}
-	return SecReader(fil, int64(dir.Size()))
+	return SecReaderN(fil, int64(dir.Size()), secSize, secCount)
 }
 
 func ReadAll(f io.Reader) []byte {
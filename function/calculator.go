@@ -0,0 +1,293 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package function
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/ps"
+)
+
+// PostScript calculator functions (Type 4). The program is parsed into
+// operations once, procedures of if and ifelse are nested programs.
+
+// limits of the operand stack and of nested procedures.
+const (
+	MAX_STACK = 100
+	MAX_NEST  = 32
+)
+
+type valueT struct {
+	v    float64
+	bool bool // v is 0 or 1
+	int  bool
+}
+
+type stackT []valueT
+
+func (s *stackT) push(v valueT) {
+	if len(*s) >= MAX_STACK {
+		panic("stackoverflow")
+	}
+	*s = append(*s, v)
+}
+
+func (s *stackT) pop() valueT {
+	r := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return r
+}
+
+func (s *stackT) num(v float64) { s.push(valueT{v: v}) }
+func (s *stackT) integer(v int) { s.push(valueT{v: float64(v), int: true}) }
+func (s *stackT) boolean(b bool) {
+	if b {
+		s.push(valueT{v: 1, bool: true})
+	} else {
+		s.push(valueT{bool: true})
+	}
+}
+
+// opT is an operation of a program: a number, an operator or procedures
+// for if (else nil) and ifelse.
+type opT struct {
+	value           *valueT
+	op              string
+	then, otherwise []opT
+}
+
+type calculatorT struct {
+	commonT
+	prg []opT
+}
+
+// parse() parses the contents of a procedure.
+func parse(s []byte, depth int) []opT {
+	if depth > MAX_NEST {
+		panic("nesting")
+	}
+	var r []opT
+	var procs [][]opT
+	rdr := fancy.SliceReader(s)
+	for {
+		t, _ := ps.Token(rdr)
+		if len(t) == 0 {
+			break
+		}
+		switch {
+		case t[0] == '{':
+			procs = append(procs, parse(t[1:len(t)-1], depth+1))
+			continue
+		case string(t) == "if" && len(procs) >= 1:
+			r = append(r, opT{op: "if", then: procs[len(procs)-1]})
+		case string(t) == "ifelse" && len(procs) >= 2:
+			r = append(r, opT{op: "ifelse", then: procs[len(procs)-2], otherwise: procs[len(procs)-1]})
+		case string(t) == "true":
+			r = append(r, opT{value: &valueT{v: 1, bool: true}})
+		case string(t) == "false":
+			r = append(r, opT{value: &valueT{bool: true}})
+		default:
+			if i, err := strconv.Atoi(string(t)); err == nil {
+				r = append(r, opT{value: &valueT{v: float64(i), int: true}})
+			} else if f, err := strconv.ParseFloat(string(t), 64); err == nil {
+				r = append(r, opT{value: &valueT{v: f}})
+			} else {
+				r = append(r, opT{op: string(t)})
+			}
+		}
+		procs = procs[:0]
+	}
+	return r
+}
+
+func readCalculator(prg []byte, c commonT) FunctionT {
+	p := 0
+	for p < len(prg) && prg[p] != '{' {
+		p++
+	}
+	q := len(prg) - 1
+	for q > p && prg[q] != '}' {
+		q--
+	}
+	if q <= p || c.rng == nil {
+		return nil
+	}
+	return &calculatorT{c, parse(prg[p+1:q], 0)}
+}
+
+func (f *calculatorT) Eval(in []float64) (out []float64) {
+	s := stackT{}
+	for _, x := range f.inputs(in) {
+		s.num(x)
+	}
+	out = make([]float64, len(f.rng)/2)
+	defer func() {
+		if recover() != nil { // errors give the minimum of the range
+			for j := range out {
+				out[j] = f.rng[2*j]
+			}
+		}
+	}()
+	run(f.prg, &s)
+	for j := len(out) - 1; j >= 0; j-- {
+		out[j] = s.pop().v
+	}
+	return f.outputs(out)
+}
+
+func truth(v valueT) bool { return v.v != 0 }
+
+func run(prg []opT, s *stackT) {
+	for _, o := range prg {
+		if o.value != nil {
+			s.push(*o.value)
+			continue
+		}
+		if o.op == "if" || o.op == "ifelse" {
+			if truth(s.pop()) {
+				run(o.then, s)
+			} else if o.otherwise != nil {
+				run(o.otherwise, s)
+			}
+			continue
+		}
+		operator(o.op, s)
+	}
+}
+
+func operator(op string, s *stackT) {
+	switch op {
+	case "abs", "neg", "ceiling", "floor", "round", "truncate", "cvi", "cvr":
+		a := s.pop()
+		switch op {
+		case "abs":
+			a.v = math.Abs(a.v)
+		case "neg":
+			a.v = -a.v
+		case "ceiling":
+			a.v = math.Ceil(a.v)
+		case "floor":
+			a.v = math.Floor(a.v)
+		case "round":
+			a.v = math.Floor(a.v + 0.5)
+		case "truncate":
+			a.v = math.Trunc(a.v)
+		case "cvi":
+			a.v, a.int = math.Trunc(a.v), true
+		case "cvr":
+			a.int = false
+		}
+		s.push(a)
+	case "sqrt", "sin", "cos", "ln", "log", "exp", "atan", "div", "mul", "add", "sub":
+		var b valueT
+		if op == "exp" || op == "atan" || op == "div" || op == "mul" || op == "add" || op == "sub" {
+			b = s.pop()
+		}
+		a := s.pop()
+		r := valueT{int: a.int && b.int && (op == "mul" || op == "add" || op == "sub")}
+		switch op {
+		case "sqrt":
+			r.v = math.Sqrt(a.v)
+		case "sin":
+			r.v = math.Sin(a.v * math.Pi / 180)
+		case "cos":
+			r.v = math.Cos(a.v * math.Pi / 180)
+		case "ln":
+			r.v = math.Log(a.v)
+		case "log":
+			r.v = math.Log10(a.v)
+		case "exp":
+			r.v = math.Pow(a.v, b.v)
+		case "atan":
+			if r.v = math.Atan2(a.v, b.v) * 180 / math.Pi; r.v < 0 {
+				r.v += 360
+			}
+		case "div":
+			r.v = a.v / b.v
+		case "mul":
+			r.v = a.v * b.v
+		case "add":
+			r.v = a.v + b.v
+		case "sub":
+			r.v = a.v - b.v
+		}
+		s.push(r)
+	case "idiv", "mod", "bitshift":
+		b, a := int(s.pop().v), int(s.pop().v)
+		switch op {
+		case "idiv":
+			s.integer(a / b)
+		case "mod":
+			s.integer(a % b)
+		case "bitshift":
+			if b >= 0 {
+				s.integer(a << uint(b))
+			} else {
+				s.integer(a >> uint(-b))
+			}
+		}
+	case "and", "or", "xor":
+		b, a := s.pop(), s.pop()
+		if a.bool {
+			x, y := truth(a), truth(b)
+			s.boolean(op == "and" && x && y || op == "or" && (x || y) || op == "xor" && x != y)
+			break
+		}
+		x, y := int(a.v), int(b.v)
+		switch op {
+		case "and":
+			s.integer(x & y)
+		case "or":
+			s.integer(x | y)
+		case "xor":
+			s.integer(x ^ y)
+		}
+	case "not":
+		if a := s.pop(); a.bool {
+			s.boolean(!truth(a))
+		} else {
+			s.integer(^int(a.v))
+		}
+	case "eq", "ne", "gt", "ge", "lt", "le":
+		b, a := s.pop().v, s.pop().v
+		s.boolean(op == "eq" && a == b || op == "ne" && a != b || op == "gt" && a > b ||
+			op == "ge" && a >= b || op == "lt" && a < b || op == "le" && a <= b)
+	case "pop":
+		s.pop()
+	case "exch":
+		b, a := s.pop(), s.pop()
+		s.push(b)
+		s.push(a)
+	case "dup":
+		a := s.pop()
+		s.push(a)
+		s.push(a)
+	case "copy":
+		n := int(s.pop().v)
+		top := len(*s)
+		for k := top - n; k < top; k++ {
+			s.push((*s)[k])
+		}
+	case "index":
+		n := int(s.pop().v)
+		s.push((*s)[len(*s)-1-n])
+	case "roll":
+		j, n := int(s.pop().v), int(s.pop().v)
+		if n <= 0 {
+			break
+		}
+		part := (*s)[len(*s)-n:]
+		j = ((j % n) + n) % n
+		rolled := append(append(stackT{}, part[n-j:]...), part[:n-j]...)
+		copy(part, rolled)
+	default:
+		panic("unknown operator " + op)
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// PDF functions: sampled (Type 0), exponential (Type 2), stitching (Type 3)
+// and PostScript calculator (Type 4).
+package function
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/limits"
+)
+
+// stitching functions are nested.
+const MAX_DEPTH = 8
+
+// sampled functions interpolate between 2^inputs samples.
+const MAX_INPUTS = 16
+
+type FunctionT interface {
+	Eval(in []float64) []float64
+}
+
+// commonT are the entries all types have.
+type commonT struct {
+	domain []float64
+	rng    []float64 // nil if not given
+}
+
+func numbers(pd *pdfreader.PDFReader, o []byte) []float64 {
+	a := pd.Arr(o)
+	r := make([]float64, len(a))
+	for k := range a {
+		r[k], _ = strconv.ParseFloat(string(pd.Obj(a[k])), 64)
+	}
+	return r
+}
+
+func number(pd *pdfreader.PDFReader, o []byte, def float64) float64 {
+	if v, err := strconv.ParseFloat(string(pd.Obj(o)), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+func clip(v, lo, hi float64) float64 {
+	return min(hi, max(lo, v))
+}
+
+// interpolate() maps x of [x0,x1] to [y0,y1].
+func interpolate(x, x0, x1, y0, y1 float64) float64 {
+	if x1 == x0 {
+		return y0
+	}
+	return y0 + (x-x0)*(y1-y0)/(x1-x0)
+}
+
+// c.inputs() clips the inputs to the domain.
+func (c *commonT) inputs(in []float64) []float64 {
+	r := make([]float64, len(c.domain)/2)
+	for k := range r {
+		if k < len(in) {
+			r[k] = clip(in[k], c.domain[2*k], c.domain[2*k+1])
+		} else {
+			r[k] = c.domain[2*k]
+		}
+	}
+	return r
+}
+
+// c.outputs() clips the outputs to the range.
+func (c *commonT) outputs(out []float64) []float64 {
+	for k := 0; 2*k+1 < len(c.rng) && k < len(out); k++ {
+		out[k] = clip(out[k], c.rng[2*k], c.rng[2*k+1])
+	}
+	return out
+}
+
+type sampledT struct {
+	commonT
+	size    []int
+	bps     int
+	encode  []float64
+	decode  []float64
+	samples []byte
+	nout    int
+}
+
+type exponentialT struct {
+	commonT
+	c0, c1 []float64
+	n      float64
+}
+
+type stitchingT struct {
+	commonT
+	functions []FunctionT
+	bounds    []float64
+	encode    []float64
+}
+
+// arrayT are the outputs of several functions, as used for shadings.
+type arrayT []FunctionT
+
+// Read() reads a function or an array of functions, nil if it is none or
+// it is broken.
+func Read(pd *pdfreader.PDFReader, o []byte) FunctionT {
+	return read(pd, o, 0)
+}
+
+func read(pd *pdfreader.PDFReader, o []byte, depth int) (r FunctionT) {
+	if depth > MAX_DEPTH {
+		return nil
+	}
+	defer limits.Recover(func(interface{}) { r = nil })
+	if v := pd.Obj(o); len(v) > 0 && v[0] == '[' {
+		var a arrayT
+		for _, f := range pd.Arr(v) {
+			if g := read(pd, f, depth+1); g != nil {
+				a = append(a, g)
+			} else {
+				return nil
+			}
+		}
+		return a
+	}
+	d := pd.Dic(o)
+	c := commonT{numbers(pd, d["/Domain"]), nil}
+	if len(c.domain) < 2 {
+		return nil
+	}
+	if rg := numbers(pd, d["/Range"]); len(rg) >= 2 {
+		c.rng = rg
+	}
+	switch int(number(pd, d["/FunctionType"], -1)) {
+	case 0:
+		return readSampled(pd, o, c)
+	case 2:
+		f := &exponentialT{commonT: c, c0: []float64{0}, c1: []float64{1}}
+		if v := numbers(pd, d["/C0"]); len(v) > 0 {
+			f.c0 = v
+		}
+		if v := numbers(pd, d["/C1"]); len(v) > 0 {
+			f.c1 = v
+		}
+		f.n = number(pd, d["/N"], 1)
+		return f
+	case 3:
+		f := &stitchingT{commonT: c}
+		for _, g := range pd.Arr(d["/Functions"]) {
+			h := read(pd, g, depth+1)
+			if h == nil {
+				return nil
+			}
+			f.functions = append(f.functions, h)
+		}
+		f.bounds = numbers(pd, d["/Bounds"])
+		f.encode = numbers(pd, d["/Encode"])
+		if len(f.functions) == 0 || len(f.bounds) != len(f.functions)-1 ||
+			len(f.encode) != 2*len(f.functions) {
+			return nil
+		}
+		return f
+	case 4:
+		_, prg := pd.DecodedStream(o)
+		return readCalculator(prg, c)
+	}
+	return nil
+}
+
+func readSampled(pd *pdfreader.PDFReader, o []byte, c commonT) FunctionT {
+	d, samples := pd.DecodedStream(o)
+	f := &sampledT{commonT: c, samples: samples}
+	m := len(c.domain) / 2
+	for _, s := range numbers(pd, d["/Size"]) {
+		f.size = append(f.size, int(s))
+	}
+	f.bps = int(number(pd, d["/BitsPerSample"], 8))
+	f.nout = len(c.rng) / 2
+	if m > MAX_INPUTS || len(f.size) != m || f.nout == 0 || f.bps <= 0 || f.bps > 32 {
+		return nil
+	}
+	if f.encode = numbers(pd, d["/Encode"]); len(f.encode) != 2*m {
+		f.encode = make([]float64, 2*m)
+		for k := range f.size {
+			f.encode[2*k+1] = float64(f.size[k] - 1)
+		}
+	}
+	if f.decode = numbers(pd, d["/Decode"]); len(f.decode) != 2*f.nout {
+		f.decode = c.rng
+	}
+	n, bits := f.nout*f.bps, 8*len(samples)
+	for _, s := range f.size {
+		if s <= 0 || n > bits/s {
+			return nil
+		}
+		n *= s
+	}
+	if n > bits {
+		return nil
+	}
+	return f
+}
+
+// f.sample() returns a sample value 0..1 at a sample index, 0 if there
+// is no such sample.
+func (f *sampledT) sample(p int) float64 {
+	if p < 0 || p >= 8*len(f.samples)/f.bps {
+		return 0
+	}
+	bit := p * f.bps
+	v := uint64(0)
+	for b := 0; b < f.bps; {
+		byt := f.samples[(bit+b)/8]
+		off := (bit + b) % 8
+		take := min(8-off, f.bps-b)
+		v = v<<take | uint64(byt>>(8-off-take))&(1<<take-1)
+		b += take
+	}
+	return float64(v) / float64(uint64(1)<<f.bps-1)
+}
+
+// f.Eval() interpolates the samples multilinear, also for /Order 3.
+func (f *sampledT) Eval(in []float64) (out []float64) {
+	x := f.inputs(in)
+	m := len(x)
+	lo := make([]int, m)
+	frac := make([]float64, m)
+	out = make([]float64, f.nout)
+	defer func() {
+		if recover() != nil { // errors give the minimum of the range
+			for j := range out {
+				out[j] = f.rng[2*j]
+			}
+		}
+	}()
+	for k := range x {
+		e := interpolate(x[k], f.domain[2*k], f.domain[2*k+1], f.encode[2*k], f.encode[2*k+1])
+		e = clip(e, 0, float64(f.size[k]-1))
+		lo[k] = min(int(e), max(0, f.size[k]-2))
+		frac[k] = e - float64(lo[k])
+	}
+	for corner := 0; corner < 1<<m; corner++ {
+		w, p, stride := 1.0, 0, 1
+		for k := 0; k < m; k++ {
+			i := lo[k]
+			if corner>>k&1 == 1 {
+				w *= frac[k]
+				i = min(i+1, f.size[k]-1)
+			} else {
+				w *= 1 - frac[k]
+			}
+			p += i * stride
+			stride *= f.size[k]
+		}
+		if w == 0 {
+			continue
+		}
+		for j := range out {
+			out[j] += w * f.sample(p*f.nout+j)
+		}
+	}
+	for j := range out {
+		out[j] = interpolate(out[j], 0, 1, f.decode[2*j], f.decode[2*j+1])
+	}
+	return f.outputs(out)
+}
+
+func (f *exponentialT) Eval(in []float64) []float64 {
+	x := math.Pow(f.inputs(in)[0], f.n)
+	out := make([]float64, min(len(f.c0), len(f.c1)))
+	for j := range out {
+		out[j] = f.c0[j] + x*(f.c1[j]-f.c0[j])
+	}
+	return f.outputs(out)
+}
+
+func (f *stitchingT) Eval(in []float64) []float64 {
+	x := f.inputs(in)[0]
+	k := 0
+	for k < len(f.bounds) && x >= f.bounds[k] {
+		k++
+	}
+	lo, hi := f.domain[0], f.domain[1]
+	if k > 0 {
+		lo = f.bounds[k-1]
+	}
+	if k < len(f.bounds) {
+		hi = f.bounds[k]
+	}
+	return f.outputs(f.functions[k].Eval([]float64{
+		interpolate(x, lo, hi, f.encode[2*k], f.encode[2*k+1])}))
+}
+
+func (a arrayT) Eval(in []float64) []float64 {
+	var r []float64
+	for _, f := range a {
+		r = append(r, f.Eval(in)...)
+	}
+	return r
+}
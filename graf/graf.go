@@ -8,7 +8,12 @@
 package graf
 
 import (
+	"context"
+	"strconv"
+	"strings"
+
 	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/limits"
 	"github.com/grokify/pdfreader/ps"
 	"github.com/grokify/pdfreader/stacks"
 	"github.com/grokify/pdfreader/strm"
@@ -19,14 +24,117 @@ type DrawerColor interface {
 	RGB(rgb [][]byte) string
 	CMYK(cmyk [][]byte) string
 	Gray(g []byte) string
+	// Device() gets a color resolved to "/DeviceGray", "/DeviceRGB" or
+	// "/DeviceCMYK" with components 0..1.
+	Device(space string, c []float64) string
+}
+
+// ColorSpace is a color space selected by CS or cs.
+type ColorSpace interface {
+	NComps() int        // number of components of a color
+	Initial() []float64 // the color after CS or cs
+	// Device() resolves a color to a device color space, "" if it has
+	// none like patterns.
+	Device(c []float64) (string, []float64)
+}
+
+// ColorSpaces resolves the names of CS and cs, usually by /ColorSpace
+// resources.
+type ColorSpaces interface {
+	ColorSpace(name []byte) ColorSpace
+}
+
+// GStates resolves the names of gs, usually by /ExtGState resources. The
+// entries known are given as operands of the operators they stand for,
+// like 2 of /LW for w or [3 2] 0 of /D for d.
+type GStates interface {
+	GState(name []byte) map[string][][]byte
+}
+
+// XObjects paints the external objects of Do and the soft masks of gs,
+// usually by /XObject resources.
+type XObjects interface {
+	Do(name []byte)
+	// SoftMask() applies an /SMask entry of a graphics state up to the
+	// matching Q, o is the mask dictionary or /None.
+	SoftMask(o []byte)
+}
+
+// OptionalContent tells if optional content is visible, usually by
+// /Properties resources and the /OCProperties of the document.
+type OptionalContent interface {
+	// Visible() gets the properties of BDC /OC or the /OC entry of a form,
+	// a name of a /Properties resource or an optional content group or
+	// membership dictionary.
+	Visible(o []byte) bool
+}
+
+// the operators of the entries of graphics state parameter dictionaries.
+var gstateOps = map[string]string{"/LW": "w", "/LC": "J", "/LJ": "j", "/ML": "M", "/D": "d", "/FL": "i"}
+
+// Paints resolves the names of patterns (SCN, scn) and shadings (sh),
+// usually by /Pattern and /Shading resources.
+type Paints interface {
+	// Pattern() returns a paint like the colors of DrawerConfigT, "" if
+	// the pattern is unknown. Uncolored patterns are painted in c of the
+	// underlying space of the pattern space sp. ctm is the transformation
+	// since the start of the drawing.
+	Pattern(name []byte, sp ColorSpace, c []float64, ctm [6]float64) string
+	// Shade() paints a shading into the current clip.
+	Shade(name []byte)
+}
+
+// deviceSpaceT are the device color spaces known without resources.
+type deviceSpaceT struct {
+	family string
+	n      int
+}
+
+func (d deviceSpaceT) NComps() int { return d.n }
+func (d deviceSpaceT) Initial() []float64 {
+	if d.n == 4 {
+		return []float64{0, 0, 0, 1}
+	}
+	return make([]float64, d.n)
+}
+func (d deviceSpaceT) Device(c []float64) (string, []float64) {
+	r := make([]float64, d.n)
+	for k := range r {
+		if k < len(c) {
+			r[k] = min(1, max(0, c[k]))
+		}
+	}
+	return d.family, r
+}
+
+var (
+	DeviceGray ColorSpace = deviceSpaceT{"/DeviceGray", 1}
+	DeviceRGB  ColorSpace = deviceSpaceT{"/DeviceRGB", 3}
+	DeviceCMYK ColorSpace = deviceSpaceT{"/DeviceCMYK", 4}
+)
+
+// DeviceSpace() returns a device color space by name, also the
+// abbreviations of inline images. nil for other names.
+func DeviceSpace(name string) ColorSpace {
+	switch name {
+	case "/DeviceGray", "/G":
+		return DeviceGray
+	case "/DeviceRGB", "/RGB":
+		return DeviceRGB
+	case "/DeviceCMYK", "/CMYK":
+		return DeviceCMYK
+	}
+	return nil
 }
 
 type Drawer interface {
+	Clip()
 	CloseDrawing()
 	ClosePath()
 	Concat(s [][]byte)
 	CurveTo(s [][]byte)
 	DropPath()
+	EOClip()
 	EOFill()
 	EOFillAndStroke()
 	Fill()
@@ -34,6 +142,8 @@ type Drawer interface {
 	LineTo(s [][]byte)
 	MoveTo(s [][]byte)
 	Rectangle(s [][]byte)
+	Restore()
+	Save()
 	SetIdentity()
 	Stroke()
 }
@@ -41,7 +151,13 @@ type Drawer interface {
 type DrawerConfig interface {
 	SetCMYKFill(s [][]byte)
 	SetCMYKStroke(s [][]byte)
+	SetBlendMode(a []byte)
 	SetColors(DrawerColor)
+	SetDash(s [][]byte)
+	SetFillAlpha(a []byte)
+	SetFillColor(c []float64)
+	SetFillPaint(p string)
+	SetFillSpace(cs ColorSpace)
 	SetFlat(a []byte)
 	SetGrayFill(a []byte)
 	SetGrayStroke(a []byte)
@@ -51,6 +167,10 @@ type DrawerConfig interface {
 	SetMiterLimit(a []byte)
 	SetRGBFill(s [][]byte)
 	SetRGBStroke(s [][]byte)
+	SetStrokeAlpha(a []byte)
+	SetStrokeColor(c []float64)
+	SetStrokePaint(p string)
+	SetStrokeSpace(cs ColorSpace)
 }
 
 type DrawerConfigT struct {
@@ -61,6 +181,13 @@ type DrawerConfigT struct {
 	LineJoin    string
 	MiterLimit  string
 	Flat        string
+	DashArray   string // lengths separated by blanks, "" is solid
+	DashPhase   string
+	FillAlpha   string     // constant alpha of /ca, "" is opaque
+	StrokeAlpha string     // of /CA
+	BlendMode   string     // like /Multiply, "" is /Normal
+	FillSpace   ColorSpace // nil is DeviceGray
+	StrokeSpace ColorSpace
 	color       DrawerColor
 }
 
@@ -80,6 +207,27 @@ func (t *DrawerConfigT) SetFlat(a []byte) {
 	t.Flat = string(a)
 }
 
+func (t *DrawerConfigT) SetFillAlpha(a []byte) {
+	t.FillAlpha = string(a)
+}
+func (t *DrawerConfigT) SetStrokeAlpha(a []byte) {
+	t.StrokeAlpha = string(a)
+}
+
+// t.SetBlendMode() takes a blend mode or an array of them, of which the
+// first is used.
+func (t *DrawerConfigT) SetBlendMode(a []byte) {
+	if f := strings.Fields(strings.Trim(string(a), "[]")); len(f) > 0 {
+		t.BlendMode = f[0]
+	}
+}
+
+// t.SetDash() takes the operands of d, an array and a phase.
+func (t *DrawerConfigT) SetDash(s [][]byte) {
+	t.DashArray = strings.Join(strings.Fields(strings.Trim(string(s[0]), "[]")), " ")
+	t.DashPhase = string(s[1])
+}
+
 type TextConfig interface {
 	SetCharSpace(a []byte)
 	SetFontAndSize(s [][]byte)
@@ -127,7 +275,30 @@ type DrawerText interface {
 	TShow(a []byte)
 }
 
+// DocumentMarker observes marked content. properties are the operand of
+// BDC and DP, a dictionary or the name of a /Properties resource.
 type DocumentMarker interface {
+	BeginMarked(tag, properties []byte) // BDC, BMC with nil properties
+	EndMarked()                         // EMC
+	MarkPoint(tag, properties []byte)   // DP, MP with nil properties
+}
+
+// DrawerImage is implemented by drawers which can show inline images, the
+// keys of dic are the ones of the BI operator, data is not yet decoded.
+type DrawerImage interface {
+	InlineImage(dic map[string][]byte, data []byte)
+}
+
+// TextMover is implemented by text drawers which move over the strings of
+// hidden optional content like TShow() without showing them.
+type TextMover interface {
+	TMove(a []byte)
+}
+
+// TextClipper is implemented by text drawers which clip by the glyphs of
+// the clip text render modes, ET ends the text object and its clip.
+type TextClipper interface {
+	EndText()
 }
 
 type PdfDrawerT struct {
@@ -141,7 +312,41 @@ type PdfDrawerT struct {
 	Config       DrawerConfig
 	TConf        TextConfig
 	Text         DrawerText
-	Marker       DocumentMarker
+	Marker       DocumentMarker // nil ignores marked content
+	Limits       limits.Limits
+	Spaces       ColorSpaces     // nil knows the device color spaces only
+	GStates      GStates         // nil ignores gs
+	XObjects     XObjects        // nil ignores Do and soft masks
+	Paints       Paints          // nil ignores patterns and shadings
+	Optional     OptionalContent // nil shows all content
+	rdr          fancy.Reader    // the content stream while interpreting
+	inline       int             // stack depth at BI
+	saved        []gstateT       // by q
+	ctm          [6]float64      // by cm, for patterns
+	marked       []bool          // by BDC and BMC, if they hide content
+	hidden       int             // the ones hiding of marked
+	ctx          context.Context // of the drawing while interpreting
+	ops          *int            // operators of the drawing so far
+	outer        *PdfDrawerT     // the drawer pd draws a part for, see Nest()
+}
+
+// the parts of the graphics state kept by the drawer, the drawing itself
+// keeps transformation and clip.
+type gstateT struct {
+	config DrawerConfigT
+	tconf  TextConfigT
+	ctm    [6]float64
+}
+
+var identity = [6]float64{1, 0, 0, 1, 0, 0}
+
+// Concat() returns the transformation m followed by n.
+func Concat(m, n [6]float64) [6]float64 {
+	return [6]float64{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
 }
 
 var PdfOps = map[string]func(pd *PdfDrawerT){
@@ -186,6 +391,11 @@ var PdfOps = map[string]func(pd *PdfDrawerT){
 	},
 	"cm": func(pd *PdfDrawerT) {
 		a := pd.Stack.Drop(6)
+		var m [6]float64
+		for k := range m {
+			m[k], _ = strconv.ParseFloat(string(a[k]), 64)
+		}
+		pd.ctm = Concat(m, pd.ctm)
 		pd.Draw.Concat(a)
 		pd.CurrentPoint = a[4:6]
 	},
@@ -239,9 +449,60 @@ var PdfOps = map[string]func(pd *PdfDrawerT){
 		pd.Draw.CurveTo([][]byte{a[0], a[1], a[2], a[3], a[2], a[3]})
 		pd.CurrentPoint = a[2:4]
 	},
+	"CS": func(pd *PdfDrawerT) {
+		pd.Config.SetStrokeSpace(pd.colorSpace(pd.Stack.Pop()))
+	},
+	"SC": func(pd *PdfDrawerT) {
+		_, c := pd.colorOperands()
+		pd.Config.SetStrokeColor(c)
+	},
+	"SCN": func(pd *PdfDrawerT) {
+		if name, c := pd.colorOperands(); name != nil {
+			pd.Config.SetStrokePaint(pd.pattern(name, pd.ConfigD.StrokeSpace, c))
+		} else {
+			pd.Config.SetStrokeColor(c)
+		}
+	},
+	"cs": func(pd *PdfDrawerT) {
+		pd.Config.SetFillSpace(pd.colorSpace(pd.Stack.Pop()))
+	},
+	"sc": func(pd *PdfDrawerT) {
+		_, c := pd.colorOperands()
+		pd.Config.SetFillColor(c)
+	},
+	"scn": func(pd *PdfDrawerT) {
+		if name, c := pd.colorOperands(); name != nil {
+			pd.Config.SetFillPaint(pd.pattern(name, pd.ConfigD.FillSpace, c))
+		} else {
+			pd.Config.SetFillColor(c)
+		}
+	},
+	"sh": func(pd *PdfDrawerT) {
+		if name := pd.Stack.Pop(); pd.Paints != nil {
+			pd.Paints.Shade(name)
+		}
+	},
+	"W": func(pd *PdfDrawerT) {
+		pd.Draw.Clip()
+	},
+	"W*": func(pd *PdfDrawerT) {
+		pd.Draw.EOClip()
+	},
+	"q": func(pd *PdfDrawerT) {
+		pd.saved = append(pd.saved, gstateT{*pd.ConfigD, *pd.TConfD, pd.ctm})
+		pd.Draw.Save()
+	},
+	"Q": func(pd *PdfDrawerT) {
+		if len(pd.saved) == 0 {
+			return
+		}
+		g := pd.saved[len(pd.saved)-1]
+		pd.saved = pd.saved[:len(pd.saved)-1]
+		*pd.ConfigD, *pd.TConfD, pd.ctm = g.config, g.tconf, g.ctm
+		pd.Draw.Restore()
+	},
 	"G": func(pd *PdfDrawerT) {
 		pd.Config.SetGrayStroke(pd.Stack.Pop())
-		pd.Ops["SC"] = pd.Ops["G"]
 	},
 	"J": func(pd *PdfDrawerT) {
 		pd.Config.SetLineCap(pd.Stack.Pop())
@@ -249,7 +510,6 @@ var PdfOps = map[string]func(pd *PdfDrawerT){
 	"K": func(pd *PdfDrawerT) {
 		a := pd.Stack.Drop(4)
 		pd.Config.SetCMYKStroke(a)
-		pd.Ops["SC"] = pd.Ops["K"]
 	},
 	"M": func(pd *PdfDrawerT) {
 		pd.Config.SetMiterLimit(pd.Stack.Pop())
@@ -257,16 +517,41 @@ var PdfOps = map[string]func(pd *PdfDrawerT){
 	"RG": func(pd *PdfDrawerT) {
 		a := pd.Stack.Drop(3)
 		pd.Config.SetRGBStroke(a)
-		pd.Ops["SC"] = pd.Ops["RG"]
 	},
 	"g": func(pd *PdfDrawerT) {
 		pd.Config.SetGrayFill(pd.Stack.Pop())
-		pd.Ops["sc"] = pd.Ops["g"]
 	},
 	"gs": func(pd *PdfDrawerT) {
-		// FIXME!
-		pd.Draw.SetIdentity()
-		pd.Stack.Pop()
+		name := pd.Stack.Pop()
+		if pd.GStates == nil {
+			return
+		}
+		g := pd.GStates.GState(name)
+		for key, op := range gstateOps {
+			if a, ok := g[key]; ok {
+				for _, o := range a {
+					pd.Stack.Push(o)
+				}
+				pd.Ops[op](pd)
+			}
+		}
+		if a, ok := g["/ca"]; ok {
+			pd.Config.SetFillAlpha(a[0])
+		}
+		if a, ok := g["/CA"]; ok {
+			pd.Config.SetStrokeAlpha(a[0])
+		}
+		if a, ok := g["/BM"]; ok {
+			pd.Config.SetBlendMode(a[0])
+		}
+		if a, ok := g["/SMask"]; ok && pd.XObjects != nil {
+			pd.XObjects.SoftMask(a[0])
+		}
+	},
+	"Do": func(pd *PdfDrawerT) {
+		if name := pd.Stack.Pop(); pd.XObjects != nil {
+			pd.XObjects.Do(name)
+		}
 	},
 	"i": func(pd *PdfDrawerT) {
 		pd.Config.SetFlat(pd.Stack.Pop())
@@ -277,16 +562,17 @@ var PdfOps = map[string]func(pd *PdfDrawerT){
 	"k": func(pd *PdfDrawerT) {
 		a := pd.Stack.Drop(4)
 		pd.Config.SetCMYKFill(a)
-		pd.Ops["sc"] = pd.Ops["k"]
 	},
 	"rg": func(pd *PdfDrawerT) {
 		a := pd.Stack.Drop(3)
 		pd.Config.SetRGBFill(a)
-		pd.Ops["sc"] = pd.Ops["rg"]
 	},
 	"w": func(pd *PdfDrawerT) {
 		pd.Config.SetLineWidth(pd.Stack.Pop())
 	},
+	"d": func(pd *PdfDrawerT) {
+		pd.Config.SetDash(pd.Stack.Drop(2))
+	},
 	"TL": func(pd *PdfDrawerT) {
 		pd.TConf.SetLeading(pd.Stack.Pop())
 	},
@@ -317,6 +603,9 @@ var PdfOps = map[string]func(pd *PdfDrawerT){
 		pd.Text.TSetMatrix(nil)
 	},
 	"ET": func(pd *PdfDrawerT) {
+		if c, ok := pd.Text.(TextClipper); ok {
+			c.EndText()
+		}
 	},
 	"T*": func(pd *PdfDrawerT) {
 		pd.Text.TNextLine()
@@ -345,31 +634,303 @@ var PdfOps = map[string]func(pd *PdfDrawerT){
 		pd.TConf.SetWordSpace(t[0])
 		pd.TConf.SetCharSpace(t[1])
 		pd.Text.TNextLine()
-		pd.Text.TShow(t[3])
+		pd.Text.TShow(t[2])
 	},
-	"BDC": func(pd *PdfDrawerT) {
+	"d0": func(pd *PdfDrawerT) {
 		pd.Stack.Drop(2)
 	},
+	"d1": func(pd *PdfDrawerT) {
+		pd.Stack.Drop(6)
+		// a shape glyph of a Type 3 font, its color is the one of the text.
+		pd.IgnoreColors()
+	},
+	"BI": func(pd *PdfDrawerT) {
+		pd.inline = pd.Stack.Depth()
+	},
+	"ID": func(pd *PdfDrawerT) {
+		a := pd.Stack.Drop(pd.Stack.Depth() - pd.inline)
+		dic := make(map[string][]byte)
+		for k := 0; k+1 < len(a); k += 2 {
+			dic[string(a[k])] = a[k+1]
+		}
+		data := inlineData(pd.rdr, dic)
+		if im, ok := pd.Draw.(DrawerImage); ok && pd.hidden == 0 {
+			im.InlineImage(dic, data)
+		}
+	},
+	"EI": func(pd *PdfDrawerT) {
+	},
+	"BDC": func(pd *PdfDrawerT) {
+		a := pd.Stack.Drop(2)
+		pd.mark(string(a[0]) == "/OC" && pd.Optional != nil && !pd.Optional.Visible(a[1]))
+		if pd.Marker != nil {
+			pd.Marker.BeginMarked(a[0], a[1])
+		}
+	},
 	"BMC": func(pd *PdfDrawerT) {
-		pd.Stack.Pop()
+		tag := pd.Stack.Pop()
+		pd.mark(false)
+		if pd.Marker != nil {
+			pd.Marker.BeginMarked(tag, nil)
+		}
 	},
 	"DP": func(pd *PdfDrawerT) {
-		pd.Stack.Drop(2)
+		a := pd.Stack.Drop(2)
+		if pd.Marker != nil {
+			pd.Marker.MarkPoint(a[0], a[1])
+		}
 	},
 	"EMC": func(pd *PdfDrawerT) {
+		n := len(pd.marked)
+		if n == 0 {
+			return
+		}
+		if pd.marked[n-1] {
+			pd.hidden--
+		}
+		pd.marked = pd.marked[:n-1]
+		if pd.Marker != nil {
+			pd.Marker.EndMarked()
+		}
 	},
 	"MP": func(pd *PdfDrawerT) {
-		pd.Stack.Pop()
+		tag := pd.Stack.Pop()
+		if pd.Marker != nil {
+			pd.Marker.MarkPoint(tag, nil)
+		}
+	},
+}
+
+// pd.mark() begins marked content, hidden optional content if hide.
+func (pd *PdfDrawerT) mark(hide bool) {
+	pd.marked = append(pd.marked, hide)
+	if hide {
+		pd.hidden++
+	}
+}
+
+func endPath(pd *PdfDrawerT) {
+	pd.Draw.DropPath()
+	pd.CurrentPoint = nil
+}
+
+func dropOperand(pd *PdfDrawerT) {
+	pd.Stack.Pop()
+}
+
+// moveText() moves over a hidden string of Tj or TJ.
+func moveText(pd *PdfDrawerT, a []byte) {
+	if m, ok := pd.Text.(TextMover); ok {
+		m.TMove(a)
+	}
+}
+
+// the operators painting, replaced by these in hidden optional content.
+// Their effects on the graphics state like the clip of W f remain, hidden
+// strings move the text position if the text drawer is a TextMover.
+var hiddenOps = map[string]func(pd *PdfDrawerT){
+	"S": endPath, "s": endPath, "f": endPath, "F": endPath, "f*": endPath,
+	"B": endPath, "B*": endPath, "b": endPath, "b*": endPath,
+	"sh": dropOperand, "Do": dropOperand,
+	"Tj": func(pd *PdfDrawerT) {
+		moveText(pd, pd.Stack.Pop())
+	},
+	"TJ": func(pd *PdfDrawerT) {
+		moveText(pd, pd.Stack.Pop())
+	},
+	"'": func(pd *PdfDrawerT) {
+		a := pd.Stack.Pop()
+		pd.Text.TNextLine()
+		moveText(pd, a)
 	},
+	"\"": func(pd *PdfDrawerT) {
+		t := pd.Stack.Drop(3)
+		pd.TConf.SetWordSpace(t[0])
+		pd.TConf.SetCharSpace(t[1])
+		pd.Text.TNextLine()
+		moveText(pd, t[2])
+	},
+}
+
+// operand counts of the operators setting colors, -1 for all operands.
+var colorOps = map[string]int{"G": 1, "g": 1, "RG": 3, "rg": 3, "K": 4, "k": 4,
+	"CS": 1, "cs": 1, "SC": -1, "SCN": -1, "sc": -1, "scn": -1}
+
+// pd.IgnoreColors() makes the operators setting colors drop their
+// operands, for drawings painted in a color given from outside like shape
+// glyphs and uncolored patterns.
+func (pd *PdfDrawerT) IgnoreColors() {
+	for op, n := range colorOps {
+		n := n
+		pd.Ops[op] = func(pd *PdfDrawerT) {
+			if n < 0 {
+				pd.Stack.Drop(pd.Stack.Depth())
+			} else {
+				pd.Stack.Drop(n)
+			}
+		}
+	}
+}
+
+// pd.colorSpace() resolves the operand of CS or cs, unknown spaces give
+// DeviceGray.
+func (pd *PdfDrawerT) colorSpace(name []byte) ColorSpace {
+	if r := DeviceSpace(string(name)); r != nil {
+		return r
+	}
+	if pd.Spaces != nil {
+		if r := pd.Spaces.ColorSpace(name); r != nil {
+			return r
+		}
+	}
+	return DeviceGray
+}
+
+// pd.colorOperands() takes the operands of SC, SCN, sc or scn, name is the
+// one of a pattern or nil.
+func (pd *PdfDrawerT) colorOperands() (name []byte, c []float64) {
+	a := pd.Stack.Drop(pd.Stack.Depth())
+	c = make([]float64, 0, len(a))
+	for _, o := range a {
+		if v, err := strconv.ParseFloat(string(o), 64); err == nil {
+			c = append(c, v)
+		} else if len(o) > 0 && o[0] == '/' {
+			name = o
+		}
+	}
+	return
 }
 
+// pd.CTM() returns the transformation since the start of the drawing.
+func (pd *PdfDrawerT) CTM() [6]float64 { return pd.ctm }
+
+// pd.pattern() resolves a pattern of SCN or scn to a paint, "" if there
+// are no pd.Paints or it is unknown.
+func (pd *PdfDrawerT) pattern(name []byte, sp ColorSpace, c []float64) string {
+	if pd.Paints == nil {
+		return ""
+	}
+	return pd.Paints.Pattern(name, sp, c, pd.ctm)
+}
+
+// inlineEntry() returns the value of an entry of an inline image
+// dictionary by its full or abbreviated key.
+func inlineEntry(dic map[string][]byte, key, abbr string) []byte {
+	if v, ok := dic[key]; ok {
+		return v
+	}
+	return dic[abbr]
+}
+
+func white(c byte) bool {
+	return c == 32 || c == 10 || c == 13 || c == 9 || c == 12 || c == 0
+}
+
+// inlineData() reads the data of an inline image up to and including the
+// EI operator.
+func inlineData(rdr fancy.Reader, dic map[string][]byte) []byte {
+	rdr.ReadByte() // the white space after ID
+	p, _ := rdr.Seek(0, 1)
+	n := int64(0)
+	if inlineEntry(dic, "/Filter", "/F") == nil {
+		w := int64(strm.Int(string(inlineEntry(dic, "/Width", "/W")), 1))
+		h := int64(strm.Int(string(inlineEntry(dic, "/Height", "/H")), 1))
+		bpc := int64(strm.Int(string(inlineEntry(dic, "/BitsPerComponent", "/BPC")), 1))
+		colors := int64(1)
+		switch string(inlineEntry(dic, "/ColorSpace", "/CS")) {
+		case "/DeviceRGB", "/RGB":
+			colors = 3
+		case "/DeviceCMYK", "/CMYK":
+			colors = 4
+		}
+		if m := string(inlineEntry(dic, "/ImageMask", "/IM")); m == "true" {
+			bpc, colors = 1, 1
+		}
+		// sizes not fitting into the rest of the stream are broken, EI
+		// is searched from the start of the data then.
+		rest := rdr.Size() - p
+		if w > 0 && h > 0 && bpc > 0 && bpc <= 16 && w <= rest*8 && h <= rest {
+			if row := (w*colors*bpc + 7) / 8; row <= rest/h {
+				n = row * h
+			}
+		}
+	}
+	rdr.Seek(p+n, 0)
+	for q := p + n; q+2 <= rdr.Size(); q++ {
+		var b [4]byte
+		l, _ := rdr.ReadAt(b[:], q-1)
+		if string(b[1:3]) == "EI" && white(b[0]) && (l < 4 || white(b[3])) {
+			end := max(p, q-1)
+			if n > 0 {
+				end = p + n
+			}
+			data := make([]byte, end-p)
+			rdr.ReadAt(data, p)
+			rdr.Seek(q+2, 0)
+			return data
+		}
+	}
+	rdr.Seek(0, 2)
+	return nil
+}
+
+// pd.Interpret() interprets a content stream, within a running
+// interpretation like the one of a form in the context of that.
 func (pd *PdfDrawerT) Interpret(rdr fancy.Reader) {
+	pd.interpret(pd.context(), rdr)
+}
+
+// pd.context() returns the context of the running interpretation of pd or
+// of the drawer it is nested in.
+func (pd *PdfDrawerT) context() context.Context {
+	for d := pd; d != nil; d = d.outer {
+		if d.ctx != nil {
+			return d.ctx
+		}
+	}
+	return context.Background()
+}
+
+// pd.Nest() makes pd draw a part of the drawing of outer, like the cell of
+// a tiling pattern. Its interpretations run in the context of outer and
+// count their operators with the ones of outer for the Limits of outer.
+func (pd *PdfDrawerT) Nest(outer *PdfDrawerT) {
+	if outer.ops == nil {
+		outer.ops = new(int)
+	}
+	pd.outer, pd.ops, pd.Limits = outer, outer.ops, outer.Limits
+}
+
+// pd.InterpretContext() is pd.Interpret() returning exceeded pd.Limits and
+// the end of ctx as error.
+func (pd *PdfDrawerT) InterpretContext(ctx context.Context, rdr fancy.Reader) (err error) {
+	defer limits.Catch(&err)
+	pd.interpret(ctx, rdr)
+	return
+}
+
+func (pd *PdfDrawerT) interpret(ctx context.Context, rdr fancy.Reader) {
+	if pd.ops == nil {
+		pd.ops = new(int)
+	}
+	if pd.ctx == nil && pd.outer == nil {
+		*pd.ops = 0 // a new drawing
+	}
+	defer func(r fancy.Reader, ctx context.Context) { pd.rdr, pd.ctx = r, ctx }(pd.rdr, pd.ctx)
+	pd.rdr, pd.ctx = rdr, ctx
 	for {
-		t, _ := ps.Token(rdr)
+		t, _ := ps.TokenN(rdr, pd.Limits.MaxDepth)
 		if len(t) == 0 {
 			break
 		}
 		if f, ok := pd.Ops[string(t)]; ok {
+			if *pd.ops++; *pd.ops%1024 == 0 {
+				limits.Context(ctx)
+			}
+			limits.Check("MaxOperators", int64(*pd.ops), int64(pd.Limits.MaxOperators))
+			if h, ok := hiddenOps[string(t)]; ok && pd.hidden > 0 {
+				f = h
+			}
 			f(pd)
 		} else {
 			pd.Stack.Push(t)
@@ -392,6 +953,7 @@ func NewPdfDrawer() *PdfDrawerT {
 	r.TConf = r.TConfD
 	r.Text = r.TConfD
 	r.Write = new(util.OutT)
+	r.ctm = identity
 	return r
 }
 
@@ -399,21 +961,66 @@ func NewPdfDrawer() *PdfDrawerT {
 
 func (t *DrawerConfigT) SetCMYKFill(s [][]byte) {
 	t.FillColor = t.color.CMYK(s)
+	t.FillSpace = DeviceCMYK
 }
 func (t *DrawerConfigT) SetCMYKStroke(s [][]byte) {
 	t.StrokeColor = t.color.CMYK(s)
+	t.StrokeSpace = DeviceCMYK
 }
 func (t *DrawerConfigT) SetGrayFill(a []byte) {
 	t.FillColor = t.color.Gray(a)
+	t.FillSpace = DeviceGray
 }
 func (t *DrawerConfigT) SetGrayStroke(a []byte) {
 	t.StrokeColor = t.color.Gray(a)
+	t.StrokeSpace = DeviceGray
 }
 func (t *DrawerConfigT) SetRGBFill(s [][]byte) {
 	t.FillColor = t.color.RGB(s)
+	t.FillSpace = DeviceRGB
 }
 func (t *DrawerConfigT) SetRGBStroke(s [][]byte) {
 	t.StrokeColor = t.color.RGB(s)
+	t.StrokeSpace = DeviceRGB
+}
+func (t *DrawerConfigT) SetFillSpace(cs ColorSpace) {
+	t.FillSpace = cs
+	t.SetFillColor(cs.Initial())
+}
+func (t *DrawerConfigT) SetStrokeSpace(cs ColorSpace) {
+	t.StrokeSpace = cs
+	t.SetStrokeColor(cs.Initial())
+}
+
+// t.SetFillColor() sets a color of the fill color space, colors without
+// device color (patterns) keep the one before.
+func (t *DrawerConfigT) SetFillColor(c []float64) {
+	if t.FillSpace == nil {
+		t.FillSpace = DeviceGray
+	}
+	if sp, d := t.FillSpace.Device(c); sp != "" {
+		t.FillColor = t.color.Device(sp, d)
+	}
+}
+func (t *DrawerConfigT) SetStrokeColor(c []float64) {
+	if t.StrokeSpace == nil {
+		t.StrokeSpace = DeviceGray
+	}
+	if sp, d := t.StrokeSpace.Device(c); sp != "" {
+		t.StrokeColor = t.color.Device(sp, d)
+	}
+}
+
+// t.SetFillPaint() sets a paint of a pattern, "" keeps the one before.
+func (t *DrawerConfigT) SetFillPaint(p string) {
+	if p != "" {
+		t.FillColor = p
+	}
+}
+func (t *DrawerConfigT) SetStrokePaint(p string) {
+	if p != "" {
+		t.StrokeColor = p
+	}
 }
 func (t *DrawerConfigT) SetColors(hook DrawerColor) {
 	t.color = hook
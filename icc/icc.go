@@ -0,0 +1,431 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// ICC profiles (v2 and v4) for conversion of colors to sRGB. Supported are
+// the lut based (mft1, mft2, mAB) and the matrix/TRC profiles.
+package icc
+
+import (
+	"math"
+)
+
+// clut dimensions, more input channels are not used by PDF.
+const MAX_CHANNELS = 15
+
+// the white point of the profile connection space.
+var D50 = [3]float64{0.9642, 1, 0.8249}
+
+type curveT struct {
+	table []float64 // nil for the parametric curve
+	fn    int       // type of the parametric curve
+	p     [7]float64
+}
+
+// lutT is a lut of a mft1, mft2 or mAB tag: in curves, clut, out curves.
+// Matrices are not used as the input is not XYZ.
+type lutT struct {
+	in, out   int
+	a         []curveT // before the clut
+	grid      []int
+	clut      []float64
+	m         []curveT // after the clut, mAB only
+	matrix    []float64
+	b         []curveT // the output curves
+	legacyLab bool     // 16 bit Lab of mft2
+}
+
+type ProfileT struct {
+	Version    int
+	Class      string
+	ColorSpace string // like "CMYK" or "RGB "
+	PCS        string // "XYZ " or "Lab "
+	N          int    // number of channels of ColorSpace
+	lut        *lutT
+	matrix     [9]float64 // columns rXYZ, gXYZ, bXYZ
+	trc        []curveT   // r, g, b or gray
+}
+
+type readerT []byte
+
+func (d readerT) u8(p int) int  { return int(d[p]) }
+func (d readerT) u16(p int) int { return int(d[p])<<8 | int(d[p+1]) }
+func (d readerT) u32(p int) int {
+	return int(d[p])<<24 | int(d[p+1])<<16 | int(d[p+2])<<8 | int(d[p+3])
+}
+func (d readerT) s15(p int) float64 { return float64(int32(d.u32(p))) / 65536 }
+func (d readerT) sig(p int) string  { return string(d[p : p+4]) }
+
+func channels(space string) int {
+	switch space {
+	case "GRAY":
+		return 1
+	case "RGB ", "Lab ", "XYZ ", "CMY ":
+		return 3
+	case "CMYK":
+		return 4
+	}
+	if len(space) == 4 && space[1:] == "CLR" { // like "5CLR"
+		if n := int(space[0] - '0'); n > 1 && n < 10 {
+			return n
+		}
+		if n := int(space[0]-'A') + 10; n >= 10 && n <= MAX_CHANNELS {
+			return n
+		}
+	}
+	return 0
+}
+
+// Read() parses a profile, nil if it is broken or not supported.
+func Read(data []byte) (r *ProfileT) {
+	defer func() {
+		if recover() != nil {
+			r = nil
+		}
+	}()
+	d := readerT(data)
+	if len(d) < 132 || d.sig(36) != "acsp" {
+		return nil
+	}
+	r = &ProfileT{Version: d.u8(8), Class: d.sig(12), ColorSpace: d.sig(16), PCS: d.sig(20)}
+	if r.N = channels(r.ColorSpace); r.N == 0 || (r.PCS != "XYZ " && r.PCS != "Lab ") {
+		return nil
+	}
+	tags := make(map[string]int)
+	for k := 0; k < d.u32(128); k++ {
+		p := 132 + 12*k
+		tags[d.sig(p)] = d.u32(p + 4)
+	}
+	for _, t := range []string{"A2B0", "A2B1", "A2B2"} {
+		if p, ok := tags[t]; ok {
+			if r.lut = d.lut(p); r.lut != nil {
+				return r
+			}
+		}
+	}
+	switch r.N {
+	case 1:
+		if p, ok := tags["kTRC"]; ok {
+			r.trc = []curveT{d.curve(p)}
+			return r
+		}
+	case 3:
+		for k, t := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+			p, ok := tags[t]
+			if !ok {
+				return nil
+			}
+			for j := 0; j < 3; j++ {
+				r.matrix[3*j+k] = d.s15(p + 8 + 4*j)
+			}
+		}
+		for _, t := range []string{"rTRC", "gTRC", "bTRC"} {
+			p, ok := tags[t]
+			if !ok {
+				return nil
+			}
+			r.trc = append(r.trc, d.curve(p))
+		}
+		return r
+	}
+	return nil
+}
+
+// d.curve() reads a curv or para element at p.
+func (d readerT) curve(p int) (r curveT) {
+	switch d.sig(p) {
+	case "curv":
+		n := d.u32(p + 8)
+		if n < 0 || n > (len(d)-p-12)/2 {
+			panic("curve size")
+		}
+		switch n {
+		case 0:
+			r.p[0] = 1
+		case 1:
+			r.p[0] = float64(d.u16(p+12)) / 256
+		default:
+			r.table = make([]float64, n)
+			for k := range r.table {
+				r.table[k] = float64(d.u16(p+12+2*k)) / 65535
+			}
+		}
+	case "para":
+		r.fn = d.u16(p + 8)
+		for k := 0; k < [5]int{1, 3, 4, 5, 7}[r.fn]; k++ {
+			r.p[k] = d.s15(p + 12 + 4*k)
+		}
+	default:
+		panic("curve type")
+	}
+	return
+}
+
+// d.curveSize() is the size of a curv or para element at p, 4 byte aligned.
+func (d readerT) curveSize(p int) int {
+	n := 12 + 4*[5]int{1, 3, 4, 5, 7}[min(4, d.u16(p+8))]
+	if d.sig(p) == "curv" {
+		n = 12 + 2*d.u32(p+8)
+	}
+	return (n + 3) &^ 3
+}
+
+func (d readerT) curves(p, n int) []curveT {
+	r := make([]curveT, n)
+	for k := range r {
+		r[k] = d.curve(p)
+		p += d.curveSize(p)
+	}
+	return r
+}
+
+// table() makes a curve of n 8 or 16 bit values at p, at least 2.
+func (d readerT) table(p, n, size int) curveT {
+	if n < 2 || p < 0 || size < 1 || size > 2 || n > (len(d)-p)/size {
+		panic("table size")
+	}
+	r := curveT{table: make([]float64, n)}
+	for k := range r.table {
+		if size == 1 {
+			r.table[k] = float64(d[p+k]) / 255
+		} else {
+			r.table[k] = float64(d.u16(p+2*k)) / 65535
+		}
+	}
+	return r
+}
+
+// d.lut() reads a mft1, mft2 or mAB tag at p.
+func (d readerT) lut(p int) *lutT {
+	l := &lutT{in: d.u8(p + 8), out: d.u8(p + 9)}
+	if l.in == 0 || l.in > MAX_CHANNELS || l.out == 0 {
+		return nil
+	}
+	switch d.sig(p) {
+	case "mft1", "mft2":
+		size, inN, outN, q := 1, 256, 256, p+48
+		if d.sig(p) == "mft2" {
+			size, inN, outN, q = 2, d.u16(p+48), d.u16(p+50), p+52
+			l.legacyLab = true
+		}
+		g := d.u8(p + 10)
+		for k := 0; k < l.in; k++ {
+			l.a = append(l.a, d.table(q, inN, size))
+			q += inN * size
+		}
+		q = d.clut(l, q, g, size)
+		for k := 0; k < l.out; k++ {
+			l.b = append(l.b, d.table(q, outN, size))
+			q += outN * size
+		}
+	case "mAB ":
+		if o := d.u32(p + 28); o != 0 {
+			l.a = d.curves(p+o, l.in)
+		}
+		if o := d.u32(p + 24); o != 0 {
+			c := p + o
+			l.grid = make([]int, l.in)
+			for k := range l.grid {
+				l.grid[k] = d.u8(c + k)
+			}
+			d.clut(l, c+20, 0, d.u8(c+16))
+		}
+		if o := d.u32(p + 20); o != 0 {
+			l.m = d.curves(p+o, l.out)
+		}
+		if o := d.u32(p + 16); o != 0 && l.out == 3 {
+			l.matrix = make([]float64, 12)
+			for k := range l.matrix {
+				l.matrix[k] = d.s15(p + o + 4*k)
+			}
+		}
+		if o := d.u32(p + 12); o != 0 {
+			l.b = d.curves(p+o, l.out)
+		}
+	default:
+		return nil
+	}
+	return l
+}
+
+// d.clut() reads a clut at q with grid g for all inputs (0: l.grid is
+// set) and returns its end.
+func (d readerT) clut(l *lutT, q, g, size int) int {
+	n := l.out
+	if g > 0 {
+		l.grid = make([]int, l.in)
+	}
+	for k := range l.grid {
+		if g > 0 {
+			l.grid[k] = g
+		}
+		if l.grid[k] < 2 || n > len(d)/l.grid[k] {
+			panic("grid")
+		}
+		n *= l.grid[k]
+	}
+	l.clut = d.table(q, n, size).table
+	return q + n*size
+}
+
+func (c *curveT) eval(x float64) float64 {
+	x = min(1, max(0, x))
+	if c.table != nil {
+		if len(c.table) == 1 {
+			return c.table[0]
+		}
+		f := x * float64(len(c.table)-1)
+		i := min(int(f), len(c.table)-2)
+		return c.table[i] + (f-float64(i))*(c.table[i+1]-c.table[i])
+	}
+	g, a, b, cc, dd, e, f := c.p[0], c.p[1], c.p[2], c.p[3], c.p[4], c.p[5], c.p[6]
+	switch c.fn {
+	case 0:
+		return math.Pow(x, g)
+	case 1:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g)
+		}
+		return 0
+	case 2:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g) + cc
+		}
+		return cc
+	case 3:
+		if x >= dd {
+			return math.Pow(a*x+b, g)
+		}
+		return cc * x
+	case 4:
+		if x >= dd {
+			return math.Pow(a*x+b, g) + e
+		}
+		return cc*x + f
+	}
+	return x
+}
+
+func apply(c []curveT, v []float64) {
+	for k := range c {
+		if k < len(v) {
+			v[k] = c[k].eval(v[k])
+		}
+	}
+}
+
+// l.interpolate() looks up the clut multilinear.
+func (l *lutT) interpolate(v []float64) []float64 {
+	lo := make([]int, l.in)
+	frac := make([]float64, l.in)
+	for k := range lo {
+		f := min(1, max(0, v[k])) * float64(l.grid[k]-1)
+		lo[k] = min(int(f), l.grid[k]-2)
+		frac[k] = f - float64(lo[k])
+	}
+	r := make([]float64, l.out)
+	for corner := 0; corner < 1<<l.in; corner++ {
+		w, p := 1.0, 0
+		for k := 0; k < l.in; k++ { // the first input varies slowest
+			i := lo[k]
+			if corner>>k&1 == 1 {
+				w *= frac[k]
+				i++
+			} else {
+				w *= 1 - frac[k]
+			}
+			p = p*l.grid[k] + i
+		}
+		if w == 0 {
+			continue
+		}
+		for j := range r {
+			r[j] += w * l.clut[p*l.out+j]
+		}
+	}
+	return r
+}
+
+func (l *lutT) eval(in []float64) []float64 {
+	v := make([]float64, l.in)
+	copy(v, in)
+	apply(l.a, v)
+	if l.clut != nil {
+		v = l.interpolate(v)
+	}
+	apply(l.m, v)
+	if m := l.matrix; m != nil {
+		v = []float64{
+			m[0]*v[0] + m[1]*v[1] + m[2]*v[2] + m[9],
+			m[3]*v[0] + m[4]*v[1] + m[5]*v[2] + m[10],
+			m[6]*v[0] + m[7]*v[1] + m[8]*v[2] + m[11],
+		}
+	}
+	apply(l.b, v)
+	return v
+}
+
+// Encode() applies the transfer curve of sRGB to a linear value, the
+// result is clipped to 0..1.
+func Encode(v float64) float64 {
+	if v <= 0.0031308 {
+		return min(1, max(0, 12.92*v))
+	}
+	return min(1, max(0, 1.055*math.Pow(v, 1/2.4)-0.055))
+}
+
+// XYZToSRGB() converts CIE XYZ relative to D50 to sRGB (Bradford adapted).
+func XYZToSRGB(x, y, z float64) []float64 {
+	return []float64{
+		Encode(3.1338561*x - 1.6168667*y - 0.4906146*z),
+		Encode(-0.9787684*x + 1.9161415*y + 0.0334540*z),
+		Encode(0.0719453*x - 0.2289914*y + 1.4052427*z),
+	}
+}
+
+// LabToXYZ() converts CIE Lab relative to D50 to XYZ.
+func LabToXYZ(l, a, b float64) (float64, float64, float64) {
+	g := func(x float64) float64 {
+		if x >= 6.0/29 {
+			return x * x * x
+		}
+		return 108.0 / 841 * (x - 4.0/29)
+	}
+	fy := (l + 16) / 116
+	return D50[0] * g(fy+a/500), D50[1] * g(fy), D50[2] * g(fy-b/200)
+}
+
+// p.SRGB() converts a color of the profile's color space, components
+// 0..1, to sRGB.
+func (p *ProfileT) SRGB(in []float64) []float64 {
+	if p.lut == nil {
+		if p.N == 1 {
+			y := p.trc[0].eval(in[0])
+			return XYZToSRGB(D50[0]*y, y, D50[2]*y)
+		}
+		v := []float64{in[0], in[1], in[2]}
+		apply(p.trc, v)
+		m := p.matrix
+		return XYZToSRGB(
+			m[0]*v[0]+m[1]*v[1]+m[2]*v[2],
+			m[3]*v[0]+m[4]*v[1]+m[5]*v[2],
+			m[6]*v[0]+m[7]*v[1]+m[8]*v[2])
+	}
+	v := p.lut.eval(in)
+	if len(v) < 3 {
+		return []float64{0, 0, 0}
+	}
+	if p.PCS == "Lab " {
+		scale := 255.0
+		if p.lut.legacyLab {
+			scale = 65535.0 / 256
+			v[0] *= 65535.0 / 65280
+		}
+		return XYZToSRGB(LabToXYZ(v[0]*100, v[1]*scale-128, v[2]*scale-128))
+	}
+	s := 65535.0 / 32768
+	return XYZToSRGB(v[0]*s, v[1]*s, v[2]*s)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Resource limits for untrusted input.
+package limits
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Limits of resources used for a document. A value <= 0 means no limit.
+type Limits struct {
+	MaxStreamSize int64 // maximum size of a (decoded) stream in bytes
+	MaxOperators  int   // maximum number of operators per page, with its forms, patterns and glyphs
+	MaxDepth      int   // maximum nesting of objects and page tree
+	MaxPages      int   // maximum number of pages of a document
+}
+
+// Error reports an exceeded limit.
+type Error struct {
+	Limit string // name of the limit, i.e. "MaxStreamSize"
+	Max   int64
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("limit %s of %d exceeded", e.Limit, e.Max)
+}
+
+type abortT struct {
+	err error
+}
+
+func (a abortT) Error() string { return a.err.Error() }
+
+// Check() aborts the running operation with an *Error if value exceeds max.
+func Check(limit string, value, max int64) {
+	if max > 0 && value > max {
+		panic(abortT{&Error{limit, max}})
+	}
+}
+
+// Context() aborts the running operation if ctx is done.
+func Context(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		panic(abortT{err})
+	}
+}
+
+// IsAbort() tells if a recovered value is an aborted operation, which has
+// to be passed on by panic(r) to the Catch() of the operation.
+func IsAbort(r interface{}) bool {
+	_, ok := r.(abortT)
+	return ok
+}
+
+// Recover() has to be deferred by functions falling back on bad input: a
+// recovered panic is handed to fallback, aborted operations are passed on.
+func Recover(fallback func(r interface{})) {
+	if r := recover(); r != nil {
+		if IsAbort(r) {
+			panic(r)
+		}
+		fallback(r)
+	}
+}
+
+// Catch() has to be deferred by functions returning errors of aborted
+// operations. Other panics are passed through.
+func Catch(err *error) {
+	if r := recover(); r != nil {
+		a, ok := r.(abortT)
+		if !ok {
+			panic(r)
+		}
+		*err = a.err
+	}
+}
+
+// ------------------------------------------------------------------
+
+type readerT struct {
+	ctx   context.Context
+	r     io.Reader
+	n     int64
+	limit string
+	max   int64
+}
+
+func (r *readerT) Read(b []byte) (n int, err error) {
+	Context(r.ctx)
+	n, err = r.r.Read(b)
+	r.n += int64(n)
+	Check(r.limit, r.n, r.max)
+	return
+}
+
+// Reader() wraps r so reading aborts if ctx is done or more than max bytes
+// are read.
+func Reader(ctx context.Context, r io.Reader, limit string, max int64) io.Reader {
+	return &readerT{ctx, r, 0, limit, max}
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Optional content (layers) of a document for graf.go.
+//
+// The groups of /OCProperties start in the state of the default
+// configuration /D and can be switched by SetVisible(). Content of groups
+// and membership dictionaries which are not visible is skipped by graf.
+package optcontent
+
+import (
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/limits"
+	"github.com/grokify/pdfreader/ps"
+	"github.com/grokify/pdfreader/util"
+)
+
+// visibility expressions contain expressions.
+const MAX_DEPTH = 16
+
+// GroupT is an optional content group.
+type GroupT struct {
+	Ref     string   // the reference of the group, like "12 0 R"
+	Name    string   // /Name as UTF-8
+	Intent  []string // /Intent, like /View or /Design
+	Visible bool     // the state by /D or SetVisible()
+	Locked  bool     // by /Locked of /D, viewers should not switch it
+}
+
+// OrderT is an entry of the presentation order /Order of the groups, a
+// group with the entries nested below it or a label of entries.
+type OrderT struct {
+	Group *GroupT // nil for a label
+	Label string  // of the entries without group
+	Kids  []OrderT
+}
+
+type ContentT struct {
+	Pdf      *pdfreader.PDFReader
+	Groups   []*GroupT // by /OCGs
+	Order    []OrderT  // by /Order of /D, Groups if there is none
+	intent   []string  // /Intent of /D
+	refs     map[string]*GroupT
+	rbgroups [][]*GroupT // radio button groups, one of them visible
+}
+
+func names(pd *pdfreader.PDFReader, o []byte) []string {
+	if o = pd.Obj(o); len(o) > 0 && o[0] == '/' {
+		return []string{string(o)}
+	}
+	return util.StringArray(pd.Arr(o))
+}
+
+// New() reads the optional content of a document, no groups if it has none.
+func New(pd *pdfreader.PDFReader) *ContentT {
+	c := &ContentT{Pdf: pd, refs: make(map[string]*GroupT)}
+	oc := pd.Dic(pd.Catalog()["/OCProperties"])
+	for _, o := range pd.Arr(oc["/OCGs"]) {
+		r := pdfreader.Ref(o)
+		if _, ok := c.refs[r]; ok || r == "" {
+			continue
+		}
+		d := pd.Dic(o)
+		g := &GroupT{Ref: r, Name: util.TextString(ps.String(pd.Obj(d["/Name"]))),
+			Intent: names(pd, d["/Intent"]), Visible: true}
+		if len(g.Intent) == 0 {
+			g.Intent = []string{"/View"}
+		}
+		c.Groups = append(c.Groups, g)
+		c.refs[r] = g
+	}
+	d := pd.Dic(oc["/D"])
+	if string(pd.Obj(d["/BaseState"])) == "/OFF" {
+		for _, g := range c.Groups {
+			g.Visible = false
+		}
+	}
+	for _, g := range c.groups(d["/ON"]) {
+		g.Visible = true
+	}
+	for _, g := range c.groups(d["/OFF"]) {
+		g.Visible = false
+	}
+	for _, g := range c.groups(d["/Locked"]) {
+		g.Locked = true
+	}
+	for _, o := range pd.Arr(d["/RBGroups"]) {
+		c.rbgroups = append(c.rbgroups, c.groups(o))
+	}
+	if c.intent = names(pd, d["/Intent"]); len(c.intent) == 0 {
+		c.intent = []string{"/View"}
+	}
+	if order, ok := d["/Order"]; ok {
+		c.Order = c.order(pd.Arr(order), 0)
+	} else {
+		for _, g := range c.Groups {
+			c.Order = append(c.Order, OrderT{Group: g})
+		}
+	}
+	return c
+}
+
+// c.groups() returns the known groups of an array of references.
+func (c *ContentT) groups(o []byte) (r []*GroupT) {
+	for _, e := range c.Pdf.Arr(o) {
+		if g, ok := c.refs[pdfreader.Ref(e)]; ok {
+			r = append(r, g)
+		}
+	}
+	return
+}
+
+// c.order() reads the entries of an /Order array, a group followed by an
+// array are the group and the entries below it, an array starting with a
+// string is a label.
+func (c *ContentT) order(a [][]byte, depth int) (r []OrderT) {
+	if depth >= MAX_DEPTH {
+		return
+	}
+	for _, o := range a {
+		e := c.Pdf.Obj(o)
+		if len(e) == 0 || e[0] != '[' {
+			if g, ok := c.refs[pdfreader.Ref(o)]; ok {
+				r = append(r, OrderT{Group: g})
+			}
+			continue
+		}
+		sub := c.Pdf.Arr(e)
+		n := len(r)
+		switch {
+		case len(sub) > 0 && (sub[0][0] == '(' || len(sub[0]) > 1 && sub[0][0] == '<' && sub[0][1] != '<'):
+			r = append(r, OrderT{Label: util.TextString(ps.String(sub[0])), Kids: c.order(sub[1:], depth+1)})
+		case n > 0 && r[n-1].Group != nil && r[n-1].Kids == nil:
+			r[n-1].Kids = c.order(sub, depth+1)
+		default:
+			r = append(r, c.order(sub, depth+1)...)
+		}
+	}
+	return
+}
+
+// c.Group() returns a group by /Name, nil if there is none.
+func (c *ContentT) Group(name string) *GroupT {
+	for _, g := range c.Groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+// c.SetVisible() switches a group, switching on turns off the others of
+// its radio button groups.
+func (c *ContentT) SetVisible(g *GroupT, on bool) {
+	if on {
+		for _, rb := range c.rbgroups {
+			for _, h := range rb {
+				if h == g {
+					for _, h := range rb {
+						h.Visible = false
+					}
+					break
+				}
+			}
+		}
+	}
+	g.Visible = on
+}
+
+// c.state() returns if a group is visible, groups of other intents and
+// unknown ones are.
+func (c *ContentT) state(o []byte) bool {
+	g, ok := c.refs[pdfreader.Ref(o)]
+	if !ok {
+		return true
+	}
+	for _, i := range c.intent {
+		for _, gi := range g.Intent {
+			if i == "/All" || i == gi {
+				return g.Visible
+			}
+		}
+	}
+	return true
+}
+
+// c.expression() evaluates a visibility expression /VE.
+func (c *ContentT) expression(o []byte, depth int) bool {
+	a := c.Pdf.Arr(o)
+	if len(a) == 0 || depth >= MAX_DEPTH {
+		return c.state(o)
+	}
+	switch string(c.Pdf.Obj(a[0])) {
+	case "/Not":
+		return len(a) < 2 || !c.expression(a[1], depth+1)
+	case "/And":
+		for _, e := range a[1:] {
+			if !c.expression(e, depth+1) {
+				return false
+			}
+		}
+		return true
+	case "/Or":
+		for _, e := range a[1:] {
+			if c.expression(e, depth+1) {
+				return true
+			}
+		}
+		return len(a) < 2
+	}
+	return true
+}
+
+// c.Visible() tells if content of a group or membership dictionary is
+// visible.
+func (c *ContentT) Visible(o []byte) (r bool) {
+	defer limits.Recover(func(interface{}) { r = true })
+	d := c.Pdf.Dic(o)
+	if string(d["/Type"]) != "/OCMD" {
+		return c.state(o)
+	}
+	if ve, ok := d["/VE"]; ok {
+		return c.expression(ve, 0)
+	}
+	var states []bool
+	for _, g := range c.Pdf.ForcedArray(d["/OCGs"]) {
+		if string(c.Pdf.Obj(g)) != "null" {
+			states = append(states, c.state(g))
+		}
+	}
+	if len(states) == 0 {
+		return true
+	}
+	one, all := false, true
+	for _, on := range states {
+		one, all = one || on, all && on
+	}
+	switch string(c.Pdf.Obj(d["/P"])) {
+	case "/AllOn":
+		return all
+	case "/AnyOff":
+		return !all
+	case "/AllOff":
+		return !one
+	}
+	return one
+}
+
+// ResourcesT resolves the names of BDC /OC by /Properties resources.
+type ResourcesT struct {
+	Content    *ContentT
+	properties pdfreader.Dictionary
+}
+
+// c.Resources() returns the optional content of c for the content of a
+// /Resources dictionary.
+func (c *ContentT) Resources(resources []byte) *ResourcesT {
+	r := &ResourcesT{Content: c}
+	if resources != nil {
+		r.properties = c.Pdf.Dic(c.Pdf.Dic(resources)["/Properties"])
+	}
+	return r
+}
+
+func (r *ResourcesT) Visible(o []byte) bool {
+	if len(o) > 0 && o[0] == '/' {
+		p, ok := r.properties[string(o)]
+		if !ok {
+			return true
+		}
+		o = p
+	}
+	return r.Content.Visible(o)
+}
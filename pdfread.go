@@ -10,12 +10,18 @@ package pdfreader
 
 import (
 	"compress/zlib"
+	"context"
 	"encoding/ascii85"
-	"log"
+	"io"
 	"regexp"
+	"runtime"
+	"strings"
+	"sync"
 
+	"github.com/grokify/pdfreader/cache"
 	"github.com/grokify/pdfreader/fancy"
 	"github.com/grokify/pdfreader/hex"
+	"github.com/grokify/pdfreader/limits"
 	"github.com/grokify/pdfreader/lzw"
 	"github.com/grokify/pdfreader/ps"
 )
@@ -24,23 +30,60 @@ import (
 
 const (
 	MAX_PDF_UPDATES   = 1024
-	MAX_PDF_ARRAYSIZE = 1024
+	MAX_PDF_ARRAYSIZE = 1024 // initial capacity of arrays, they may be larger
 )
 
 // types
 
 type Dictionary map[string][]byte
 
+// Options of a PDFReader, see LoadWith().
+type Options struct {
+	Cache        cache.Cache // cache for resolved objects, unbounded if nil
+	CacheStreams bool        // keep decoded streams in the cache too
+	SectorSize   int         // sector size of the file cache, see fancy.SecReaderN()
+	SectorCount  int         // number of sectors in the file cache
+	Limits       limits.Limits
+}
+
+// PDFReader is safe for concurrent use: every access to the file has an own
+// cursor and the caches are locked. Repair() replaces Xref, Trailer and
+// Repaired under mu, callers should not read them while objects are read.
 type PDFReader struct {
-	File      string            // name of the file
-	rdr       fancy.Reader      // reader for the contents
-	Startxref int               // starting of xref table
-	Xref      map[int]int       // "pointers" of the xref table
-	Trailer   Dictionary        // trailer dictionary of the file
-	rcache    map[string][]byte // resolver cache
-	rncache   map[string]int    // resolver cache (positions in file)
-	dicache   map[string]Dictionary
-	pages     [][]byte // pages cache
+	File       string       // name of the file
+	rdr        fancy.Reader // reader for the contents, only ReadAt() is used
+	Startxref  int          // starting of xref table
+	Xref       map[int]int  // "pointers" of the xref table
+	Trailer    Dictionary   // trailer dictionary of the file
+	opts       Options
+	objs       cache.Cache // resolver, dictionary and stream cache
+	pages      [][]byte    // pages cache
+	pagesOf    bool        // pages were built with the rebuilt xref table
+	Repaired   bool        // xref table was rebuilt by scanning the file
+	mu         sync.Mutex  // guards Xref, Trailer and Repaired
+	pagesMu    sync.Mutex  // guards building of pages
+	repairMu   sync.Mutex  // guards Repair()
+	repairDone bool        // Repair() was done, guarded by repairMu
+}
+
+// cached objects, the keys are prefixed with 'R', 'D' or 'S'.
+
+type resolvedT struct {
+	n int
+	s []byte
+}
+
+type streamT struct {
+	dic  Dictionary
+	data []byte
+}
+
+func dictionarySize(d Dictionary) int {
+	r := 16
+	for k := range d {
+		r += len(k) + len(d[k]) + 16
+	}
+	return r
 }
 
 var _Bytes = []byte{}
@@ -70,7 +113,13 @@ func num(n []byte) (r int) {
 }
 
 func refToken(f fancy.Reader) ([]byte, int64) {
-	tok, p := ps.Token(f)
+	return refTokenN(f, 0)
+}
+
+// refTokenN() is refToken() with a limit for the nesting of objects, see
+// ps.TokenN().
+func refTokenN(f fancy.Reader, maxDepth int) ([]byte, int64) {
+	tok, p := ps.TokenN(f, maxDepth)
 	if len(tok) > 0 && tok[0] >= '0' && tok[0] <= '9' {
 		ps.Token(f)
 		r, q := ps.Token(f)
@@ -109,6 +158,9 @@ func xrefStart(f fancy.Reader) int {
 
 // xrefSkip() queries the start of the trailer for a (partial) xref-table.
 func xrefSkip(f fancy.Reader, xref int) int {
+	if xref < 0 || int64(xref) >= f.Size() {
+		return -1
+	}
 	f.Seek(int64(xref), 0)
 	t, p := ps.Token(f)
 	if string(t) != "xref" {
@@ -116,7 +168,7 @@ func xrefSkip(f fancy.Reader, xref int) int {
 	}
 	for {
 		t, p = ps.Token(f)
-		if t[0] < '0' || t[0] > '9' {
+		if len(t) == 0 || t[0] < '0' || t[0] > '9' {
 			f.Seek(p, 0)
 			break
 		}
@@ -160,19 +212,18 @@ func array(s []byte) [][]byte {
 		return nil
 	}
 	rdr := fancy.SliceReader(s[1 : len(s)-1])
-	r := make([][]byte, MAX_PDF_ARRAYSIZE)
-	b := 0
+	r := make([][]byte, 0, MAX_PDF_ARRAYSIZE)
 	for {
-		r[b], _ = refToken(rdr)
-		if len(r[b]) == 0 {
+		t, _ := refToken(rdr)
+		if len(t) == 0 {
 			break
 		}
-		b++
+		r = append(r, t)
 	}
-	if b == 0 {
+	if len(r) == 0 {
 		return nil
 	}
-	return r[0:b]
+	return r
 }
 
 // xrefRead() reads the xref table(s) of a PDF file. This is not recursive
@@ -183,9 +234,14 @@ func xrefRead(f fancy.Reader, p int) map[int]int {
 	b := 0
 	s := _Bytes
 	for ok := true; ok; {
+		if b >= MAX_PDF_UPDATES {
+			return nil
+		}
 		back[b] = p
 		b++
-		p = xrefSkip(f, p)
+		if p = xrefSkip(f, p); p == -1 {
+			return nil
+		}
 		f.Seek(int64(p), 0)
 		s, _ = ps.Token(f)
 		if string(s) != "trailer" {
@@ -202,13 +258,13 @@ func xrefRead(f fancy.Reader, p int) map[int]int {
 		ps.Token(f) // skip "xref"
 		for {
 			m := tupel(f, 2)
-			if string(m[0]) == "trailer" {
+			if string(m[0]) == "trailer" || len(m[0]) == 0 {
 				break
 			}
 			ps.SkipLE(f)
 			o := num(m[0])
 			dat := f.Slice(num(m[1]) * 20)
-			for i := 0; i < len(dat); i += 20 {
+			for i := 0; i+18 <= len(dat); i += 20 {
 				if dat[i+17] != 'n' {
 					delete(r, o)
 				} else {
@@ -221,21 +277,55 @@ func xrefRead(f fancy.Reader, p int) map[int]int {
 	return r
 }
 
+// pd.cursor() gives an own read position on the file.
+func (pd *PDFReader) cursor() fancy.Reader {
+	return fancy.Cursor(pd.rdr, pd.rdr.Size())
+}
+
+// pd.xref() queries the position of object o in the file.
+func (pd *PDFReader) xref(o int) (p int, ok bool) {
+	pd.mu.Lock()
+	p, ok = pd.Xref[o]
+	pd.mu.Unlock()
+	return
+}
+
+// pd.repaired() tells if the xref table was rebuilt by scanning the file.
+func (pd *PDFReader) repaired() bool {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	return pd.Repaired
+}
+
+// objectAt() reads object o at position p. ok is false if there is
+// something else at p.
+func objectAt(f fancy.Reader, p, o, maxDepth int) (int, []byte, bool) {
+	f.Seek(int64(p), 0)
+	m := tupel(f, 3)
+	if num(m[0]) != o || string(m[2]) != "obj" {
+		return -1, _Bytes, false
+	}
+	r, np := refTokenN(f, maxDepth)
+	return int(np) + len(r), r, true
+}
+
 // object() extracts the top informations of a PDF "object". For streams
 // this would be the dictionary as bytes.  It also returns the position in
 // binary data where one has to continue to read for this "object".
 func (pd *PDFReader) object(o int) (int, []byte) {
-	p, ok := pd.Xref[o]
+	p, ok := pd.xref(o)
 	if !ok {
 		return -1, _Bytes
 	}
-	pd.rdr.Seek(int64(p), 0)
-	m := tupel(pd.rdr, 3)
-	if num(m[0]) != o {
-		return -1, _Bytes
+	n, r, ok := objectAt(pd.cursor(), p, o, pd.opts.Limits.MaxDepth)
+	if !ok {
+		// the xref table lies - rebuild it once and try again.
+		if pd.repaired() || !pd.Repair() {
+			return -1, _Bytes
+		}
+		return pd.object(o)
 	}
-	r, np := refToken(pd.rdr)
-	return int(np) + len(r), r
+	return n, r
 }
 
 // pd.Resolve() resolves a reference in the PDF file. You'll probably need
@@ -249,22 +339,20 @@ func (pd *PDFReader) resolve(s []byte) (int, []byte) {
 	resolve = func(s []byte) (int, []byte) {
 		n := -1
 		if len(s) >= 5 && s[0] >= '0' && s[0] <= '9' && s[len(s)-1] == 'R' {
-			z, ok := pd.rcache[string(s)]
-			if ok {
-				return pd.rncache[string(s)], z
+			if z, ok := pd.objs.Get("R" + string(s)); ok {
+				return z.(resolvedT).n, z.(resolvedT).s
 			}
 			orig := s
 			o := num(s)
-			if _, ok = done[o]; ok {
+			if _, ok := done[o]; ok {
 				return -1, _Bytes
 			}
 			done[o] = 1
 			n, s = pd.object(o)
-			if s[0] >= '0' && s[0] <= '9' && s[len(s)-1] == 'R' {
+			if len(s) > 0 && s[0] >= '0' && s[0] <= '9' && s[len(s)-1] == 'R' {
 				n, s = resolve(s)
 			}
-			pd.rcache[string(orig)] = s
-			pd.rncache[string(orig)] = n
+			pd.objs.Put("R"+string(orig), resolvedT{n, s}, len(orig)+len(s)+16)
 		}
 		return n, s
 	}
@@ -274,70 +362,161 @@ func (pd *PDFReader) resolve(s []byte) (int, []byte) {
 // pd.Obj() is the universal method to access contents of PDF objects or
 // data tokens in i.e.  dictionaries.  For reading streams you'll have to
 // utilize pd.Resolve().
-func (pd *PDFReader) obj(reference []byte) []byte {
+func (pd *PDFReader) Obj(reference []byte) []byte {
 	_, r := pd.resolve(reference)
 	return r
 }
 
 // pd.Num() queries integer data from a reference.
 func (pd *PDFReader) num(reference []byte) int {
-	return num(pd.obj(reference))
+	return num(pd.Obj(reference))
 }
 
 // pd.Dic() queries dictionary data from a reference.
 func (pd *PDFReader) Dic(reference []byte) Dictionary {
-	d, ok := pd.dicache[string(reference)]
-	if !ok {
-		d = dictionary(pd.obj(reference))
-		pd.dicache[string(reference)] = d
+	if d, ok := pd.objs.Get("D" + string(reference)); ok {
+		return d.(Dictionary)
 	}
+	d := dictionary(pd.Obj(reference))
+	pd.objs.Put("D"+string(reference), d, len(reference)+dictionarySize(d))
 	return d
 }
 
 // pd.Arr() queries array data from a reference.
 func (pd *PDFReader) Arr(reference []byte) [][]byte {
-	return array(pd.obj(reference))
+	return array(pd.Obj(reference))
 }
 
 // pd.ForcedArray() queries array data. If reference does not refer to an
 // array, reference is taken as element of the returned array.
 func (pd *PDFReader) ForcedArray(reference []byte) [][]byte {
-	nr := pd.obj(reference)
+	nr := pd.Obj(reference)
 	if nr[0] != '[' {
 		return [][]byte{reference}
 	}
 	return array(nr)
 }
 
+// Ref() returns an indirect reference in the form "N G R" to compare
+// references by, "" if o is none.
+func Ref(o []byte) string {
+	f := strings.Fields(string(o))
+	if len(f) != 3 || f[2] != "R" {
+		return ""
+	}
+	return f[0] + " " + f[1] + " R"
+}
+
 // pd.Pages() returns an array with references to the pages of the PDF.
+// Pages found before the xref table is repaired are searched again.
 func (pd *PDFReader) Pages() [][]byte {
-	if pd.pages != nil {
+	pd.pagesMu.Lock()
+	defer pd.pagesMu.Unlock()
+	repaired := pd.repaired()
+	if pd.pages != nil && pd.pagesOf == repaired {
 		return pd.pages
 	}
-	pages := pd.Dic(pd.Dic(pd.Trailer["/Root"])["/Pages"])
-	pd.pages = make([][]byte, pd.num(pages["/Count"]))
-	cp := 0
+	lim := pd.opts.Limits
+	pages := pd.Dic(pd.Dic(pd.root())["/Pages"])
+	// /Count is not trusted, it only sets the initial capacity.
+	r := make([][]byte, 0, max(0, min(pd.num(pages["/Count"]), MAX_PDF_ARRAYSIZE)))
 	done := make(map[string]int)
+	depth := 0
 	var q func(p [][]byte)
 	q = func(p [][]byte) {
+		depth++
+		limits.Check("MaxDepth", int64(depth), int64(lim.MaxDepth))
+		defer func() { depth-- }()
 		for k := range p {
 			if _, wrong := done[string(p[k])]; !wrong {
 				done[string(p[k])] = 1
 				if kids, ok := pd.Dic(p[k])["/Kids"]; ok {
 					q(pd.Arr(kids))
 				} else {
-					pd.pages[cp] = p[k]
-					cp++
+					r = append(r, p[k])
+					limits.Check("MaxPages", int64(len(r)), int64(lim.MaxPages))
 				}
 			} else {
 				panic("Bad Page-Tree!")
 			}
 		}
 	}
+	// the pages are kept only if the page tree is read without panic.
 	q(pd.Arr(pages["/Kids"]))
+	pd.pages, pd.pagesOf = r, repaired
 	return pd.pages
 }
 
+// pd.PagesContext() is pd.Pages() returning exceeded limits as error.
+func (pd *PDFReader) PagesContext(ctx context.Context) (pages [][]byte, err error) {
+	defer limits.Catch(&err)
+	limits.Context(ctx)
+	return pd.Pages(), nil
+}
+
+// pd.ForEachPage() calls fn for all pages (by number, starting with 0)
+// from workers goroutines, runtime.NumCPU() if workers < 1. The first error
+// returned by fn or of ctx stops the processing and is returned.
+func (pd *PDFReader) ForEachPage(ctx context.Context, workers int,
+	fn func(ctx context.Context, page int) error) error {
+	pages, err := pd.PagesContext(ctx)
+	if err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	call := func(page int) (err error) {
+		defer limits.Catch(&err)
+		return fn(ctx, page)
+	}
+	var once sync.Once
+	var wg sync.WaitGroup
+	next := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range next {
+				if e := call(page); e != nil {
+					once.Do(func() {
+						err = e
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+feed:
+	for k := range pages {
+		select {
+		case next <- k:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// pd.root() returns the reference to the document catalog.
+func (pd *PDFReader) root() []byte {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	return pd.Trailer["/Root"]
+}
+
+// pd.Catalog() returns the document catalog.
+func (pd *PDFReader) Catalog() Dictionary {
+	return pd.Dic(pd.root())
+}
+
 // pd.attribute() tries to get an attribute definition from a page
 // reference.  Note that the attribute definition is not resolved - so it's
 // possible to get back a reference here.
@@ -360,7 +539,7 @@ func (pd *PDFReader) attribute(a string, src []byte) []byte {
 // pd.Att() tries to get an attribute from a page reference.  The
 // attribute will be resolved.
 func (pd *PDFReader) Att(a string, src []byte) []byte {
-	return pd.obj(pd.attribute(a, src))
+	return pd.Obj(pd.attribute(a, src))
 }
 
 // pd.stream() returns contents of a stream.
@@ -368,31 +547,69 @@ func (pd *PDFReader) stream(reference []byte) (Dictionary, []byte) {
 	q, d := pd.resolve(reference)
 	dic := pd.Dic(d)
 	l := pd.num(dic["/Length"])
-	pd.rdr.Seek(int64(q), 0)
-	t, _ := ps.Token(pd.rdr)
+	f := pd.cursor()
+	f.Seek(int64(q), 0)
+	t, _ := ps.Token(f)
 	if string(t) != "stream" {
 		return nil, []byte{}
 	}
-	ps.SkipLE(pd.rdr)
-	return dic, pd.rdr.Slice(l)
+	ps.SkipLE(f)
+	p, _ := f.Seek(0, 1)
+	if !pd.endstreamAt(p + int64(l)) {
+		l = pd.streamLength(p)
+	}
+	limits.Check("MaxStreamSize", int64(l), pd.opts.Limits.MaxStreamSize)
+	f.Seek(p, 0)
+	return dic, f.Slice(l)
 }
 
 // DecodedStream returns decoded contents of a stream.
 func (pd *PDFReader) DecodedStream(reference []byte) (Dictionary, []byte) {
+	return pd.decodedStreamCached(context.Background(), reference)
+}
+
+// DecodedStreamContext is DecodedStream returning exceeded limits and the
+// end of ctx as error.
+func (pd *PDFReader) DecodedStreamContext(ctx context.Context, reference []byte) (dic Dictionary, data []byte, err error) {
+	defer limits.Catch(&err)
+	limits.Context(ctx)
+	dic, data = pd.decodedStreamCached(ctx, reference)
+	return
+}
+
+func (pd *PDFReader) decodedStreamCached(ctx context.Context, reference []byte) (Dictionary, []byte) {
+	if pd.opts.CacheStreams {
+		if s, ok := pd.objs.Get("S" + string(reference)); ok {
+			return s.(streamT).dic, s.(streamT).data
+		}
+	}
+	dic, data := pd.decodedStream(ctx, reference)
+	if pd.opts.CacheStreams {
+		pd.objs.Put("S"+string(reference), streamT{dic, data},
+			len(reference)+dictionarySize(dic)+len(data))
+	}
+	return dic, data
+}
+
+func (pd *PDFReader) decodedStream(ctx context.Context, reference []byte) (Dictionary, []byte) {
+	max := pd.opts.Limits.MaxStreamSize
 	dic, data := pd.stream(reference)
 	if f, ok := dic["/Filter"]; ok {
 		filter := pd.ForcedArray(f)
 		var decos [][]byte
-		if d, ok := dic["/DecodeParams"]; ok {
+		if d, ok := dic["/DecodeParms"]; ok {
+			decos = pd.ForcedArray(d)
+		} else if d, ok := dic["/DecodeParams"]; ok {
 			decos = pd.ForcedArray(d)
-		} else {
-			decos = make([][]byte, len(filter))
 		}
 		for ff := range filter {
-			deco := pd.Dic(decos[ff])
+			var deco Dictionary
+			if ff < len(decos) {
+				deco = pd.Dic(decos[ff])
+			}
 			switch string(filter[ff]) {
 			case "/FlateDecode":
-				data = fancy.ReadAndClose(zlib.NewReader(fancy.SliceReader(data)))
+				data = pd.predict(inflate(ctx, data, max), deco)
 			case "/LZWDecode":
 				early := true
 				if deco != nil {
@@ -400,7 +617,10 @@ func (pd *PDFReader) DecodedStream(reference []byte) (Dictionary, []byte) {
 						early = pd.num(s) == 1
 					}
 				}
-				data = lzw.Decode(data, early)
+				limits.Check("MaxStreamSize", int64(lzw.CalculateLength(data, early)), max)
+				data = pd.predict(lzw.Decode(data, early), deco)
+			case "/DCTDecode":
+				data = dct(data, max)
 			case "/ASCII85Decode":
 				ds := data
 				for len(ds) > 1 && ds[len(ds)-1] < 33 {
@@ -415,11 +635,23 @@ func (pd *PDFReader) DecodedStream(reference []byte) (Dictionary, []byte) {
 			default:
 				data = []byte{}
 			}
+			limits.Context(ctx)
 		}
 	}
 	return dic, data
 }
 
+// inflate() decodes /FlateDecode data with at most max bytes of output.
+func inflate(ctx context.Context, data []byte, max int64) []byte {
+	z, err := zlib.NewReader(fancy.SliceReader(data))
+	if err != nil {
+		return []byte{}
+	}
+	defer z.Close()
+	r, _ := io.ReadAll(limits.Reader(ctx, z, "MaxStreamSize", max))
+	return r
+}
+
 // PageFonts returns references to the fonts defined for a page.
 func (pd *PDFReader) PageFonts(page []byte) Dictionary {
 	fonts, _ := pd.Dic(pd.attribute("/Resources", page))["/Font"]
@@ -429,29 +661,67 @@ func (pd *PDFReader) PageFonts(page []byte) Dictionary {
 	return pd.Dic(fonts)
 }
 
-// Load() loads a PDF file of a given name.
+// xrefLoad() reads xref table(s) and trailer as announced by "startxref".
+func (pd *PDFReader) xrefLoad() bool {
+	f := pd.cursor()
+	if pd.Startxref = xrefStart(f); pd.Startxref == -1 {
+		return false
+	}
+	if pd.Xref = xrefRead(f, pd.Startxref); pd.Xref == nil {
+		return false
+	}
+	f.Seek(int64(xrefSkip(f, pd.Startxref)), 0)
+	s, _ := ps.Token(f)
+	if string(s) != "trailer" {
+		return false
+	}
+	s, _ = ps.Token(f)
+	pd.Trailer = dictionary(s)
+	return pd.Trailer != nil
+}
+
+// pd.Limits() queries the resource limits of the reader.
+func (pd *PDFReader) Limits() limits.Limits {
+	return pd.opts.Limits
+}
+
+// pd.CacheStats() queries statistics of the object cache.
+func (pd *PDFReader) CacheStats() cache.StatsT {
+	return pd.objs.Stats()
+}
+
+// pd.Reset() drops all cached data of the reader.
+func (pd *PDFReader) Reset() {
+	pd.objs.Reset()
+	pd.pagesMu.Lock()
+	pd.pages = nil
+	pd.pagesMu.Unlock()
+	if r, ok := pd.rdr.(interface{ Reset() }); ok {
+		r.Reset()
+	}
+}
+
+// Load() loads a PDF file of a given name. Files with a broken or missing
+// xref table are repaired by scanning the file for objects.
 func Load(fn string) *PDFReader {
+	return LoadWith(fn, nil)
+}
+
+// LoadWith() is Load() with options, opts may be nil.
+func LoadWith(fn string, opts *Options) *PDFReader {
 	r := new(PDFReader)
 	r.File = fn
-	r.rdr = fancy.FileReader(fn)
-	if r.Startxref = xrefStart(r.rdr); r.Startxref == -1 {
-		log.Fatalln(r.Startxref)
-		return nil
+	if opts != nil {
+		r.opts = *opts
 	}
-	if r.Xref = xrefRead(r.rdr, r.Startxref); r.Xref == nil {
-		return nil
+	if r.objs = r.opts.Cache; r.objs == nil {
+		r.objs = cache.NewLRU(0)
 	}
-	r.rdr.Seek(int64(xrefSkip(r.rdr, r.Startxref)), 0)
-	s, _ := ps.Token(r.rdr)
-	if string(s) != "trailer" {
+	if r.rdr = fancy.FileReaderN(fn, r.opts.SectorSize, r.opts.SectorCount); r.rdr == nil {
 		return nil
 	}
-	s, _ = ps.Token(r.rdr)
-	if r.Trailer = dictionary(s); r.Trailer == nil {
+	if !r.xrefLoad() && !r.Repair() {
 		return nil
 	}
-	r.rcache = make(map[string][]byte)
-	r.rncache = make(map[string]int)
-	r.dicache = make(map[string]Dictionary)
 	return r
 }
@@ -0,0 +1,46 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Structural validator for PDF files.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/grokify/pdfreader"
+)
+
+// The program takes PDF files and reports structural problems. The exit
+// status is 1 if an error was found in any of the files.
+
+func complain(err string) {
+	fmt.Printf("%susage: pdlint foo.pdf [bar.pdf ...]\n", err)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) == 1 {
+		complain("")
+	}
+	status := 0
+	for _, fn := range os.Args[1:] {
+		pd := pdfreader.Load(fn)
+		if pd == nil {
+			fmt.Printf("%s: error: could not load pdf file\n", fn)
+			status = 1
+			continue
+		}
+		for _, p := range pd.Validate() {
+			fmt.Printf("%s: %s\n", fn, p)
+			if p.Severity == pdfreader.SEV_ERROR {
+				status = 1
+			}
+		}
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Compare the SVG of PDF-pages with expected ones.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/svg"
+)
+
+// The program converts the pages of PDF files to SVG and compares them with
+// the expected SVG files in a directory, foo-1.svg for the first page of
+// foo.pdf. The first differing line of a page is shown and the exit status
+// is 1 then, also for files which can not be loaded. With -update the
+// expected files are written instead. The PDF files having expected files,
+// the examples at the root of the repository and the ones in testdata, are
+// checked by
+//
+//	go test ./pdsvgdiff
+
+const DEFAULT_DIR = "pdsvgdiff/testdata"
+
+func complain(err string) {
+	fmt.Printf("%susage: pdsvgdiff [-update] [-dir expected] foo.pdf...\n", err)
+	os.Exit(1)
+}
+
+// firstDiff() returns the number and the lines of the first difference of
+// a and b.
+func firstDiff(a, b []byte) (int, string, string) {
+	la, lb := strings.Split(string(a), "\n"), strings.Split(string(b), "\n")
+	for k := 0; ; k++ {
+		switch {
+		case k >= len(la) && k >= len(lb):
+			return 0, "", ""
+		case k >= len(la):
+			return k + 1, "", lb[k]
+		case k >= len(lb):
+			return k + 1, la[k], ""
+		case la[k] != lb[k]:
+			return k + 1, la[k], lb[k]
+		}
+	}
+}
+
+// compare() compares the pages of a PDF file with the expected SVG files in
+// dir, or writes them with update, and returns the problems found. Files
+// which can not be loaded are a problem.
+func compare(fn, dir string, update bool) (r []string) {
+	pd := pdfreader.Load(fn)
+	if pd == nil {
+		return []string{fn + ": could not load"}
+	}
+	base := strings.TrimSuffix(filepath.Base(fn), filepath.Ext(fn))
+	for k := range pd.Pages() {
+		name := filepath.Join(dir, fmt.Sprintf("%s-%d.svg", base, k+1))
+		got := svg.PageWith(pd, k, nil)
+		if update {
+			if err := os.WriteFile(name, got, 0644); err != nil {
+				r = append(r, err.Error())
+			}
+			continue
+		}
+		want, err := os.ReadFile(name)
+		if err != nil {
+			r = append(r, err.Error())
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			n, g, w := firstDiff(got, want)
+			r = append(r, fmt.Sprintf("%s page %d differs from %s at line %d:\n-%s\n+%s", fn, k+1, name, n, w, g))
+		}
+	}
+	return
+}
+
+func main() {
+	args := os.Args[1:]
+	update := false
+	dir := DEFAULT_DIR
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		switch args[0] {
+		case "-update":
+			update = true
+		case "-dir":
+			if len(args) < 2 {
+				complain("")
+			}
+			dir = args[1]
+			args = args[1:]
+		default:
+			complain("Unknown option " + args[0] + "\n\n")
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		complain("")
+	}
+	failed := false
+	for _, fn := range args {
+		for _, p := range compare(fn, dir, update) {
+			fmt.Printf("%s\n", p)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// the expected files are named by the PDF file and the page.
+var expected = regexp.MustCompile(`^(.+)-[0-9]+\.svg$`)
+
+// TestSvg compares the pages of the PDF files having expected SVG files in
+// testdata, the PDF files are in testdata or at the root of the repository.
+// example-1.5.pdf has none: it uses cross-reference streams, which the
+// reader does not support, and can not be loaded.
+func TestSvg(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.svg")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no expected files: %v", err)
+	}
+	done := make(map[string]bool)
+	for _, name := range files {
+		m := expected.FindStringSubmatch(filepath.Base(name))
+		if m == nil || done[m[1]] {
+			continue
+		}
+		done[m[1]] = true
+		fn := filepath.Join("testdata", m[1]+".pdf")
+		if _, err := os.Stat(fn); err != nil {
+			fn = filepath.Join("..", m[1]+".pdf")
+		}
+		for _, p := range compare(fn, "testdata", false) {
+			t.Error(p)
+		}
+	}
+}
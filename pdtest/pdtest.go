@@ -5,12 +5,52 @@ import (
 	"os"
 
 	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/optcontent"
+	"github.com/grokify/pdfreader/structure"
 )
 
 // Example program for pdfread.go
 
 // The program takes a PDF file as argument and writes the MediaBoxes and
-// defined fonts of the pages.
+// defined fonts of the pages, the optional content groups (layers) and the
+// logical structure of tagged documents.
+
+func printLayers(order []optcontent.OrderT, indent string) {
+	for _, o := range order {
+		if o.Group == nil {
+			fmt.Printf("%s%s\n", indent, o.Label)
+		} else {
+			state := "off"
+			if o.Group.Visible {
+				state = "on"
+			}
+			fmt.Printf("%sLayer \"%s\" %s (%s)\n", indent, o.Group.Name, state, o.Group.Ref)
+		}
+		printLayers(o.Kids, indent+"  ")
+	}
+}
+
+func printStructure(e *structure.ElementT, indent string) {
+	for _, k := range e.Kids {
+		if k.Type == "" {
+			continue
+		}
+		fmt.Printf("%s%s", indent, k.Type)
+		if k.Tag != k.Type {
+			fmt.Printf(" (%s)", k.Tag)
+		}
+		if k.Alt != "" {
+			fmt.Printf(" alt \"%s\"", k.Alt)
+		} else if k.Type == "/Figure" || k.Type == "/Formula" {
+			fmt.Printf(" without alt")
+		}
+		if k.ActualText != "" {
+			fmt.Printf(" text \"%s\"", k.ActualText)
+		}
+		fmt.Printf("\n")
+		printStructure(k, indent+"  ")
+	}
+}
 
 func main() {
 	pd := pdfreader.Load(os.Args[1])
@@ -26,5 +66,9 @@ func main() {
 					l, fontname[1:])
 			}
 		}
+		printLayers(optcontent.New(pd).Order, "")
+		if t := structure.New(pd); t.Root != nil {
+			printStructure(t.Root, "")
+		}
 	}
 }
@@ -13,31 +13,84 @@ import (
 	"os"
 
 	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/icc"
+	"github.com/grokify/pdfreader/optcontent"
 	"github.com/grokify/pdfreader/strm"
 	"github.com/grokify/pdfreader/svg"
 )
 
-// The program takes a PDF file and converts a page to SVG.
+// The program takes a PDF file and converts a page to SVG. With -fonts the
+// embedded fonts are included, with -outlines text is drawn as glyph
+// outlines. -icc converts colors by embedded ICC profiles, -cmyk by the
+// given profile for DeviceCMYK. -show and -hide switch the optional content
+// group (layer) of a name, in the order given.
+
+// layerT is a -show or -hide option.
+type layerT struct {
+	name string
+	on   bool
+}
 
 func complain(err string) {
-	fmt.Printf("%susage: pdtosvg foo.pdf [page] >foo.svg\n", err)
+	fmt.Printf("%susage: pdtosvg [-fonts] [-outlines] [-icc] [-cmyk profile.icc] [-show layer] [-hide layer] foo.pdf [page] >foo.svg\n", err)
 	os.Exit(1)
 }
 
 func main() {
-	if len(os.Args) == 1 || len(os.Args) > 3 {
+	args := os.Args[1:]
+	opts := &svg.Options{}
+	var layers []layerT
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		switch args[0] {
+		case "-fonts":
+			opts.EmbedFonts = true
+		case "-outlines":
+			opts.OutlineText = true
+		case "-icc":
+			opts.ICC = true
+		case "-cmyk":
+			if len(args) < 2 {
+				complain("")
+			}
+			data, _ := os.ReadFile(args[1])
+			if opts.CMYKProfile = icc.Read(data); opts.CMYKProfile == nil {
+				complain("Could not read profile " + args[1] + "\n\n")
+			}
+			args = args[1:]
+		case "-show", "-hide":
+			if len(args) < 2 {
+				complain("")
+			}
+			layers = append(layers, layerT{args[1], args[0] == "-show"})
+			args = args[1:]
+		default:
+			complain("Unknown option " + args[0] + "\n\n")
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args) > 2 {
 		complain("")
 	}
 	page := 0
-	if len(os.Args) > 2 {
-		page = strm.Int(os.Args[2], 1) - 1
+	if len(args) > 1 {
+		page = strm.Int(args[1], 1) - 1
 		if page < 0 {
 			complain("Bad page!\n\n")
 		}
 	}
-	pd := pdfreader.Load(os.Args[1])
+	pd := pdfreader.Load(args[0])
 	if pd == nil {
 		complain("Could not load pdf file!\n\n")
 	}
-	fmt.Printf("%s", svg.Page(pd, page))
+	if len(layers) > 0 {
+		opts.Layers = optcontent.New(pd)
+		for _, l := range layers {
+			g := opts.Layers.Group(l.name)
+			if g == nil {
+				complain("No layer " + l.name + "!\n\n")
+			}
+			opts.Layers.SetVisible(g, l.on)
+		}
+	}
+	fmt.Printf("%s", svg.PageWith(pd, page, opts))
 }
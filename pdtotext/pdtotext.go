@@ -0,0 +1,44 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Extract the text of PDF files.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/structure"
+)
+
+// The program takes a PDF file and writes its text. Tagged documents are
+// written in the logical order of their structure without artifacts like
+// page headers, the others page by page in the order of the content.
+
+func complain(err string) {
+	fmt.Printf("%susage: pdtotext foo.pdf >foo.txt\n", err)
+	os.Exit(1)
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		complain("")
+	}
+	pd := pdfreader.Load(os.Args[1])
+	if pd == nil {
+		complain("Could not load pdf file!\n\n")
+	}
+	if t := structure.New(pd); t.Root != nil {
+		fmt.Printf("%s", t.Text())
+		return
+	}
+	for k := range pd.Pages() {
+		fmt.Printf("%s\n", strings.TrimSpace(structure.PageText(pd, k)[-1]))
+	}
+}
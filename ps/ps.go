@@ -11,6 +11,7 @@ package ps
 import (
 	"github.com/grokify/pdfreader/fancy"
 	"github.com/grokify/pdfreader/hex"
+	"github.com/grokify/pdfreader/limits"
 )
 
 func SkipLE(f fancy.Reader) {
@@ -92,17 +93,55 @@ func skipComment(f fancy.Reader) {
 	}
 }
 
-func skipComposite(f fancy.Reader) {
+// skipHex() skips a hexadecimal string after its '<'.
+func skipHex(f fancy.Reader) {
+	for {
+		c, err := f.ReadByte()
+		if err != nil || c == '>' {
+			return
+		}
+	}
+}
+
+// next() tells if the next byte is c and skips it then.
+func next(f fancy.Reader, c byte) bool {
+	n, err := f.ReadByte()
+	if err != nil {
+		return false
+	}
+	if n != c {
+		f.UnreadByte()
+	}
+	return n == c
+}
+
+// skipComposite() skips an array, procedure or dictionary after its
+// opening delimiter, << and >> count once for the depth.
+func skipComposite(f fancy.Reader, maxDepth int) {
 	for depth := 1; depth > 0; {
 		switch skipToDelim(f) {
-		case '<', '[', '{':
+		case '<':
+			if !next(f, '<') {
+				skipHex(f)
+				break
+			}
+			depth++
+			limits.Check("MaxDepth", int64(depth), int64(maxDepth))
+		case '[', '{':
 			depth++
-		case '>', ']', '}':
+			limits.Check("MaxDepth", int64(depth), int64(maxDepth))
+		case '>':
+			if next(f, '>') {
+				depth--
+			}
+		case ']', '}':
 			depth--
 		case '(':
 			skipString(f)
 		case '%':
 			skipComment(f)
+		case 255:
+			return
 		}
 	}
 }
@@ -113,6 +152,12 @@ func fpos(f fancy.Reader) int64 {
 }
 
 func Token(f fancy.Reader) ([]byte, int64) {
+	return TokenN(f, 0)
+}
+
+// TokenN() is Token() aborting with a limits.Error if composite objects
+// are nested deeper than maxDepth (if > 0).
+func TokenN(f fancy.Reader, maxDepth int) ([]byte, int64) {
 again:
 	c := skipSpaces(f)
 	if c == 0 {
@@ -123,8 +168,14 @@ again:
 	case '%':
 		skipComment(f)
 		goto again
-	case '<', '[', '{':
-		skipComposite(f)
+	case '<':
+		if next(f, '<') {
+			skipComposite(f, maxDepth)
+		} else {
+			skipHex(f)
+		}
+	case '[', '{':
+		skipComposite(f, maxDepth)
 	case '(':
 		skipString(f)
 	default:
@@ -0,0 +1,194 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package pdfreader
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/ps"
+)
+
+// Repair mode: the xref table is rebuilt by a linear scan of the file.
+
+const _REPAIR_CHUNK = 4096
+
+var (
+	objHeader  = regexp.MustCompile("([0-9]+)[\x00\t\n\f\r ]+([0-9]+)[\x00\t\n\f\r ]+obj")
+	trailerKey = regexp.MustCompile("trailer[\x00\t\n\f\r ]*<<")
+)
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isRegular(c byte) bool {
+	if c <= 32 {
+		return false
+	}
+	switch c {
+	case '<', '>', '(', ')', '[', ']', '/', '%', '{', '}':
+		return false
+	}
+	return true
+}
+
+// scanObjects() finds all "N G obj" headers of a PDF file. Later
+// definitions of an object win like they do for incremental updates.
+func scanObjects(pdf []byte) (xref, gen map[int]int) {
+	xref = make(map[int]int)
+	gen = make(map[int]int)
+	for _, m := range objHeader.FindAllSubmatchIndex(pdf, -1) {
+		if m[0] > 0 && (isDigit(pdf[m[0]-1]) || isRegular(pdf[m[0]-1])) {
+			continue
+		}
+		if m[1] < len(pdf) && isRegular(pdf[m[1]]) {
+			continue
+		}
+		o := num(pdf[m[2]:m[3]])
+		xref[o] = m[0]
+		gen[o] = num(pdf[m[4]:m[5]])
+	}
+	return
+}
+
+// scanTrailers() merges all trailer dictionaries of a PDF file, later ones
+// overriding earlier ones.
+func scanTrailers(pdf []byte) Dictionary {
+	var r Dictionary
+	for _, m := range trailerKey.FindAllIndex(pdf, -1) {
+		t, _ := ps.Token(fancy.SliceReader(pdf[m[1]-2:]))
+		d := dictionary(t)
+		if d == nil {
+			continue
+		}
+		if r == nil {
+			r = make(Dictionary)
+		}
+		for k := range d {
+			r[k] = d[k]
+		}
+	}
+	if r != nil {
+		delete(r, "/Prev")
+		delete(r, "/XRefStm")
+	}
+	return r
+}
+
+// findCatalog() searches all objects for the document catalog. Of several
+// catalogs the one with the highest object number wins, like the last
+// incremental update.
+func findCatalog(f fancy.Reader, xref, gen map[int]int) []byte {
+	objs := make([]int, 0, len(xref))
+	for o := range xref {
+		objs = append(objs, o)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(objs)))
+	for _, o := range objs {
+		_, s, _ := objectAt(f, xref[o], o, 0)
+		if d := dictionary(s); d != nil && string(d["/Type"]) == "/Catalog" {
+			return []byte(fmt.Sprintf("%d %d R", o, gen[o]))
+		}
+	}
+	return nil
+}
+
+// pd.Repair() rebuilds the xref table by scanning the whole file for object
+// headers and trailer dictionaries. If no usable /Root is found in a
+// trailer, the catalog is located by its /Type. Repair() is done at most
+// once for a reader and reports whether the xref table was rebuilt, which
+// needs objects and a document root.
+func (pd *PDFReader) Repair() bool {
+	pd.repairMu.Lock()
+	defer pd.repairMu.Unlock()
+	if pd.repairDone {
+		return pd.repaired()
+	}
+	pd.repairDone = true
+	pdf := make([]byte, pd.rdr.Size())
+	pd.rdr.ReadAt(pdf, 0)
+	xref, gen := scanObjects(pdf)
+	trailer := scanTrailers(pdf)
+	if trailer == nil {
+		trailer = make(Dictionary)
+	}
+	r, ok := trailer["/Root"]
+	if ok {
+		_, ok = xref[num(r)]
+	}
+	if !ok {
+		delete(trailer, "/Root")
+		if r = findCatalog(pd.cursor(), xref, gen); r != nil {
+			trailer["/Root"] = r
+		}
+	}
+	if len(xref) == 0 || trailer["/Root"] == nil {
+		return false
+	}
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	pd.Repaired = true
+	pd.Xref = xref
+	pd.Trailer = trailer
+	pd.objs.Reset()
+	return true
+}
+
+// pd.endstreamAt() checks if the keyword "endstream" follows position p.
+func (pd *PDFReader) endstreamAt(p int64) bool {
+	if p > pd.rdr.Size() {
+		return false
+	}
+	f := pd.cursor()
+	f.Seek(p, 0)
+	t, _ := ps.Token(f)
+	return string(t) == "endstream"
+}
+
+// pd.streamLength() recovers the length of stream data starting at p by
+// searching for "endstream" at the start of a line. The end of line before
+// it is not part of the data.
+func (pd *PDFReader) streamLength(p int64) int {
+	key := []byte("endstream")
+	size := pd.rdr.Size()
+	buf := make([]byte, _REPAIR_CHUNK+len(key)+1)
+	for q := p; q < size; q += _REPAIR_CHUNK {
+		n, _ := pd.rdr.ReadAt(buf[0:min(len(buf), int(size-q))], q)
+		for i := 0; i < n; i++ {
+			j := bytes.Index(buf[i:n], key)
+			if j < 0 {
+				break
+			}
+			i += j
+			l := int(q-p) + i
+			if i+len(key) < n && isRegular(buf[i+len(key)]) {
+				continue
+			}
+			if l == 0 {
+				return 0
+			}
+			if c := pdfByte(pd.rdr, p+int64(l)-1); c != 10 && c != 13 {
+				continue
+			}
+			if l--; l > 0 && pdfByte(pd.rdr, p+int64(l)) == 10 &&
+				pdfByte(pd.rdr, p+int64(l)-1) == 13 {
+				l--
+			}
+			return l
+		}
+	}
+	return int(size - p)
+}
+
+func pdfByte(f fancy.Reader, p int64) byte {
+	b := []byte{0}
+	f.ReadAt(b, p)
+	return b[0]
+}
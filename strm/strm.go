@@ -92,23 +92,28 @@ func String(a int64, f int) string {
 	return string(buf[0:p])
 }
 
+// MUL_PRECISION limits the fractional digits of products.
+const MUL_PRECISION = 1000000
+
 func Mul(a, b string) string {
-	ra, _, f := twop(a, b)
-	ar := big.NewRat(ra, int64(f))
-	// br := big.NewRat(rb, int64(f))
-	i := ar.Num()
-	n := ar.Denom()
-	nv := n.Int64()
-	d := int64(1)
-	for d%nv != 0 {
-		d *= 10
-	}
-	i = i.Mul(i, big.NewInt(d/nv))
-	if int64(f) < d {
-		i = i.Div(i, big.NewInt(d/int64(f)))
-		d = int64(f)
-	}
-	return String(i.Int64(), int(d))
+	ra, fa := operand(a)
+	rb, fb := operand(b)
+	i := big.NewInt(ra)
+	i.Mul(i, big.NewInt(rb))
+	f := big.NewInt(int64(fa))
+	f.Mul(f, big.NewInt(int64(fb)))
+	ten := big.NewInt(10)
+	m := new(big.Int)
+	for f.Cmp(ten) >= 0 {
+		if f.Cmp(big.NewInt(MUL_PRECISION)) <= 0 {
+			if m.Rem(i, ten); m.Sign() != 0 {
+				break
+			}
+		}
+		i.Quo(i, ten)
+		f.Quo(f, ten)
+	}
+	return String(i.Int64(), int(f.Int64()))
 }
 
 func Add(a, b string) string {
@@ -0,0 +1,128 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package structure
+
+import (
+	"context"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/svg"
+)
+
+// MarkedT is a marked-content sequence.
+type MarkedT struct {
+	Tag        string               // like /P or /Artifact
+	Properties pdfreader.Dictionary // nil for BMC
+	MCID       int                  // -1 if there is none
+}
+
+// MarkerT is a graf.DocumentMarker keeping the open marked-content
+// sequences. Names of properties are resolved by the /Properties of the
+// page, forms with their own ones have none.
+type MarkerT struct {
+	Pdf        *pdfreader.PDFReader
+	Marked     []MarkedT        // the open sequences, the innermost last
+	Begin, End func(m *MarkerT) // after BDC and BMC, before EMC, may be nil
+	Point      func(m MarkedT)  // for DP and MP, may be nil
+	properties pdfreader.Dictionary
+}
+
+// NewMarker() returns a marker for content with a /Resources dictionary.
+func NewMarker(pd *pdfreader.PDFReader, resources []byte) *MarkerT {
+	m := &MarkerT{Pdf: pd}
+	if resources != nil {
+		m.properties = pd.Dic(pd.Dic(resources)["/Properties"])
+	}
+	return m
+}
+
+// m.marked() reads the operands of a marked-content operator.
+func (m *MarkerT) marked(tag, properties []byte) MarkedT {
+	r := MarkedT{Tag: string(tag), MCID: -1}
+	if properties == nil {
+		return r
+	}
+	if properties[0] == '/' {
+		properties = m.properties[string(properties)]
+	}
+	r.Properties = m.Pdf.Dic(properties)
+	if mcid, ok := r.Properties["/MCID"]; ok {
+		r.MCID = int(number(m.Pdf, mcid))
+	}
+	return r
+}
+
+func (m *MarkerT) BeginMarked(tag, properties []byte) {
+	m.Marked = append(m.Marked, m.marked(tag, properties))
+	if m.Begin != nil {
+		m.Begin(m)
+	}
+}
+
+func (m *MarkerT) EndMarked() {
+	if len(m.Marked) == 0 {
+		return
+	}
+	if m.End != nil {
+		m.End(m)
+	}
+	m.Marked = m.Marked[:len(m.Marked)-1]
+}
+
+func (m *MarkerT) MarkPoint(tag, properties []byte) {
+	if m.Point != nil {
+		m.Point(m.marked(tag, properties))
+	}
+}
+
+// m.MCID() returns the MCID of the innermost sequence having one, -1 if
+// there is none.
+func (m *MarkerT) MCID() int {
+	for k := len(m.Marked) - 1; k >= 0; k-- {
+		if m.Marked[k].MCID >= 0 {
+			return m.Marked[k].MCID
+		}
+	}
+	return -1
+}
+
+// PageText() returns the text of a page by the MCID of its marked content,
+// the text of no MCID by -1. Marked content with /ActualText has this text.
+// Pages exceeding the limits of pd have the text up to there.
+func PageText(pd *pdfreader.PDFReader, page int) map[int]string {
+	r := make(map[int][]byte)
+	pg := pd.Pages()
+	if page < 0 || page >= len(pg) {
+		return nil
+	}
+	m := NewMarker(pd, pd.Att("/Resources", pg[page]))
+	actual := 0 // the depth of the sequence with /ActualText, 0 for none
+	m.Begin = func(m *MarkerT) {
+		t, ok := m.Marked[len(m.Marked)-1].Properties["/ActualText"]
+		if actual == 0 && ok {
+			actual = len(m.Marked)
+			r[m.MCID()] = append(r[m.MCID()], text(pd, t)...)
+		}
+	}
+	m.End = func(m *MarkerT) {
+		if actual == len(m.Marked) {
+			actual = 0
+		}
+	}
+	opts := &svg.Options{Marker: m, TextOut: func(text []byte) {
+		if actual == 0 {
+			r[m.MCID()] = append(r[m.MCID()], text...)
+		}
+	}}
+	svg.PageContextWith(context.Background(), pd, page, opts)
+	texts := make(map[int]string)
+	for k, v := range r {
+		texts[k] = string(v)
+	}
+	return texts
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// Logical structure of tagged PDF documents.
+//
+// The structure tree of /StructTreeRoot is read into elements with their
+// types mapped by /RoleMap to the standard ones. Marked content of the pages
+// is tied to the elements by MCID, see marker.go, so the text can be
+// extracted in the logical order.
+package structure
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/ps"
+	"github.com/grokify/pdfreader/util"
+)
+
+// structure trees and number trees contain themselves.
+const MAX_DEPTH = 256
+
+// the standard structure types, the ones /RoleMap maps to.
+var standard = map[string]bool{
+	"/Document": true, "/Part": true, "/Art": true, "/Sect": true, "/Div": true,
+	"/BlockQuote": true, "/Caption": true, "/TOC": true, "/TOCI": true,
+	"/Index": true, "/NonStruct": true, "/Private": true, "/P": true,
+	"/H": true, "/H1": true, "/H2": true, "/H3": true, "/H4": true,
+	"/H5": true, "/H6": true, "/L": true, "/LI": true, "/Lbl": true,
+	"/LBody": true, "/Table": true, "/TR": true, "/TH": true, "/TD": true,
+	"/THead": true, "/TBody": true, "/TFoot": true, "/Span": true,
+	"/Quote": true, "/Note": true, "/Reference": true, "/BibEntry": true,
+	"/Code": true, "/Link": true, "/Annot": true, "/Ruby": true, "/RB": true,
+	"/RT": true, "/RP": true, "/Warichu": true, "/WT": true, "/WP": true,
+	"/Figure": true, "/Formula": true, "/Form": true,
+}
+
+// the types of elements within lines of text.
+var inline = map[string]bool{
+	"/Span": true, "/Quote": true, "/Note": true, "/Reference": true,
+	"/BibEntry": true, "/Code": true, "/Link": true, "/Annot": true,
+	"/Ruby": true, "/RB": true, "/RT": true, "/RP": true, "/Warichu": true,
+	"/WT": true, "/WP": true, "/Lbl": true,
+}
+
+// ElementT is a structure element, or marked content or an object of one
+// if Type is "".
+type ElementT struct {
+	Type       string // by /S and /RoleMap, like /P, /H1 or /Figure
+	Tag        string // /S, the type used in the document
+	Ref        string // the reference of the element, "" if it has none
+	Title      string // /T
+	Lang       string // /Lang
+	Alt        string // /Alt, the description of figures and formulas
+	ActualText string // /ActualText, the text replacing the content
+	Page       int    // of /Pg, -1 if unknown
+	MCID       int    // of marked content, -1 for others
+	Obj        string // the reference of an object like an annotation
+	Parent     *ElementT
+	Kids       []*ElementT
+}
+
+type TreeT struct {
+	Pdf     *pdfreader.PDFReader
+	Root    *ElementT         // with the top elements as kids, nil if not tagged
+	RoleMap map[string]string // /RoleMap of the structure tree root
+	refs    map[string]*ElementT
+	pages   map[string]int // page numbers by reference
+	parents map[int][]byte // /ParentTree
+	texts   map[int]map[int]string
+}
+
+func text(pd *pdfreader.PDFReader, o []byte) string {
+	if o = pd.Obj(o); len(o) == 0 || o[0] != '(' && o[0] != '<' {
+		return ""
+	}
+	return util.TextString(ps.String(o))
+}
+
+// New() reads the structure tree of a document.
+func New(pd *pdfreader.PDFReader) *TreeT {
+	t := &TreeT{Pdf: pd, RoleMap: make(map[string]string), refs: make(map[string]*ElementT),
+		pages: make(map[string]int), parents: make(map[int][]byte), texts: make(map[int]map[int]string)}
+	root, ok := pd.Catalog()["/StructTreeRoot"]
+	if !ok {
+		return t
+	}
+	for k, p := range pd.Pages() {
+		t.pages[pdfreader.Ref(p)] = k
+	}
+	d := pd.Dic(root)
+	for k, v := range pd.Dic(d["/RoleMap"]) {
+		t.RoleMap[k] = string(pd.Obj(v))
+	}
+	t.numbers(d["/ParentTree"], 0)
+	t.Root = &ElementT{Type: "/StructTreeRoot", Tag: "/StructTreeRoot", Ref: pdfreader.Ref(root), Page: -1, MCID: -1}
+	t.kids(t.Root, d["/K"], 0)
+	return t
+}
+
+// t.numbers() reads a number tree into t.parents.
+func (t *TreeT) numbers(o []byte, depth int) {
+	if depth >= MAX_DEPTH {
+		return
+	}
+	d := t.Pdf.Dic(o)
+	nums := t.Pdf.Arr(d["/Nums"])
+	for k := 0; k+1 < len(nums); k += 2 {
+		t.parents[int(number(t.Pdf, nums[k]))] = nums[k+1]
+	}
+	for _, kid := range t.Pdf.Arr(d["/Kids"]) {
+		t.numbers(kid, depth+1)
+	}
+}
+
+// number() reads an integer, -1 for others.
+func number(pd *pdfreader.PDFReader, o []byte) int64 {
+	n, err := strconv.ParseInt(string(pd.Obj(o)), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// t.page() returns the page number of a /Pg entry, page if there is none.
+func (t *TreeT) page(o []byte, page int) int {
+	if p, ok := t.pages[pdfreader.Ref(o)]; ok {
+		return p
+	}
+	return page
+}
+
+// t.role() maps a type by /RoleMap to a standard one.
+func (t *TreeT) role(s string) string {
+	for k := 0; k < 16 && !standard[s]; k++ {
+		r, ok := t.RoleMap[s]
+		if !ok {
+			break
+		}
+		s = r
+	}
+	return s
+}
+
+// t.kids() reads /K of an element into its kids.
+func (t *TreeT) kids(e *ElementT, o []byte, depth int) {
+	if depth >= MAX_DEPTH {
+		return
+	}
+	for _, k := range t.Pdf.ForcedArray(o) {
+		if n := number(t.Pdf, k); n >= 0 {
+			e.Kids = append(e.Kids, &ElementT{Page: e.Page, MCID: int(n), Parent: e})
+			continue
+		}
+		d := t.Pdf.Dic(k)
+		_, mcr := d["/MCID"]
+		switch {
+		case mcr && d["/Stm"] != nil:
+			// marked content of a form, its text is not known by page.
+			e.Kids = append(e.Kids, &ElementT{Page: -1, MCID: int(number(t.Pdf, d["/MCID"])), Parent: e})
+			continue
+		case mcr:
+			e.Kids = append(e.Kids, &ElementT{Page: t.page(d["/Pg"], e.Page),
+				MCID: int(number(t.Pdf, d["/MCID"])), Parent: e})
+			continue
+		case d["/Obj"] != nil:
+			e.Kids = append(e.Kids, &ElementT{Page: t.page(d["/Pg"], e.Page), MCID: -1,
+				Obj: pdfreader.Ref(d["/Obj"]), Parent: e})
+			continue
+		}
+		s, ok := d["/S"]
+		if !ok {
+			continue
+		}
+		r := pdfreader.Ref(k)
+		if _, done := t.refs[r]; done && r != "" {
+			continue
+		}
+		tag := string(t.Pdf.Obj(s))
+		kid := &ElementT{Type: t.role(tag), Tag: tag, Ref: r,
+			Title: text(t.Pdf, d["/T"]), Lang: text(t.Pdf, d["/Lang"]),
+			Alt: text(t.Pdf, d["/Alt"]), ActualText: text(t.Pdf, d["/ActualText"]),
+			Page: t.page(d["/Pg"], e.Page), MCID: -1, Parent: e}
+		if r != "" {
+			t.refs[r] = kid
+		}
+		e.Kids = append(e.Kids, kid)
+		t.kids(kid, d["/K"], depth+1)
+	}
+}
+
+// t.Element() returns the element of marked content of a page by
+// /StructParents and /ParentTree, nil if there is none.
+func (t *TreeT) Element(page, mcid int) *ElementT {
+	pg := t.Pdf.Pages()
+	if t.Root == nil || page < 0 || page >= len(pg) || mcid < 0 {
+		return nil
+	}
+	key := number(t.Pdf, t.Pdf.Dic(pg[page])["/StructParents"])
+	if key < 0 {
+		return nil
+	}
+	parents := t.Pdf.Arr(t.parents[int(key)])
+	if mcid >= len(parents) {
+		return nil
+	}
+	return t.refs[pdfreader.Ref(parents[mcid])]
+}
+
+// t.Find() returns the elements of the types in the logical order, like
+// Find("/H1", "/H2") for the outline of headings.
+func (t *TreeT) Find(types ...string) (r []*ElementT) {
+	want := make(map[string]bool)
+	for _, s := range types {
+		want[s] = true
+	}
+	var walk func(e *ElementT)
+	walk = func(e *ElementT) {
+		for _, k := range e.Kids {
+			if want[k.Type] {
+				r = append(r, k)
+			}
+			walk(k)
+		}
+	}
+	if t.Root != nil {
+		walk(t.Root)
+	}
+	return
+}
+
+// t.pageText() returns the text of the marked content of a page by MCID.
+func (t *TreeT) pageText(page int) map[int]string {
+	if r, ok := t.texts[page]; ok {
+		return r
+	}
+	r := PageText(t.Pdf, page)
+	t.texts[page] = r
+	return r
+}
+
+// t.Text() returns the text of a tagged document in the logical order, one
+// line for each block like a paragraph or a row of a table with tabs
+// between the cells.
+func (t *TreeT) Text() string {
+	var r []byte
+	var walk func(e *ElementT)
+	walk = func(e *ElementT) {
+		switch {
+		case e.ActualText != "":
+			r = append(r, e.ActualText...)
+		case e.Type == "" && e.MCID >= 0 && e.Page >= 0:
+			r = append(r, strings.ReplaceAll(t.pageText(e.Page)[e.MCID], "\n", " ")...)
+		default:
+			for _, k := range e.Kids {
+				walk(k)
+			}
+		}
+		switch {
+		case e.Type == "" || inline[e.Type]:
+		case e.Type == "/TD" || e.Type == "/TH":
+			r = append(r, '\t')
+		case len(r) > 0 && r[len(r)-1] != '\n':
+			for len(r) > 0 && r[len(r)-1] == '\t' {
+				r = r[:len(r)-1]
+			}
+			r = append(r, '\n')
+		}
+	}
+	if t.Root != nil {
+		walk(t.Root)
+	}
+	lines := strings.Split(string(r), "\n")
+	for k := range lines {
+		cells := strings.Split(lines[k], "\t")
+		for c := range cells {
+			cells[c] = strings.Join(strings.Fields(cells[c]), " ")
+		}
+		lines[k] = strings.Join(cells, "\t")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -9,13 +9,23 @@
 package svg
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/colorspace"
+	"github.com/grokify/pdfreader/extgstate"
 	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/graf"
+	"github.com/grokify/pdfreader/icc"
+	"github.com/grokify/pdfreader/limits"
+	"github.com/grokify/pdfreader/optcontent"
 	"github.com/grokify/pdfreader/strm"
 	"github.com/grokify/pdfreader/svgdraw"
+	"github.com/grokify/pdfreader/svgform"
+	"github.com/grokify/pdfreader/svgpattern"
 	"github.com/grokify/pdfreader/svgtext"
 	"github.com/grokify/pdfreader/util"
 )
@@ -25,14 +35,74 @@ func complain(err string) {
 	os.Exit(1)
 }
 
+var ErrNoPage = errors.New("page does not exist")
+
+// Options of the conversion, see PageWith().
+type Options struct {
+	EmbedFonts  bool          // embed the font programs as @font-face rules
+	OutlineText bool          // draw the glyphs of text as outlines
+	ICC         bool          // convert /ICCBased colors by their profiles
+	CMYKProfile *icc.ProfileT // for DeviceCMYK, nil converts naive
+	// the visibility of optional content, nil by the default configuration
+	// of the document.
+	Layers *optcontent.ContentT
+	Marker graf.DocumentMarker // observes the marked content
+	// TextOut gets the text shown, see svgtext.SvgTextT.
+	TextOut func(text []byte)
+}
+
 func Page(pd *pdfreader.PDFReader, page int) []byte {
+	r, err := PageContext(context.Background(), pd, page)
+	if err != nil {
+		complain(err.Error() + "\n")
+	}
+	return r
+}
+
+// PageWith() is Page() with options, opts may be nil.
+func PageWith(pd *pdfreader.PDFReader, page int, opts *Options) []byte {
+	r, err := PageContextWith(context.Background(), pd, page, opts)
+	if err != nil {
+		complain(err.Error() + "\n")
+	}
+	return r
+}
+
+// PageContext() converts a page like Page() does. Exceeded limits of pd and
+// the end of ctx are returned as error.
+func PageContext(ctx context.Context, pd *pdfreader.PDFReader, page int) ([]byte, error) {
+	return PageContextWith(ctx, pd, page, nil)
+}
+
+// PageContextWith() is PageContext() with options, opts may be nil.
+func PageContextWith(ctx context.Context, pd *pdfreader.PDFReader, page int, opts *Options) (r []byte, err error) {
+	defer limits.Catch(&err)
+	if opts == nil {
+		opts = &Options{}
+	}
 	pg := pd.Pages()
-	if page >= len(pg) {
-		complain("Page does not exist!\n")
+	if page < 0 || page >= len(pg) {
+		return nil, ErrNoPage
 	}
 	mbox := util.StringArray(pd.Arr(pd.Att("/MediaBox", pg[page])))
 	drw := svgdraw.NewTestSvg()
-	svgtext.New(pd, drw).Page = page
+	drw.Limits = pd.Limits()
+	drw.Spaces = colorspace.NewWith(pd, pd.Att("/Resources", pg[page]), &colorspace.Options{ICC: opts.ICC})
+	drw.GStates = extgstate.New(pd, pd.Att("/Resources", pg[page]))
+	drw.Draw.(*svgdraw.SvgT).CMYKProfile = opts.CMYKProfile
+	layers := opts.Layers
+	if layers == nil {
+		layers = optcontent.New(pd)
+	}
+	drw.Optional = layers.Resources(pd.Att("/Resources", pg[page]))
+	txt := svgtext.New(pd, drw)
+	txt.Page = page
+	txt.EmbedFonts = opts.EmbedFonts
+	txt.OutlineText = opts.OutlineText
+	txt.TextOut = opts.TextOut
+	drw.Marker = opts.Marker
+	svgpattern.New(pd, drw, pd.Att("/Resources", pg[page]))
+	svgform.New(pd, drw, pd.Att("/Resources", pg[page]))
 	w := strm.Mul(strm.Sub(mbox[2], mbox[0]), "1.25")
 	h := strm.Mul(strm.Sub(mbox[3], mbox[1]), "1.25")
 	drw.Write.Out(
@@ -40,17 +110,23 @@ func Page(pd *pdfreader.PDFReader, page int) []byte {
 			"<svg\n"+
 			"   xmlns:svg=\"http://www.w3.org/2000/svg\"\n"+
 			"   xmlns=\"http://www.w3.org/2000/svg\"\n"+
+			"   xmlns:xlink=\"http://www.w3.org/1999/xlink\"\n"+
 			"   version=\"1.0\"\n"+
 			"   width=\"%s\"\n"+
 			"   height=\"%s\">\n"+
-			"<g transform=\"matrix(1.25,0,0,-1.25,%s,%s)\">\n",
+			"<g transform=\"matrix(1.25,0,0,-1.25,%s,%s)\" stroke-miterlimit=\"10\">\n",
 		w, h,
 		strm.Mul(mbox[0], "-1.25"),
 		strm.Mul(mbox[3], "1.25"))
 	cont := pd.ForcedArray(pd.Dic(pg[page])["/Contents"])
-	_, ps := pd.DecodedStream(cont[0])
-	drw.Interpret(fancy.SliceReader(ps))
+	_, ps, err := pd.DecodedStreamContext(ctx, cont[0])
+	if err != nil {
+		return nil, err
+	}
+	if err = drw.InterpretContext(ctx, fancy.SliceReader(ps)); err != nil {
+		return nil, err
+	}
 	drw.Draw.CloseDrawing()
 	drw.Write.Out("</g>\n</svg>\n")
-	return drw.Write.Content
+	return drw.Write.Content, nil
 }
@@ -9,19 +9,34 @@
 package svgdraw
 
 import (
+	"bytes"
+	"compress/zlib"
 	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
 
+	"github.com/grokify/pdfreader/colorspace"
+	"github.com/grokify/pdfreader/fancy"
 	"github.com/grokify/pdfreader/graf"
+	"github.com/grokify/pdfreader/hex"
+	"github.com/grokify/pdfreader/icc"
 	"github.com/grokify/pdfreader/stacks"
 	"github.com/grokify/pdfreader/strm"
 	"github.com/grokify/pdfreader/util"
 )
 
 type SvgT struct {
-	Drw     *graf.PdfDrawerT
-	drwpath stacks.StrStack
-	p       int
-	groups  int
+	Drw         *graf.PdfDrawerT
+	IdPrefix    string        // of the ids of clip paths, for drawings in drawings
+	CMYKProfile *icc.ProfileT // for DeviceCMYK, nil converts naive
+	drwpath     stacks.StrStack
+	p           int
+	groups      int
+	saved       []int  // groups at q
+	clip        string // clip-rule of W or W* until the path ends
+	clips       int
 }
 
 func (s *SvgT) SvgPath() string {
@@ -29,7 +44,25 @@ func (s *SvgT) SvgPath() string {
 		util.JoinStrings(s.drwpath.Dump(), ' '))
 }
 
-func (s *SvgT) DropPath() { s.drwpath.Clear() }
+// s.DropPath() ends a path, a clip by it applies from here on.
+func (s *SvgT) DropPath() {
+	if s.clip != "" && s.drwpath.Depth() > 0 {
+		s.ClipBy("<" + s.SvgPath() + " clip-rule=\"" + s.clip + "\" />")
+	}
+	s.clip = ""
+	s.drwpath.Clear()
+}
+
+// s.ClipBy() clips from here on by the shapes of a <clipPath>, like the
+// glyphs of text, until the matching s.Restore().
+func (s *SvgT) ClipBy(shapes string) {
+	s.clips++
+	id := fmt.Sprintf("%sclip%d", s.IdPrefix, s.clips)
+	s.Drw.Write.Out("<defs><clipPath id=\"%s\">%s</clipPath></defs>\n"+
+		"<g clip-path=\"url(#%s)\">\n",
+		id, shapes, id)
+	s.groups++
+}
 func (s *SvgT) MoveTo(coord [][]byte) {
 	s.drwpath.Push(fmt.Sprintf("M%s %s", coord[0], coord[1]))
 }
@@ -54,35 +87,209 @@ func (s *SvgT) Rectangle(coords [][]byte) {
 
 func (s *SvgT) ClosePath() { s.drwpath.Push("Z") }
 
+var (
+	lineCaps  = map[string]string{"0": "butt", "1": "round", "2": "square"}
+	lineJoins = map[string]string{"0": "miter", "1": "round", "2": "bevel"}
+)
+
+// Transparency() returns the attributes of the constant alpha and the
+// blend mode of c, "" if it is opaque and normal.
+func Transparency(c *graf.DrawerConfigT) string {
+	r := ""
+	if v, err := strconv.ParseFloat(c.FillAlpha, 64); err == nil && v < 1 {
+		r += " fill-opacity=\"" + c.FillAlpha + "\""
+	}
+	if v, err := strconv.ParseFloat(c.StrokeAlpha, 64); err == nil && v < 1 {
+		r += " stroke-opacity=\"" + c.StrokeAlpha + "\""
+	}
+	if m := BlendMode(c.BlendMode); m != "" {
+		r += " style=\"mix-blend-mode:" + m + "\""
+	}
+	return r
+}
+
+// BlendMode() returns the CSS name of a PDF blend mode, "" for /Normal and
+// unknown ones.
+func BlendMode(bm string) string {
+	switch bm {
+	case "/Multiply", "/Screen", "/Overlay", "/Darken", "/Lighten", "/ColorDodge", "/ColorBurn",
+		"/HardLight", "/SoftLight", "/Difference", "/Exclusion", "/Hue", "/Saturation", "/Color",
+		"/Luminosity":
+		r := []byte{}
+		for k, c := range []byte(bm[1:]) {
+			if c >= 'A' && c <= 'Z' {
+				if k > 0 {
+					r = append(r, '-')
+				}
+				c += 'a' - 'A'
+			}
+			r = append(r, c)
+		}
+		return string(r)
+	}
+	return ""
+}
+
+// s.strokeAttrs() returns the attributes of the stroke of a path. Lines of
+// width 0 are one pixel wide.
+func (s *SvgT) strokeAttrs() string {
+	c := s.Drw.ConfigD
+	r := fmt.Sprintf("stroke-width=\"%s\" stroke=\"%s\"", c.LineWidth, c.StrokeColor)
+	if w, err := strconv.ParseFloat(c.LineWidth, 64); err == nil && w == 0 {
+		r = fmt.Sprintf("stroke-width=\"1\" vector-effect=\"non-scaling-stroke\" stroke=\"%s\"", c.StrokeColor)
+	}
+	if v, ok := lineCaps[c.LineCap]; ok {
+		r += " stroke-linecap=\"" + v + "\""
+	}
+	if v, ok := lineJoins[c.LineJoin]; ok {
+		r += " stroke-linejoin=\"" + v + "\""
+	}
+	if c.MiterLimit != "" {
+		r += " stroke-miterlimit=\"" + c.MiterLimit + "\""
+	}
+	if c.DashArray != "" {
+		r += " stroke-dasharray=\"" + strings.ReplaceAll(c.DashArray, " ", ",") + "\""
+		if v, _ := strconv.ParseFloat(c.DashPhase, 64); v != 0 {
+			r += " stroke-dashoffset=\"" + c.DashPhase + "\""
+		}
+	}
+	return r
+}
+
 func (s *SvgT) Stroke() {
-	s.Drw.Write.Out("<%s fill=\"none\" stroke-width=\"%s\" stroke=\"%s\" />\n",
-		s.SvgPath(), s.Drw.ConfigD.LineWidth, s.Drw.ConfigD.StrokeColor)
+	s.Drw.Write.Out("<%s fill=\"none\" %s%s />\n", s.SvgPath(), s.strokeAttrs(),
+		Transparency(s.Drw.ConfigD))
 }
 
-func (s *SvgT) Fill() {
+// s.fillAttrs() returns the attributes of the fill of a path by a fill
+// rule.
+func (s *SvgT) fillAttrs(rule string) string {
 	fill := s.Drw.ConfigD.FillColor
 	if fill == "" {
 		fill = "none"
 	}
-	s.Drw.Write.Out("<%s fill=\"%s\" stroke=\"none\" />\n",
-		s.SvgPath(), fill)
+	r := "fill=\"" + fill + "\""
+	if rule != "nonzero" {
+		r += " fill-rule=\"" + rule + "\""
+	}
+	return r
 }
 
-func (s *SvgT) EOFill() { s.Fill() }
+// s.fill() fills the path by a fill rule, the stroke is painted on top
+// like in PDF.
+func (s *SvgT) fill(rule string, stroke bool) {
+	if stroke {
+		s.Drw.Write.Out("<%s %s %s%s />\n", s.SvgPath(), s.fillAttrs(rule), s.strokeAttrs(),
+			Transparency(s.Drw.ConfigD))
+	} else {
+		s.Drw.Write.Out("<%s %s stroke=\"none\"%s />\n", s.SvgPath(), s.fillAttrs(rule),
+			Transparency(s.Drw.ConfigD))
+	}
+}
 
-func (s *SvgT) FillAndStroke() {
+func (s *SvgT) Fill()            { s.fill("nonzero", false) }
+func (s *SvgT) EOFill()          { s.fill("evenodd", false) }
+func (s *SvgT) FillAndStroke()   { s.fill("nonzero", true) }
+func (s *SvgT) EOFillAndStroke() { s.fill("evenodd", true) }
+func (s *SvgT) Clip()            { s.clip = "nonzero" }
+func (s *SvgT) EOClip()          { s.clip = "evenodd" }
+
+// s.Group() opens a group with attributes, it ends at the matching
+// s.Restore().
+func (s *SvgT) Group(attrs string) {
+	s.Drw.Write.Out("<g %s>\n", attrs)
+	s.groups++
+}
+
+func (s *SvgT) Save() { s.saved = append(s.saved, s.groups) }
+
+// s.Restore() closes the groups of transformations and clips since the
+// matching s.Save().
+func (s *SvgT) Restore() {
+	if len(s.saved) == 0 {
+		return
+	}
+	g := s.saved[len(s.saved)-1]
+	s.saved = s.saved[:len(s.saved)-1]
+	for s.groups > g {
+		s.Drw.Write.Out("</g>\n")
+		s.groups--
+	}
+}
+
+// inlineEntry() returns an entry of an inline image dictionary by its full
+// or abbreviated key.
+func inlineEntry(dic map[string][]byte, key, abbr string) string {
+	if v, ok := dic[key]; ok {
+		return string(v)
+	}
+	return string(dic[abbr])
+}
+
+// inlineDecode() applies the filters of an inline image, nil if one of them
+// is not supported. At most max bytes are decoded.
+func inlineDecode(filters string, data []byte, max int64) []byte {
+	for _, f := range strings.Fields(strings.Trim(filters, "[]")) {
+		switch f {
+		case "/AHx", "/ASCIIHexDecode":
+			data = hex.Decode(string(data))
+		case "/Fl", "/FlateDecode":
+			z, err := zlib.NewReader(fancy.SliceReader(data))
+			if err != nil {
+				return nil
+			}
+			data, _ = io.ReadAll(io.LimitReader(z, max))
+		default:
+			return nil
+		}
+	}
+	return data
+}
+
+// s.InlineImage() shows image masks, as used by the bitmap glyphs of Type 3
+// fonts, as runs of pixels in the fill color. Other images are dropped.
+func (s *SvgT) InlineImage(dic map[string][]byte, data []byte) {
+	if inlineEntry(dic, "/ImageMask", "/IM") != "true" {
+		return
+	}
+	w := strm.Int(inlineEntry(dic, "/Width", "/W"), 1)
+	h := strm.Int(inlineEntry(dic, "/Height", "/H"), 1)
+	if w <= 0 || h <= 0 {
+		return
+	}
+	stride := (w + 7) / 8
+	data = inlineDecode(inlineEntry(dic, "/Filter", "/F"), data, int64(stride*h))
+	paint := byte(0) // the bit value which paints
+	if d := strings.Fields(strings.Trim(inlineEntry(dic, "/Decode", "/D"), "[]")); len(d) > 0 && d[0] == "1" {
+		paint = 1
+	}
+	var path bytes.Buffer
+	for y := 0; y < h && (y+1)*stride <= len(data); y++ {
+		row := data[y*stride : (y+1)*stride]
+		for x := 0; x < w; {
+			if row[x/8]>>(7-x%8)&1 != paint {
+				x++
+				continue
+			}
+			x0 := x
+			for x < w && row[x/8]>>(7-x%8)&1 == paint {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h%dZ", x0, y, x-x0, x0-x)
+		}
+	}
+	if path.Len() == 0 {
+		return
+	}
 	fill := s.Drw.ConfigD.FillColor
 	if fill == "" {
-		fill = "none"
+		fill = "black"
 	}
-	s.Drw.Write.Out("<%s fill=\"%s\" stroke-width=\"%s\" stroke=\"%s\" />\n",
-		s.SvgPath(), fill, s.Drw.ConfigD.LineWidth, s.Drw.ConfigD.StrokeColor)
+	s.Drw.Write.Out("<g transform=\"matrix(%g,0,0,%g,0,1)\">\n"+
+		"<path d=\"%s\" fill=\"%s\" stroke=\"none\"%s />\n</g>\n",
+		1/float64(w), -1/float64(h), path.String(), fill, Transparency(s.Drw.ConfigD))
 }
 
-func (s *SvgT) EOFillAndStroke() { s.FillAndStroke() }
-func (s *SvgT) Clip()            {}
-func (s *SvgT) EOClip()          {}
-
 func (s *SvgT) Concat(m [][]byte) {
 	s.Drw.Write.Out("<g transform=\"matrix(%s,%s,%s,%s,%s,%s)\">\n",
 		m[0], m[1], m[2], m[3], m[4], m[5])
@@ -103,12 +310,27 @@ func (s *SvgT) Gray(a []byte) string {
 	return fmt.Sprintf("rgb(%s%%,%s%%,%s%%)", c, c, c)
 }
 func (s *SvgT) CMYK(cmyk [][]byte) string {
-	return fmt.Sprintf("cmyk(%s%%,%s%%,%s%%,%s%%)",
-		strm.Percent(cmyk[0]),
-		strm.Percent(cmyk[1]),
-		strm.Percent(cmyk[2]),
-		strm.Percent(cmyk[3]))
+	c := make([]float64, 4)
+	for k := range c {
+		v, _ := strconv.ParseFloat(string(cmyk[k]), 64)
+		c[k] = min(1, max(0, v))
+	}
+	return s.Device("/DeviceCMYK", c)
+}
+func percent(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10000)/100, 'f', -1, 64)
+}
+
+func (s *SvgT) Device(space string, c []float64) string {
+	switch space {
+	case "/DeviceGray":
+		return fmt.Sprintf("rgb(%s%%,%s%%,%s%%)", percent(c[0]), percent(c[0]), percent(c[0]))
+	case "/DeviceCMYK":
+		c = colorspace.CMYKToRGB(c, s.CMYKProfile)
+	}
+	return fmt.Sprintf("rgb(%s%%,%s%%,%s%%)", percent(c[0]), percent(c[1]), percent(c[2]))
 }
+
 func (s *SvgT) RGB(rgb [][]byte) string {
 	return fmt.Sprintf("rgb(%s%%,%s%%,%s%%)",
 		strm.Percent(rgb[0]),
@@ -120,6 +342,9 @@ func NewTestSvg() *graf.PdfDrawerT {
 	t := new(SvgT)
 	t.Drw = graf.NewPdfDrawer()
 	t.Drw.ConfigD.SetColors(t)
+	t.Drw.ConfigD.FillColor = t.Gray([]byte("0"))
+	t.Drw.ConfigD.StrokeColor = t.Drw.ConfigD.FillColor
+	t.Drw.ConfigD.LineWidth = "1"
 	t.Drw.Draw = t
 	t.drwpath = stacks.NewStrStack(-1)
 	return t.Drw
@@ -0,0 +1,233 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package svgform
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/colorspace"
+	"github.com/grokify/pdfreader/svgdraw"
+)
+
+// samplesT are the decoded samples of an image XObject.
+type samplesT struct {
+	w, h, bpc, n int
+	data         []byte
+	decode       []float64 // minimum and maximum by component
+}
+
+// f.samples() reads the samples of an image with n components, nil if
+// they do not fit the size of the image.
+func (f *FormsT) samples(d pdfreader.Dictionary, data []byte, n int, cs *colorspace.SpaceT) *samplesT {
+	num := func(key string, def int) int {
+		v, err := strconv.Atoi(string(f.Pdf.Obj(d[key])))
+		if err != nil {
+			return def
+		}
+		return v
+	}
+	s := &samplesT{w: num("/Width", 0), h: num("/Height", 0), bpc: num("/BitsPerComponent", 8), n: n, data: data}
+	if s.w <= 0 || s.h <= 0 || n <= 0 || s.bpc <= 0 || s.bpc > 16 ||
+		s.w > len(data)*8/(n*s.bpc) || (s.w*n*s.bpc+7)/8 > len(data)/s.h {
+		return nil
+	}
+	s.decode = make([]float64, 2*n)
+	for k := 0; k < n; k++ {
+		s.decode[2*k+1] = 1
+		if cs != nil {
+			rg := cs.ComponentRange(k)
+			if cs.Family == "/Indexed" {
+				rg[1] = float64(int(1)<<s.bpc - 1)
+			}
+			s.decode[2*k], s.decode[2*k+1] = rg[0], rg[1]
+		}
+	}
+	if a := f.Pdf.Arr(d["/Decode"]); len(a) == 2*n {
+		for k := range a {
+			s.decode[k], _ = strconv.ParseFloat(string(f.Pdf.Obj(a[k])), 64)
+		}
+	}
+	return s
+}
+
+// s.raw() returns the sample of a component at x, y.
+func (s *samplesT) raw(x, y, k int) int {
+	bit := ((s.w*s.n*s.bpc+7)/8*y)*8 + (x*s.n+k)*s.bpc
+	v := 0
+	for b := 0; b < s.bpc; {
+		byt := s.data[(bit+b)/8]
+		off := (bit + b) % 8
+		take := min(8-off, s.bpc-b)
+		v = v<<take | int(byt>>(8-off-take))&(1<<take-1)
+		b += take
+	}
+	return v
+}
+
+// s.value() returns the value of a component at x, y by /Decode.
+func (s *samplesT) value(x, y, k int) float64 {
+	max := float64(int(1)<<s.bpc - 1)
+	return s.decode[2*k] + float64(s.raw(x, y, k))*(s.decode[2*k+1]-s.decode[2*k])/max
+}
+
+// s.at() returns the sample of a component at x, y of an image of size
+// w, h, as the sample nearest to it.
+func (s *samplesT) at(x, y, w, h, k int) float64 {
+	return s.value(x*s.w/w, y*s.h/h, k)
+}
+
+// f.image() draws an image XObject in the unit square as <image> with
+// the samples as PNG. /SMask and /Mask make its alpha. Image masks are
+// drawn in the fill color like the ones of inline images.
+func (f *FormsT) image(o []byte) {
+	d, data := f.Pdf.DecodedStream(o)
+	s := f.svg()
+	if string(f.Pdf.Obj(d["/ImageMask"])) == "true" {
+		dic := make(map[string][]byte)
+		for _, k := range []string{"/Width", "/Height", "/Decode"} {
+			if v, ok := d[k]; ok {
+				dic[k] = f.Pdf.Obj(v)
+			}
+		}
+		dic["/ImageMask"] = []byte("true")
+		s.InlineImage(dic, data)
+		return
+	}
+	var opts *colorspace.Options
+	if r, ok := f.Drw.Spaces.(*colorspace.ResourcesT); ok {
+		opts = r.Opts
+	}
+	cs := colorspace.ReadWith(f.Pdf, d["/ColorSpace"], opts)
+	if cs == nil || cs.N == 0 {
+		return
+	}
+	img := f.samples(d, data, cs.N, cs)
+	if img == nil {
+		return
+	}
+	w, h := img.w, img.h
+	rgba := image.NewNRGBA(image.Rect(0, 0, w, h))
+	colors := make(map[string][3]uint8)
+	key := make([]byte, 2*cs.N)
+	c := make([]float64, cs.N)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for k := range c {
+				v := img.raw(x, y, k)
+				key[2*k], key[2*k+1] = byte(v>>8), byte(v)
+			}
+			rgb, ok := colors[string(key)]
+			if !ok {
+				for k := range c {
+					c[k] = img.value(x, y, k)
+				}
+				rgb = f.rgb(cs, c)
+				colors[string(key)] = rgb
+			}
+			p := rgba.PixOffset(x, y)
+			rgba.Pix[p], rgba.Pix[p+1], rgba.Pix[p+2], rgba.Pix[p+3] = rgb[0], rgb[1], rgb[2], 255
+		}
+	}
+	f.alpha(rgba, img, d)
+	var b bytes.Buffer
+	if png.Encode(&b, rgba) != nil {
+		return
+	}
+	opacity := ""
+	if a, err := strconv.ParseFloat(f.Drw.ConfigD.FillAlpha, 64); err == nil && a < 1 {
+		opacity = " opacity=\"" + f.Drw.ConfigD.FillAlpha + "\""
+	}
+	if m := svgdraw.BlendMode(f.Drw.ConfigD.BlendMode); m != "" {
+		opacity += " style=\"mix-blend-mode:" + m + "\""
+	}
+	f.Drw.Write.Out("<image x=\"0\" y=\"0\" width=\"1\" height=\"1\" preserveAspectRatio=\"none\""+
+		" transform=\"matrix(1,0,0,-1,0,1)\"%s xlink:href=\"data:image/png;base64,%s\" />\n",
+		opacity, base64.StdEncoding.EncodeToString(b.Bytes()))
+}
+
+// f.rgb() converts a color to 8 bit sRGB.
+func (f *FormsT) rgb(cs *colorspace.SpaceT, c []float64) (r [3]uint8) {
+	space, v := cs.Device(c)
+	switch space {
+	case "/DeviceGray":
+		v = []float64{v[0], v[0], v[0]}
+	case "/DeviceCMYK":
+		v = colorspace.CMYKToRGB(v, f.svg().CMYKProfile)
+	case "/DeviceRGB":
+	default:
+		return
+	}
+	for k := range r {
+		r[k] = uint8(math.Round(min(1, max(0, v[k])) * 255))
+	}
+	return
+}
+
+// f.alpha() sets the alpha of an image by /SMask, a gray image, or by
+// /Mask, an image mask or color key ranges.
+func (f *FormsT) alpha(rgba *image.NRGBA, img *samplesT, d pdfreader.Dictionary) {
+	w, h := img.w, img.h
+	if sm, ok := d["/SMask"]; ok {
+		md, data := f.Pdf.DecodedStream(sm)
+		if m := f.samples(md, data, 1, nil); m != nil {
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					a := min(1, max(0, m.at(x, y, w, h, 0)))
+					rgba.Pix[rgba.PixOffset(x, y)+3] = uint8(math.Round(a * 255))
+				}
+			}
+		}
+		return
+	}
+	mask, ok := d["/Mask"]
+	if !ok {
+		return
+	}
+	if ranges := f.Pdf.Arr(mask); len(ranges) == 2*img.n {
+		r := make([]int, len(ranges))
+		for k := range ranges {
+			r[k], _ = strconv.Atoi(string(f.Pdf.Obj(ranges[k])))
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				masked := true
+				for k := 0; k < img.n && masked; k++ {
+					v := img.raw(x, y, k)
+					masked = v >= r[2*k] && v <= r[2*k+1]
+				}
+				if masked {
+					rgba.Pix[rgba.PixOffset(x, y)+3] = 0
+				}
+			}
+		}
+		return
+	}
+	md, data := f.Pdf.DecodedStream(mask)
+	stencil := pdfreader.Dictionary{"/BitsPerComponent": []byte("1")}
+	for _, k := range []string{"/Width", "/Height", "/Decode"} {
+		if v, ok := md[k]; ok {
+			stencil[k] = v
+		}
+	}
+	if m := f.samples(stencil, data, 1, nil); m != nil {
+		// samples of 1 mask the image, by the default /Decode [0 1].
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if m.at(x, y, w, h, 0) >= 0.5 {
+					rgba.Pix[rgba.PixOffset(x, y)+3] = 0
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// SVG driver (form XObjects and soft masks) for graf.go.
+//
+// Forms are interpreted by the drawer of the page itself, with their
+// /Resources while they run. Transparency groups become isolated groups
+// painted with the alpha and blend mode of the graphics state, soft masks
+// become <mask> elements of the groups following gs. Image XObjects become
+// <image> elements with their /SMask or /Mask as alpha. XObjects with /OC
+// are skipped while their optional content is hidden.
+package svgform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/colorspace"
+	"github.com/grokify/pdfreader/extgstate"
+	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/graf"
+	"github.com/grokify/pdfreader/optcontent"
+	"github.com/grokify/pdfreader/strm"
+	"github.com/grokify/pdfreader/svgdraw"
+	"github.com/grokify/pdfreader/svgpattern"
+	"github.com/grokify/pdfreader/svgtext"
+	"github.com/grokify/pdfreader/util"
+)
+
+// forms contain forms.
+const MAX_DEPTH = 16
+
+// the half size of the area of soft masks, in default user space.
+const MASK_EXTENT = 16384
+
+type FormsT struct {
+	Pdf      *pdfreader.PDFReader
+	Drw      *graf.PdfDrawerT
+	xobjects pdfreader.Dictionary
+	n        *int // ids so far, shared with the forms in forms
+	depth    int
+}
+
+// New() resolves the XObjects of a /Resources dictionary for drw.
+func New(pdf *pdfreader.PDFReader, drw *graf.PdfDrawerT, resources []byte) *FormsT {
+	r := &FormsT{Pdf: pdf, Drw: drw, n: new(int)}
+	drw.XObjects = r
+	if resources != nil {
+		r.xobjects = pdf.Dic(pdf.Dic(resources)["/XObject"])
+	}
+	return r
+}
+
+// f.svg() returns the SVG drawer, nil for others.
+func (f *FormsT) svg() *svgdraw.SvgT {
+	s, _ := f.Drw.Draw.(*svgdraw.SvgT)
+	return s
+}
+
+// f.id() returns a new id, unique also in nested drawings.
+func (f *FormsT) id(kind string) string {
+	*f.n++
+	return fmt.Sprintf("%s%s%d", f.svg().IdPrefix, kind, *f.n)
+}
+
+func (f *FormsT) Do(name []byte) {
+	o, ok := f.xobjects[string(name)]
+	if !ok || f.svg() == nil {
+		return
+	}
+	d := f.Pdf.Dic(o)
+	if oc, ok := d["/OC"]; ok && f.Drw.Optional != nil && !f.Drw.Optional.Visible(oc) {
+		return
+	}
+	if string(d["/Subtype"]) == "/Image" {
+		f.image(o)
+		return
+	}
+	f.form(o, true)
+}
+
+// resolversT are the parts of a drawer depending on resources.
+type resolversT struct {
+	spaces   graf.ColorSpaces
+	gstates  graf.GStates
+	paints   graf.Paints
+	xobjects graf.XObjects
+	optional graf.OptionalContent
+	text     graf.DrawerText
+	prefix   string
+}
+
+// f.form() interprets a form XObject like q cm re W n ... Q, group tells if
+// it is painted as transparency group.
+func (f *FormsT) form(o []byte, group bool) {
+	d, content := f.Pdf.DecodedStream(o)
+	if string(d["/Subtype"]) != "/Form" || f.depth >= MAX_DEPTH {
+		return
+	}
+	pd, s := f.Drw, f.svg()
+	saved := resolversT{pd.Spaces, pd.GStates, pd.Paints, pd.XObjects, pd.Optional, pd.Text, s.IdPrefix}
+	defer func() {
+		pd.Spaces, pd.GStates, pd.Paints, pd.XObjects, pd.Optional, pd.Text, s.IdPrefix =
+			saved.spaces, saved.gstates, saved.paints, saved.xobjects, saved.optional, saved.text, saved.prefix
+	}()
+	op := func(name string, operands ...[]byte) {
+		for _, o := range operands {
+			pd.Stack.Push(o)
+		}
+		pd.Ops[name](pd)
+	}
+	op("q")
+	if g := f.Pdf.Dic(d["/Group"]); group && string(g["/S"]) == "/Transparency" {
+		attrs := "style=\"isolation:isolate"
+		if m := svgdraw.BlendMode(pd.ConfigD.BlendMode); m != "" {
+			attrs += ";mix-blend-mode:" + m
+		}
+		attrs += "\""
+		if a, err := strconv.ParseFloat(pd.ConfigD.FillAlpha, 64); err == nil && a < 1 {
+			attrs += " opacity=\"" + pd.ConfigD.FillAlpha + "\""
+		}
+		s.Group(attrs)
+		pd.ConfigD.FillAlpha, pd.ConfigD.StrokeAlpha, pd.ConfigD.BlendMode = "", "", ""
+	}
+	if m := f.Pdf.Arr(d["/Matrix"]); len(m) == 6 {
+		a := make([][]byte, 6)
+		for k := range m {
+			a[k] = f.Pdf.Obj(m[k])
+		}
+		op("cm", a...)
+	}
+	if b := util.StringArray(f.Pdf.Arr(d["/BBox"])); len(b) == 4 {
+		op("re", []byte(b[0]), []byte(b[1]), []byte(strm.Sub(b[2], b[0])), []byte(strm.Sub(b[3], b[1])))
+		op("W")
+		op("n")
+	}
+	s.IdPrefix = f.id("form") + "-"
+	sub := &FormsT{Pdf: f.Pdf, Drw: pd, n: f.n, depth: f.depth + 1, xobjects: f.xobjects}
+	if res, ok := d["/Resources"]; ok {
+		var opts *colorspace.Options
+		if r, ok := pd.Spaces.(*colorspace.ResourcesT); ok {
+			opts = r.Opts
+		}
+		pd.Spaces = colorspace.NewWith(f.Pdf, res, opts)
+		pd.GStates = extgstate.New(f.Pdf, res)
+		svgpattern.New(f.Pdf, pd, res)
+		sub.xobjects = f.Pdf.Dic(f.Pdf.Dic(res)["/XObject"])
+		if oc, ok := pd.Optional.(*optcontent.ResourcesT); ok {
+			pd.Optional = oc.Content.Resources(res)
+		}
+		if t, ok := saved.text.(*svgtext.SvgTextT); ok {
+			txt := svgtext.New(f.Pdf, pd)
+			txt.Page = t.Page
+			txt.EmbedFonts, txt.OutlineText = t.EmbedFonts, t.OutlineText
+			txt.TextOut = t.TextOut
+			txt.UseResources(res, s.IdPrefix)
+		}
+	}
+	pd.XObjects = sub
+	pd.Interpret(fancy.SliceReader(content))
+	op("Q")
+}
+
+// f.extent() returns an area containing the page in the current user space.
+func (f *FormsT) extent() (x0, y0, x1, y1 float64) {
+	m := f.Drw.CTM()
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return -MASK_EXTENT, -MASK_EXTENT, MASK_EXTENT, MASK_EXTENT
+	}
+	inv := [6]float64{m[3] / det, -m[1] / det, -m[2] / det, m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det, (m[1]*m[4] - m[0]*m[5]) / det}
+	x0, y0, x1, y1 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, c := range [4][2]float64{{-1, -1}, {-1, 1}, {1, -1}, {1, 1}} {
+		x := c[0]*MASK_EXTENT*inv[0] + c[1]*MASK_EXTENT*inv[2] + inv[4]
+		y := c[0]*MASK_EXTENT*inv[1] + c[1]*MASK_EXTENT*inv[3] + inv[5]
+		x0, y0, x1, y1 = min(x0, x), min(y0, y), max(x1, x), max(y1, y)
+	}
+	return
+}
+
+// f.SoftMask() renders the group of a soft mask into a <mask> and opens a
+// group masked by it. /None cannot end a mask before the matching Q.
+func (f *FormsT) SoftMask(o []byte) {
+	s := f.svg()
+	if s == nil || string(f.Pdf.Obj(o)) == "/None" {
+		return
+	}
+	d := f.Pdf.Dic(o)
+	g, ok := d["/G"]
+	if !ok {
+		return
+	}
+	pd := f.Drw
+	id := f.id("mask")
+	out, config, tconfig := pd.Write, *pd.ConfigD, *pd.TConfD
+	pd.Write = new(util.OutT)
+	// the group is painted in the initial graphics state, but for the CTM.
+	black := pd.ConfigD.FillColor
+	if dc, ok := pd.Draw.(graf.DrawerColor); ok {
+		black = dc.Gray([]byte("0"))
+	}
+	*pd.ConfigD = graf.DrawerConfigT{FillColor: black, StrokeColor: black, LineWidth: "1"}
+	pd.ConfigD.SetColors(s)
+	x0, y0, x1, y1 := f.extent()
+	luminosity := string(d["/S"]) != "/Alpha"
+	if bc := f.Pdf.Arr(d["/BC"]); luminosity && len(bc) > 0 {
+		gd := f.Pdf.Dic(f.Pdf.Dic(g)["/Group"])
+		if cs := colorspace.Read(f.Pdf, gd["/CS"]); cs != nil {
+			c := make([]float64, len(bc))
+			for k := range bc {
+				c[k], _ = strconv.ParseFloat(string(f.Pdf.Obj(bc[k])), 64)
+			}
+			if sp, v := cs.Device(c); sp != "" {
+				pd.Write.Out("<path d=\"M%g %g H%g V%g H%g Z\" fill=\"%s\" stroke=\"none\" />\n",
+					x0, y0, x1, y1, x0, s.Device(sp, v))
+			}
+		}
+	}
+	f.form(g, false)
+	content := pd.Write.Content
+	pd.Write, *pd.ConfigD, *pd.TConfD = out, config, tconfig
+	style := ""
+	if !luminosity {
+		style = " style=\"mask-type:alpha\""
+	}
+	pd.Write.Out("<defs><mask id=\"%s\" maskUnits=\"userSpaceOnUse\" x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\"%s>\n"+
+		"%s</mask></defs>\n", id, x0, y0, x1-x0, y1-y0, style, content)
+	s.Group("mask=\"url(#" + id + ")\"")
+}
@@ -0,0 +1,557 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package svgpattern
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/colorspace"
+	"github.com/grokify/pdfreader/function"
+)
+
+// Shadings: axial (Type 2) and radial (Type 3) ones are gradients with
+// stops sampled from their function. Function based shadings (Type 1) are
+// sampled on a grid, the meshes (Types 4 to 7) are subdivided into small
+// polygons of one color each.
+
+// samples of gradients, cells of function based shadings, subdivisions of
+// the edges of triangles and patches.
+const (
+	STOPS         = 32
+	FUNCTION_GRID = 32
+	TRIANGLE_GRID = 4
+	PATCH_GRID    = 8
+)
+
+// meshes of more polygons are cut.
+const MAX_POLYGONS = 100000
+
+type shadingT struct {
+	typ    int
+	dic    pdfreader.Dictionary
+	o      []byte
+	space  *colorspace.SpaceT
+	fn     function.FunctionT // nil if the colors are given directly
+	coords []float64
+	domain []float64
+	extend [2]bool
+	bbox   []float64
+}
+
+// p.shading() reads a shading, nil if it is broken or of unknown type.
+func (p *PatternsT) shading(o []byte) *shadingT {
+	d := p.Pdf.Dic(o)
+	sh := &shadingT{typ: int(number(p.Pdf, d["/ShadingType"], 0)), dic: d, o: o}
+	if sh.space = colorspace.ReadWith(p.Pdf, d["/ColorSpace"], p.opts()); sh.space == nil {
+		return nil
+	}
+	if f, ok := d["/Function"]; ok {
+		if sh.fn = function.Read(p.Pdf, f); sh.fn == nil {
+			return nil
+		}
+	}
+	sh.coords = numbers(p.Pdf, d["/Coords"])
+	sh.domain = numbers(p.Pdf, d["/Domain"])
+	for k, e := range p.Pdf.Arr(d["/Extend"]) {
+		if k < 2 {
+			sh.extend[k] = string(p.Pdf.Obj(e)) == "true"
+		}
+	}
+	sh.bbox = numbers(p.Pdf, d["/BBox"])
+	switch sh.typ {
+	case 1:
+		if sh.fn == nil {
+			return nil
+		}
+	case 2, 3:
+		if sh.fn == nil || len(sh.coords) != 2*sh.typ {
+			return nil
+		}
+		if len(sh.domain) != 2 {
+			sh.domain = []float64{0, 1}
+		}
+	case 4, 5, 6, 7:
+	default:
+		return nil
+	}
+	return sh
+}
+
+// p.shade() returns the color of components of a shading, they are the
+// input of its function if there is one.
+func (p *PatternsT) shade(sh *shadingT, c []float64) string {
+	if sh.fn != nil {
+		c = sh.fn.Eval(c)
+	}
+	return p.paint(sh.space, c)
+}
+
+// p.paint() is p.color() giving "none" instead of "".
+func (p *PatternsT) paint(sp *colorspace.SpaceT, c []float64) string {
+	if r := p.color(sp, c); r != "" {
+		return r
+	}
+	return "none"
+}
+
+type stopT struct {
+	offset float64
+	c      []float64 // the outputs of the function
+}
+
+// linear() tells if the stop b is on the line from a to c, within the
+// precision of 8 bit colors.
+func linear(a, b, c stopT) bool {
+	if c.offset == a.offset {
+		return false
+	}
+	s := (b.offset - a.offset) / (c.offset - a.offset)
+	for k := range b.c {
+		if k >= len(a.c) || k >= len(c.c) || math.Abs(a.c[k]+s*(c.c[k]-a.c[k])-b.c[k]) > 1.0/512 {
+			return false
+		}
+	}
+	return true
+}
+
+// p.gradient() writes an axial or radial shading as gradient. A radial one
+// has its larger circle as the end and the smaller one's center as focal
+// point, exact for circles of the same center or starting in a point. Ends
+// which are not extended get transparent stops.
+func (p *PatternsT) gradient(sh *shadingT, id, transform string) bool {
+	c := sh.coords
+	var el, attrs string
+	offset := func(s float64) float64 { return s }
+	ext := sh.extend
+	if sh.typ == 2 {
+		if c[0] == c[2] && c[1] == c[3] {
+			return false
+		}
+		el = "linearGradient"
+		attrs = fmt.Sprintf("x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\"", num(c[0]), num(c[1]), num(c[2]), num(c[3]))
+	} else {
+		r0, r1 := max(0, c[2]), max(0, c[5])
+		rmax := max(r0, r1)
+		if rmax == 0 {
+			return false
+		}
+		el = "radialGradient"
+		outer, focal := c[3:6], c[0:3]
+		if r0 > r1 {
+			outer, focal = c[0:3], c[3:6]
+			ext[0], ext[1] = ext[1], ext[0]
+		}
+		attrs = fmt.Sprintf("cx=\"%s\" cy=\"%s\" r=\"%s\" fx=\"%s\" fy=\"%s\"",
+			num(outer[0]), num(outer[1]), num(rmax), num(focal[0]), num(focal[1]))
+		offset = func(s float64) float64 { return (r0 + s*(r1-r0)) / rmax }
+	}
+	stops := make([]stopT, 0, STOPS+1)
+	for k := 0; k <= STOPS; k++ {
+		s := float64(k) / STOPS
+		t := sh.domain[0] + s*(sh.domain[1]-sh.domain[0])
+		stops = append(stops, stopT{offset(s), sh.fn.Eval([]float64{t})})
+	}
+	if stops[0].offset > stops[STOPS].offset {
+		for k := 0; k < len(stops)/2; k++ {
+			stops[k], stops[STOPS-k] = stops[STOPS-k], stops[k]
+		}
+	}
+	if transform != "" {
+		transform = " gradientTransform=\"" + transform + "\""
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<defs><%s id=\"%s\" gradientUnits=\"userSpaceOnUse\" %s%s>\n", el, id, attrs, transform)
+	if !ext[0] {
+		fmt.Fprintf(&b, "<stop offset=\"%s\" stop-color=\"%s\" stop-opacity=\"0\" />\n",
+			num(stops[0].offset), p.paint(sh.space, stops[0].c))
+	}
+	last := 0
+	for k, s := range stops {
+		// stops on the line between their neighbors are of no use.
+		if k > 0 && k < STOPS && linear(stops[last], s, stops[k+1]) {
+			continue
+		}
+		last = k
+		fmt.Fprintf(&b, "<stop offset=\"%s\" stop-color=\"%s\" />\n", num(s.offset), p.paint(sh.space, s.c))
+	}
+	if !ext[1] {
+		fmt.Fprintf(&b, "<stop offset=\"%s\" stop-color=\"%s\" stop-opacity=\"0\" />\n",
+			num(stops[STOPS].offset), p.paint(sh.space, stops[STOPS].c))
+	}
+	fmt.Fprintf(&b, "</%s></defs>\n", el)
+	p.Drw.Write.Out("%s", b.String())
+	return true
+}
+
+// polyT is a polygon of a mesh in a color.
+type polyT struct {
+	pts   [][2]float64
+	color string
+}
+
+// paths() returns polygons as group of paths, without antialiasing which
+// would show the seams between them.
+func paths(polys []polyT) string {
+	if len(polys) == 0 {
+		return ""
+	}
+	var b bytes.Buffer
+	b.WriteString("<g shape-rendering=\"crispEdges\" stroke=\"none\">\n")
+	for _, pl := range polys {
+		b.WriteString("<path d=\"")
+		for k, pt := range pl.pts {
+			if k == 0 {
+				b.WriteByte('M')
+			} else {
+				b.WriteByte('L')
+			}
+			fmt.Fprintf(&b, "%s %s", num(pt[0]), num(pt[1]))
+		}
+		fmt.Fprintf(&b, "Z\" fill=\"%s\" />\n", pl.color)
+	}
+	b.WriteString("</g>\n")
+	return b.String()
+}
+
+// bounds() returns the bounding box of polygons.
+func bounds(polys []polyT) (x0, y0, x1, y1 float64) {
+	x0, y0, x1, y1 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, pl := range polys {
+		for _, pt := range pl.pts {
+			x0, y0 = min(x0, pt[0]), min(y0, pt[1])
+			x1, y1 = max(x1, pt[0]), max(y1, pt[1])
+		}
+	}
+	return
+}
+
+// p.mesh() returns the polygons of a shading of Type 1 or 4 to 7.
+func (p *PatternsT) mesh(sh *shadingT) []polyT {
+	var polys []polyT
+	switch sh.typ {
+	case 1:
+		d := sh.domain
+		if len(d) != 4 {
+			d = []float64{0, 1, 0, 1}
+		}
+		m := matrix(p.Pdf, sh.dic["/Matrix"])
+		for j := 0; j < FUNCTION_GRID; j++ {
+			for i := 0; i < FUNCTION_GRID; i++ {
+				x := func(i int) float64 { return d[0] + float64(i)*(d[1]-d[0])/FUNCTION_GRID }
+				y := func(j int) float64 { return d[2] + float64(j)*(d[3]-d[2])/FUNCTION_GRID }
+				var pts [][2]float64
+				for _, c := range [4][2]int{{i, j}, {i + 1, j}, {i + 1, j + 1}, {i, j + 1}} {
+					u, v := apply(m, x(c[0]), y(c[1]))
+					pts = append(pts, [2]float64{u, v})
+				}
+				polys = append(polys, polyT{pts,
+					p.shade(sh, []float64{(x(i) + x(i+1)) / 2, (y(j) + y(j+1)) / 2})})
+			}
+		}
+	case 4, 5:
+		for _, t := range p.triangles(sh) {
+			polys = p.triangle(polys, sh, t)
+		}
+	case 6, 7:
+		for _, pt := range p.patches(sh) {
+			polys = p.patch(polys, sh, pt)
+		}
+	}
+	return polys
+}
+
+// vertexT is a point of a mesh with its color components.
+type vertexT struct {
+	x, y float64
+	c    []float64
+}
+
+// meshT reads the vertices of a mesh stream.
+type meshT struct {
+	data        []byte
+	bit         int
+	bpc, bpcomp int // bits per coordinate and per component
+	bpf         int // bits per flag
+	decode      []float64
+	ncomp       int
+	end         bool // data exhausted
+}
+
+func (p *PatternsT) meshReader(sh *shadingT) *meshT {
+	_, data := p.Pdf.DecodedStream(sh.o)
+	m := &meshT{data: data,
+		bpc:    int(number(p.Pdf, sh.dic["/BitsPerCoordinate"], 0)),
+		bpcomp: int(number(p.Pdf, sh.dic["/BitsPerComponent"], 0)),
+		bpf:    int(number(p.Pdf, sh.dic["/BitsPerFlag"], 0)),
+		decode: numbers(p.Pdf, sh.dic["/Decode"]),
+		ncomp:  sh.space.N,
+	}
+	if sh.fn != nil {
+		m.ncomp = 1
+	}
+	if m.bpc <= 0 || m.bpc > 32 || m.bpcomp <= 0 || m.bpcomp > 16 || m.bpf > 8 ||
+		len(m.decode) < 4+2*m.ncomp {
+		return nil
+	}
+	return m
+}
+
+// m.bits() reads n bits.
+func (m *meshT) bits(n int) uint64 {
+	if m.bit+n > 8*len(m.data) {
+		m.end = true
+		return 0
+	}
+	v := uint64(0)
+	for k := 0; k < n; k++ {
+		v = v<<1 | uint64(m.data[m.bit/8]>>(7-m.bit%8)&1)
+		m.bit++
+	}
+	return v
+}
+
+// m.align() goes to the next byte, the records of vertices and patches
+// start at bytes.
+func (m *meshT) align() { m.bit = (m.bit + 7) / 8 * 8 }
+
+// m.value() reads a value of n bits and maps it by the /Decode entries at k.
+func (m *meshT) value(n, k int) float64 {
+	v := float64(m.bits(n)) / float64(uint64(1)<<n-1)
+	return m.decode[k] + v*(m.decode[k+1]-m.decode[k])
+}
+
+func (m *meshT) point() [2]float64 {
+	return [2]float64{m.value(m.bpc, 0), m.value(m.bpc, 2)}
+}
+
+func (m *meshT) color() []float64 {
+	c := make([]float64, m.ncomp)
+	for k := range c {
+		c[k] = m.value(m.bpcomp, 4+2*k)
+	}
+	return c
+}
+
+func (m *meshT) vertex() vertexT {
+	pt := m.point()
+	return vertexT{pt[0], pt[1], m.color()}
+}
+
+// p.triangles() reads the triangles of a free-form (Type 4) or lattice-form
+// (Type 5) mesh.
+func (p *PatternsT) triangles(sh *shadingT) (r [][3]vertexT) {
+	m := p.meshReader(sh)
+	if m == nil {
+		return nil
+	}
+	if sh.typ == 5 {
+		per := int(number(p.Pdf, sh.dic["/VerticesPerRow"], 0))
+		if per < 2 {
+			return nil
+		}
+		var rows [][]vertexT
+		for row := []vertexT{}; len(r) < MAX_POLYGONS; {
+			v := m.vertex()
+			m.align()
+			if m.end {
+				break
+			}
+			if row = append(row, v); len(row) == per {
+				if len(rows) > 0 {
+					a := rows[len(rows)-1]
+					for k := 0; k+1 < per; k++ {
+						r = append(r, [3]vertexT{a[k], a[k+1], row[k]}, [3]vertexT{a[k+1], row[k+1], row[k]})
+					}
+				}
+				rows, row = append(rows, row), []vertexT{}
+			}
+		}
+		return
+	}
+	if m.bpf <= 0 {
+		return nil
+	}
+	var prev [3]vertexT
+	for len(r) < MAX_POLYGONS {
+		f := m.bits(m.bpf)
+		v := m.vertex()
+		m.align()
+		if m.end {
+			break
+		}
+		switch {
+		case f == 0:
+			var t [3]vertexT
+			t[0] = v
+			for k := 1; k < 3 && !m.end; k++ {
+				m.bits(m.bpf)
+				t[k] = m.vertex()
+				m.align()
+			}
+			if m.end {
+				return
+			}
+			prev = t
+		case len(r) == 0:
+			continue // no triangle to continue
+		case f == 1:
+			prev = [3]vertexT{prev[1], prev[2], v}
+		default:
+			prev = [3]vertexT{prev[0], prev[2], v}
+		}
+		r = append(r, prev)
+	}
+	return
+}
+
+func mix(a, b []float64, s, t float64) []float64 {
+	r := make([]float64, len(a))
+	for k := range r {
+		r[k] = s*a[k] + t*b[k]
+	}
+	return r
+}
+
+// p.triangle() adds the small triangles of a Gouraud shaded one, colored at
+// their centers.
+func (p *PatternsT) triangle(polys []polyT, sh *shadingT, t [3]vertexT) []polyT {
+	const n = TRIANGLE_GRID
+	at := func(i, j float64) ([2]float64, []float64) {
+		u, v := i/n, j/n
+		w := 1 - u - v
+		return [2]float64{w*t[0].x + u*t[1].x + v*t[2].x, w*t[0].y + u*t[1].y + v*t[2].y},
+			mix(mix(t[0].c, t[1].c, w, u), t[2].c, 1, v)
+	}
+	add := func(a, b, c [2]float64) {
+		i, j := (a[0]+b[0]+c[0])/3, (a[1]+b[1]+c[1])/3
+		pa, _ := at(a[0], a[1])
+		pb, _ := at(b[0], b[1])
+		pc, _ := at(c[0], c[1])
+		_, col := at(i, j)
+		polys = append(polys, polyT{[][2]float64{pa, pb, pc}, p.shade(sh, col)})
+	}
+	for i := 0.0; i < n; i++ {
+		for j := 0.0; i+j < n; j++ {
+			add([2]float64{i, j}, [2]float64{i + 1, j}, [2]float64{i, j + 1})
+			if i+j < n-1 {
+				add([2]float64{i + 1, j}, [2]float64{i + 1, j + 1}, [2]float64{i, j + 1})
+			}
+		}
+	}
+	return polys
+}
+
+// patchT is a tensor-product patch, p[i][j] at u = i/3 and v = j/3, with
+// colors at the corners (0,0), (0,1), (1,1) and (1,0).
+type patchT struct {
+	p [4][4][2]float64
+	c [4][]float64
+}
+
+// the boundary of a patch in the order of the stream.
+var boundary = [12][2]int{{0, 0}, {0, 1}, {0, 2}, {0, 3}, {1, 3}, {2, 3},
+	{3, 3}, {3, 2}, {3, 1}, {3, 0}, {2, 0}, {1, 0}}
+
+// p.patches() reads the patches of a Coons (Type 6) or tensor-product
+// (Type 7) mesh. The inner points of Coons patches are computed.
+func (p *PatternsT) patches(sh *shadingT) (r []patchT) {
+	m := p.meshReader(sh)
+	if m == nil || m.bpf <= 0 {
+		return nil
+	}
+	var prev patchT
+	for len(r)*PATCH_GRID*PATCH_GRID < MAX_POLYGONS {
+		f := int(m.bits(m.bpf))
+		var pt patchT
+		b, c := 0, 0 // boundary points and colors given by the stream
+		if f != 0 {
+			if len(r) == 0 || f > 3 {
+				break
+			}
+			for k := 0; k < 4; k++ {
+				q := boundary[(3*f+k)%12]
+				pt.p[boundary[k][0]][boundary[k][1]] = prev.p[q[0]][q[1]]
+			}
+			pt.c[0], pt.c[1] = prev.c[f], prev.c[(f+1)%4]
+			b, c = 4, 2
+		}
+		for k := b; k < 12; k++ {
+			q := boundary[k]
+			pt.p[q[0]][q[1]] = m.point()
+		}
+		if sh.typ == 7 {
+			for _, q := range [4][2]int{{1, 1}, {1, 2}, {2, 2}, {2, 1}} {
+				pt.p[q[0]][q[1]] = m.point()
+			}
+		}
+		for k := c; k < 4; k++ {
+			pt.c[k] = m.color()
+		}
+		m.align()
+		if m.end {
+			break
+		}
+		if sh.typ == 6 {
+			coons(&pt)
+		}
+		r = append(r, pt)
+		prev = pt
+	}
+	return
+}
+
+// coons() sets the inner points of a patch by its boundary.
+func coons(pt *patchT) {
+	p := &pt.p
+	for k := 0; k < 2; k++ {
+		inner := func(a, b1, b2, c1, c2, d1, d2, e [2]float64) float64 {
+			return (-4*a[k] + 6*(b1[k]+b2[k]) - 2*(c1[k]+c2[k]) + 3*(d1[k]+d2[k]) - e[k]) / 9
+		}
+		p[1][1][k] = inner(p[0][0], p[0][1], p[1][0], p[0][3], p[3][0], p[3][1], p[1][3], p[3][3])
+		p[1][2][k] = inner(p[0][3], p[0][2], p[1][3], p[0][0], p[3][3], p[3][2], p[1][0], p[3][0])
+		p[2][1][k] = inner(p[3][0], p[3][1], p[2][0], p[3][3], p[0][0], p[0][1], p[2][3], p[0][3])
+		p[2][2][k] = inner(p[3][3], p[3][2], p[2][3], p[3][0], p[0][3], p[0][2], p[2][0], p[0][0])
+	}
+}
+
+func bernstein(t float64) [4]float64 {
+	s := 1 - t
+	return [4]float64{s * s * s, 3 * t * s * s, 3 * t * t * s, t * t * t}
+}
+
+// pt.at() returns the point of a patch at u, v.
+func (pt *patchT) at(u, v float64) [2]float64 {
+	bu, bv := bernstein(u), bernstein(v)
+	var r [2]float64
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			r[0] += pt.p[i][j][0] * bu[i] * bv[j]
+			r[1] += pt.p[i][j][1] * bu[i] * bv[j]
+		}
+	}
+	return r
+}
+
+// p.patch() adds the small quadrilaterals of a patch, colored at their
+// centers.
+func (p *PatternsT) patch(polys []polyT, sh *shadingT, pt patchT) []polyT {
+	const n = PATCH_GRID
+	for i := 0.0; i < n; i++ {
+		for j := 0.0; j < n; j++ {
+			u, v := (i+0.5)/n, (j+0.5)/n
+			col := mix(mix(pt.c[0], pt.c[1], 1-v, v), mix(pt.c[3], pt.c[2], 1-v, v), 1-u, u)
+			polys = append(polys, polyT{[][2]float64{
+				pt.at(i/n, j/n), pt.at((i+1)/n, j/n), pt.at((i+1)/n, (j+1)/n), pt.at(i/n, (j+1)/n),
+			}, p.shade(sh, col)})
+		}
+	}
+	return polys
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// SVG driver (patterns and shadings) for graf.go.
+//
+// Tiling patterns are interpreted by a nested drawer into a <pattern>,
+// axial and radial shadings are written as gradients and the other
+// shadings as many small polygons, see shading.go.
+package svgpattern
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/colorspace"
+	"github.com/grokify/pdfreader/extgstate"
+	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/graf"
+	"github.com/grokify/pdfreader/limits"
+	"github.com/grokify/pdfreader/optcontent"
+	"github.com/grokify/pdfreader/svgdraw"
+	"github.com/grokify/pdfreader/svgtext"
+)
+
+// tiling patterns contain patterns.
+const MAX_DEPTH = 4
+
+// the half size of the area painted by sh without /BBox, in default user
+// space.
+const SHADE_EXTENT = 16384
+
+type PatternsT struct {
+	Pdf      *pdfreader.PDFReader
+	Drw      *graf.PdfDrawerT
+	patterns pdfreader.Dictionary
+	shadings pdfreader.Dictionary
+	ids      map[string]string // paints written by pattern, color and matrix
+	n        int               // ids so far
+	depth    int               // of nesting in tiling patterns
+}
+
+// New() resolves the patterns and shadings of a /Resources dictionary for
+// drw.
+func New(pdf *pdfreader.PDFReader, drw *graf.PdfDrawerT, resources []byte) *PatternsT {
+	r := &PatternsT{Pdf: pdf, Drw: drw, ids: make(map[string]string)}
+	drw.Paints = r
+	if resources != nil {
+		res := pdf.Dic(resources)
+		r.patterns = pdf.Dic(res["/Pattern"])
+		r.shadings = pdf.Dic(res["/Shading"])
+	}
+	return r
+}
+
+func numbers(pd *pdfreader.PDFReader, o []byte) []float64 {
+	a := pd.Arr(o)
+	r := make([]float64, len(a))
+	for k := range a {
+		r[k], _ = strconv.ParseFloat(string(pd.Obj(a[k])), 64)
+	}
+	return r
+}
+
+func number(pd *pdfreader.PDFReader, o []byte, def float64) float64 {
+	if v, err := strconv.ParseFloat(string(pd.Obj(o)), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// num() formats a coordinate.
+func num(v float64) string {
+	if v = math.Round(v*1000) / 1000; v == 0 {
+		v = 0 // no -0
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// coef() formats a coefficient of a matrix.
+func coef(v float64) string {
+	if v == 0 {
+		v = 0
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+var identity = [6]float64{1, 0, 0, 1, 0, 0}
+
+// matrix() reads a /Matrix, identity if there is none.
+func matrix(pd *pdfreader.PDFReader, o []byte) [6]float64 {
+	r := identity
+	if a := numbers(pd, o); len(a) == 6 {
+		copy(r[:], a)
+	}
+	return r
+}
+
+// invert() returns the inverse of m, identity if there is none.
+func invert(m [6]float64) [6]float64 {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return identity
+	}
+	return [6]float64{
+		m[3] / det, -m[1] / det, -m[2] / det, m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det, (m[1]*m[4] - m[0]*m[5]) / det,
+	}
+}
+
+func apply(m [6]float64, x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+func transform(m [6]float64) string {
+	return fmt.Sprintf("matrix(%s,%s,%s,%s,%s,%s)",
+		coef(m[0]), coef(m[1]), coef(m[2]), coef(m[3]), coef(m[4]), coef(m[5]))
+}
+
+// p.id() returns a new id, unique also in nested drawings.
+func (p *PatternsT) id(kind string) string {
+	p.n++
+	prefix := ""
+	if s, ok := p.Drw.Draw.(*svgdraw.SvgT); ok {
+		prefix = s.IdPrefix
+	}
+	return fmt.Sprintf("%s%s%d", prefix, kind, p.n)
+}
+
+// p.opts() returns the options of the color spaces of the drawer.
+func (p *PatternsT) opts() *colorspace.Options {
+	if r, ok := p.Drw.Spaces.(*colorspace.ResourcesT); ok {
+		return r.Opts
+	}
+	return nil
+}
+
+// p.color() returns the paint of a color, "" if it has no device color.
+func (p *PatternsT) color(sp graf.ColorSpace, c []float64) string {
+	dc, ok := p.Drw.Draw.(graf.DrawerColor)
+	if !ok {
+		return ""
+	}
+	if name, v := sp.Device(c); name != "" {
+		return dc.Device(name, v)
+	}
+	return ""
+}
+
+// p.Pattern() writes a pattern at first use, patterns are mapped by their
+// /Matrix to default user space and from there by the inverse of ctm to the
+// one of the drawing.
+func (p *PatternsT) Pattern(name []byte, sp graf.ColorSpace, c []float64, ctm [6]float64) (r string) {
+	defer limits.Recover(func(interface{}) { r = "" })
+	o, ok := p.patterns[string(name)]
+	if !ok {
+		return ""
+	}
+	d := p.Pdf.Dic(o)
+	m := graf.Concat(matrix(p.Pdf, d["/Matrix"]), invert(ctm))
+	color := ""
+	if s, ok := sp.(*colorspace.SpaceT); ok && s.Base != nil {
+		color = p.color(s.Base, c)
+	}
+	key := fmt.Sprint(string(name), color, m)
+	if paint, ok := p.ids[key]; ok {
+		return paint
+	}
+	id := p.id("pattern")
+	switch int(number(p.Pdf, d["/PatternType"], 0)) {
+	case 1:
+		ok = p.tiling(o, d, id, color, m)
+	case 2:
+		ok = p.shadingPattern(d["/Shading"], id, m)
+	default:
+		ok = false
+	}
+	if ok {
+		r = "url(#" + id + ")"
+	}
+	p.ids[key] = r
+	return
+}
+
+// p.Shade() paints a shading of sh into the current clip, its /BBox or a
+// large area.
+func (p *PatternsT) Shade(name []byte) {
+	defer limits.Recover(func(interface{}) {})
+	o, ok := p.shadings[string(name)]
+	if !ok {
+		return
+	}
+	sh := p.shading(o)
+	if sh == nil {
+		return
+	}
+	if sh.typ != 2 && sh.typ != 3 {
+		p.Drw.Write.Out("%s", paths(p.mesh(sh)))
+		return
+	}
+	id := p.id("shading")
+	if !p.gradient(sh, id, "") {
+		return
+	}
+	x0, y0, x1, y1 := 0.0, 0.0, 0.0, 0.0
+	if len(sh.bbox) == 4 {
+		x0, y0, x1, y1 = sh.bbox[0], sh.bbox[1], sh.bbox[2], sh.bbox[3]
+	} else {
+		inv := invert(p.Drw.CTM())
+		x0, y0, x1, y1 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, c := range [4][2]float64{{-1, -1}, {-1, 1}, {1, -1}, {1, 1}} {
+			x, y := apply(inv, c[0]*SHADE_EXTENT, c[1]*SHADE_EXTENT)
+			x0, y0, x1, y1 = min(x0, x), min(y0, y), max(x1, x), max(y1, y)
+		}
+	}
+	p.Drw.Write.Out("<path d=\"M%s %s H%s V%s H%s Z\" fill=\"url(#%s)\" stroke=\"none\" />\n",
+		num(x0), num(y0), num(x1), num(y1), num(x0), id)
+}
+
+// p.tiling() writes a tiling pattern, uncolored ones are painted in color.
+// The cell is interpreted by a nested drawer with the /Resources of the
+// pattern.
+func (p *PatternsT) tiling(o []byte, d pdfreader.Dictionary, id, color string, m [6]float64) bool {
+	bbox := numbers(p.Pdf, d["/BBox"])
+	xstep := math.Abs(number(p.Pdf, d["/XStep"], 0))
+	ystep := math.Abs(number(p.Pdf, d["/YStep"], 0))
+	if len(bbox) != 4 || xstep == 0 || ystep == 0 {
+		return false
+	}
+	res := d["/Resources"]
+	drw := svgdraw.NewTestSvg()
+	drw.Draw.(*svgdraw.SvgT).IdPrefix = id + "-"
+	if s, ok := p.Drw.Draw.(*svgdraw.SvgT); ok {
+		drw.Draw.(*svgdraw.SvgT).CMYKProfile = s.CMYKProfile
+	}
+	drw.Nest(p.Drw)
+	drw.Spaces = colorspace.NewWith(p.Pdf, res, p.opts())
+	drw.GStates = extgstate.New(p.Pdf, res)
+	if oc, ok := p.Drw.Optional.(*optcontent.ResourcesT); ok {
+		drw.Optional = oc.Content.Resources(res)
+	}
+	if t, ok := p.Drw.Text.(*svgtext.SvgTextT); ok {
+		sub := svgtext.New(p.Pdf, drw)
+		sub.Page = t.Page
+		sub.EmbedFonts, sub.OutlineText = t.EmbedFonts, t.OutlineText
+		sub.UseResources(res, id+"-")
+	}
+	drw.ConfigD.LineWidth = "1"
+	drw.ConfigD.FillColor, drw.ConfigD.StrokeColor = "black", "black"
+	if number(p.Pdf, d["/PaintType"], 1) == 2 {
+		if color == "" {
+			color = "black"
+		}
+		drw.ConfigD.FillColor, drw.ConfigD.StrokeColor = color, color
+		drw.IgnoreColors()
+	}
+	if p.depth < MAX_DEPTH {
+		sub := New(p.Pdf, drw, res)
+		sub.depth = p.depth + 1
+		_, cell := p.Pdf.DecodedStream(o)
+		drw.Interpret(fancy.SliceReader(cell))
+		drw.Draw.CloseDrawing()
+	}
+	p.Drw.Write.Out("<defs><pattern id=\"%s\" patternUnits=\"userSpaceOnUse\""+
+		" x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" patternTransform=\"%s\">\n%s</pattern></defs>\n",
+		id, num(min(bbox[0], bbox[2])), num(min(bbox[1], bbox[3])), num(xstep), num(ystep),
+		transform(m), drw.Write.Content)
+	return true
+}
+
+// p.shadingPattern() writes a shading pattern, gradients or polygons in a
+// single large tile.
+func (p *PatternsT) shadingPattern(o []byte, id string, m [6]float64) bool {
+	sh := p.shading(o)
+	if sh == nil {
+		return false
+	}
+	if sh.typ == 2 || sh.typ == 3 {
+		return p.gradient(sh, id, transform(m))
+	}
+	polys := p.mesh(sh)
+	if len(polys) == 0 {
+		return false
+	}
+	x0, y0, x1, y1 := bounds(polys)
+	p.Drw.Write.Out("<defs><pattern id=\"%s\" patternUnits=\"userSpaceOnUse\""+
+		" x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" patternTransform=\"%s\">\n%s</pattern></defs>\n",
+		id, num(x0-SHADE_EXTENT), num(y0-SHADE_EXTENT),
+		num(x1-x0+2*SHADE_EXTENT), num(y1-y0+2*SHADE_EXTENT), transform(m), paths(polys))
+	return true
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package svgtext
+
+import (
+	"encoding/base64"
+	"math"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/encoding"
+	"github.com/grokify/pdfreader/truetype"
+	"github.com/grokify/pdfreader/type1"
+)
+
+// Embedding of fonts as @font-face rules. TrueType and OpenType font
+// programs are embedded as they are, bare CFF ones wrapped as OpenType and
+// Type 1 ones rebuilt as TrueType. Every font gets an own cmap: a code of a
+// simple font or a CID of a composite font maps to its Unicode value if
+// that is unique in the font and to a character of the private use area
+// otherwise. The text is written in these characters.
+
+const (
+	PUA_START  = 0xE000
+	PUA_END    = 0xF8FF
+	PUA2_START = 0xF0000 // supplementary private use area A
+)
+
+type fontFaceT struct {
+	family string
+	chars  map[int]rune // code or CID -> character of the font
+}
+
+// f.text() writes codes or CIDs as characters of the font, the ones the
+// font does not have are dropped.
+func (f *fontFaceT) text(keys []int) []byte {
+	r := make([]byte, 0, len(keys)*3)
+	for _, k := range keys {
+		if c, ok := f.chars[k]; ok {
+			r = utf8.AppendRune(r, c)
+		}
+	}
+	return r
+}
+
+// family() makes a CSS font family name of a font resource name.
+func family(font string) string {
+	r := []byte("pdffont-")
+	for k := 0; k < len(font); k++ {
+		if c := font[k]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			r = append(r, c)
+		} else if c != '/' {
+			r = append(r, '_')
+		}
+	}
+	return string(r)
+}
+
+func upm(fm []float64) int {
+	if len(fm) == 0 || fm[0] <= 0 {
+		return 1000
+	}
+	return int(math.Round(1 / fm[0]))
+}
+
+// t.simpleOutlines() finds the outlines of the codes of a simple font.
+func (t *SvgTextT) simpleOutlines(d pdfreader.Dictionary, o *outlinesT) {
+	r, gids := make(map[int][]byte), make(map[int]int)
+	o.paths = r
+	enc := encoding.Font(t.Pdf, d)
+	name := func(code int) string {
+		if enc == nil {
+			return ""
+		}
+		return enc[code]
+	}
+	if tt := t.trueType(d); tt != nil && tt.UnitsPerEm > 0 {
+		sym := t.symbolic(d)
+		for k := 0; k < 256; k++ {
+			gids[k] = tt.CodeToGlyph(k, name(k), sym)
+			r[k] = tt.Outline(gids[k])
+		}
+		o.unitsPerEm, o.gids = tt.UnitsPerEm, gids
+		return
+	}
+	var glyph func(code int) *type1.GlyphT
+	if c := t.cffFont(d); c != nil && c.CIDs == nil {
+		glyph = func(code int) *type1.GlyphT {
+			gids[code] = c.GlyphIndex(name(code))
+			return c.Glyph(gids[code])
+		}
+		o.unitsPerEm, o.gids = upm(c.FontMatrix), gids
+	} else if g := t.type1Glyphs(d); g != nil && enc != nil {
+		glyph = func(code int) *type1.GlyphT { return g.Glyph(name(code)) }
+		o.unitsPerEm = upm(g.FontMatrix)
+	} else {
+		return
+	}
+	for k := 0; k < 256; k++ {
+		if g := glyph(k); g != nil {
+			r[k] = g.Path
+		}
+	}
+}
+
+// t.cidOutlines() finds the outlines of the CIDs of a CIDFont.
+func (t *SvgTextT) cidOutlines(d pdfreader.Dictionary, o *outlinesT) {
+	r, gids := make(map[int][]byte), make(map[int]int)
+	o.paths = r
+	if tt := t.trueType(d); tt != nil && tt.UnitsPerEm > 0 {
+		if m, ok := d["/CIDToGIDMap"]; ok && string(t.Pdf.Obj(m)) != "/Identity" {
+			_, cg := t.Pdf.DecodedStream(m)
+			for k := 0; 2*k+1 < len(cg); k++ {
+				if g := int(cg[2*k])<<8 | int(cg[2*k+1]); g > 0 {
+					gids[k] = g
+					r[k] = tt.Outline(g)
+				}
+			}
+		} else {
+			for k := 1; k < tt.NumGlyphs; k++ {
+				gids[k] = k
+				r[k] = tt.Outline(k)
+			}
+		}
+		o.unitsPerEm, o.gids = tt.UnitsPerEm, gids
+		return
+	}
+	if c := t.cffFont(d); c != nil {
+		for g := 1; g < len(c.CharStrings); g++ {
+			cid := g
+			if c.CIDs != nil {
+				cid = c.CIDs[g]
+			}
+			if gl := c.Glyph(g); gl != nil {
+				gids[cid] = g
+				r[cid] = gl.Path
+			}
+		}
+		o.unitsPerEm, o.gids = upm(c.FontMatrix), gids
+	}
+}
+
+// outlinesT are the glyph outlines of a font by code (simple fonts) or
+// CID (composite fonts) in glyph units.
+type outlinesT struct {
+	unitsPerEm int
+	paths      map[int][]byte
+	gids       map[int]int // glyph indexes of the TrueType or CFF font program
+}
+
+// t.outlines() returns the outlines of a font, nil if it has no font
+// program this can handle.
+func (t *SvgTextT) outlines(font string) (r *outlinesT) {
+	var ok bool
+	if r, ok = t.glyphs[font]; ok {
+		return
+	}
+	if d := t.fontDic(font); d != nil {
+		r = new(outlinesT)
+		if string(d["/Subtype"]) == "/Type0" {
+			t.cidOutlines(t.descendant(d), r)
+		} else {
+			t.simpleOutlines(d, r)
+		}
+		if len(r.paths) == 0 {
+			r = nil
+		}
+	}
+	t.glyphs[font] = r
+	return
+}
+
+// t.face() returns the @font-face font of a font if fonts are embedded.
+func (t *SvgTextT) face(font string) *fontFaceT {
+	if !t.EmbedFonts {
+		return nil
+	}
+	return t.fontFace(font)
+}
+
+// validChar() tells if a character can be in the cmap of a font face.
+func validChar(u int) bool {
+	return u >= 0x20 && u != 0x7F && !(u >= 0x80 && u < 0xA0) &&
+		!(u >= 0xD800 && u < 0xE000) && u != 0xFEFF && u < 0x110000
+}
+
+// t.fontFace() returns the @font-face font of a font, it is written out at
+// first use. nil if the font has no font program this can handle.
+func (t *SvgTextT) fontFace(font string) (r *fontFaceT) {
+	var ok bool
+	if r, ok = t.faces[font]; ok {
+		return
+	}
+	t.faces[font] = nil
+	d := t.fontDic(font)
+	if d == nil {
+		return
+	}
+	o := t.outlines(font)
+	if o == nil || len(o.paths) >= 0xFFFF {
+		return
+	}
+	unitsPerEm, outlines := o.unitsPerEm, o.paths
+	uni := func(k int) int { return t.cmap(font).Uni.Code(k) }
+	if string(d["/Subtype"]) == "/Type0" {
+		if cu := t.cidUnicode(font); cu != nil {
+			uni = func(k int) int { return cu.Uni.Code(k) }
+		} else if e := string(t.Pdf.Obj(d["/Encoding"])); e != "/Identity-H" && e != "/Identity-V" {
+			uni = func(k int) int { return -1 }
+		}
+	}
+	keys := make([]int, 0, len(outlines))
+	for k := range outlines {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	W := t.widths(font)
+	advance := func(k int) int { return max(0, W.Code(k)*unitsPerEm/WIDTH_DENSITY) }
+	glyphs := []truetype.GlyphT{{}}
+	cmap := make(map[int]int)
+	r = &fontFaceT{t.prefix + family(font), make(map[int]rune)}
+	pua := PUA_START
+	for _, k := range keys {
+		u := uni(k)
+		if _, used := cmap[u]; !validChar(u) || used {
+			for _, used = cmap[pua]; used; _, used = cmap[pua] {
+				if pua++; pua == PUA_END+1 {
+					pua = PUA2_START
+				}
+			}
+			u = pua
+		}
+		cmap[u] = len(glyphs)
+		r.chars[k] = rune(u)
+		glyphs = append(glyphs, truetype.GlyphT{Advance: advance(k), Path: outlines[k]})
+	}
+	prg, format := t.program(d, o, r.family, keys, r.chars, advance)
+	if prg == nil {
+		prg, format = truetype.Build(r.family, unitsPerEm, glyphs, cmap), "truetype"
+	}
+	mime := "ttf"
+	if format == "opentype" {
+		mime = "otf"
+	}
+	t.Drw.Write.Out("<defs><style type=\"text/css\">"+
+		"@font-face{font-family:\"%s\";src:url(data:font/%s;base64,%s) format(\"%s\");}"+
+		"</style></defs>\n",
+		r.family, mime, base64.StdEncoding.EncodeToString(prg), format)
+	t.faces[font] = r
+	return
+}
+
+// t.program() writes the TrueType, OpenType or CFF font program of a font
+// for @font-face with the characters chars of the codes or CIDs keys and
+// their advances, and returns it with its CSS format. nil for Type 1 font
+// programs and the ones that can not be rewritten.
+func (t *SvgTextT) program(d pdfreader.Dictionary, o *outlinesT, name string,
+	keys []int, chars map[int]rune, advance func(int) int) ([]byte, string) {
+	if o.gids == nil {
+		return nil, ""
+	}
+	if string(d["/Subtype"]) == "/Type0" {
+		d = t.descendant(d)
+	}
+	fd := t.Pdf.Dic(d["/FontDescriptor"])
+	ff, ok := fd["/FontFile2"]
+	if !ok {
+		if ff, ok = fd["/FontFile3"]; !ok {
+			return nil, ""
+		}
+	}
+	_, data := t.Pdf.DecodedStream(ff)
+	cmap, advances := make(map[int]int), make(map[int]int)
+	for _, k := range keys {
+		if g, ok := o.gids[k]; ok && g >= 0 {
+			cmap[int(chars[k])] = g
+			advances[g] = advance(k)
+		}
+	}
+	if len(data) >= 4 {
+		switch string(data[:4]) {
+		case "\x00\x01\x00\x00", "true":
+			return truetype.Rewrite(name, data, cmap, advances), "truetype"
+		case "OTTO":
+			return truetype.Rewrite(name, data, cmap, advances), "opentype"
+		}
+	}
+	c := t.cffFont(d)
+	if c == nil {
+		return nil, ""
+	}
+	glyphs := make([]truetype.GlyphT, len(c.CharStrings))
+	for g := range glyphs {
+		if a, ok := advances[g]; ok {
+			glyphs[g].Advance = a
+		} else {
+			glyphs[g].Advance = max(0, int(math.Round(c.Width(g))))
+		}
+	}
+	for _, k := range keys {
+		if g, ok := o.gids[k]; ok && g >= 0 && g < len(glyphs) {
+			glyphs[g].Path = o.paths[k]
+		}
+	}
+	return truetype.WrapCFF(name, data, o.unitsPerEm, glyphs, cmap), "opentype"
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package svgtext
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/grokify/pdfreader/cmapi"
+	"github.com/grokify/pdfreader/strm"
+	"github.com/grokify/pdfreader/svgdraw"
+)
+
+// Text as glyph outlines: every glyph is a <symbol> in glyph units, shown
+// by <use> with font size, horizontal scaling (Tz), rise (Ts), character
+// and word spacing (Tc, Tw). The text render modes (Tr) select fill and
+// stroke, the glyphs of the clip modes 4 to 7 are collected and clip at ET.
+
+// position of the glyph origin relative to the current point of vertical
+// fonts, in 1/1000 em below the top; w0/2 is the horizontal part.
+const VERTICAL_ORIGIN = 880
+
+func float(s string, def float64) float64 {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v
+	}
+	return def
+}
+
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*10000)/10000, 'f', -1, 64)
+}
+
+// coef() formats a scale factor of a transformation with 6 digits.
+func coef(v float64) string {
+	if v == 0 {
+		v = 0 // no -0
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// svgPath() converts PDF path operators to SVG path data.
+func svgPath(p []byte) string {
+	r := make([]string, 0, 64)
+	var st []string
+	for _, t := range strings.Fields(string(p)) {
+		switch t {
+		case "m":
+			r = append(r, "M"+strings.Join(st, " "))
+		case "l":
+			r = append(r, "L"+strings.Join(st, " "))
+		case "c":
+			r = append(r, "C"+strings.Join(st, " "))
+		case "h":
+			r = append(r, "Z")
+		default:
+			st = append(st, t)
+			continue
+		}
+		st = st[0:0]
+	}
+	return strings.Join(r, " ")
+}
+
+// t.symbol() returns the id of the <symbol> of a glyph, it is written out
+// at first use. "" for glyphs without outline.
+func (t *SvgTextT) symbol(font string, o *outlinesT, key int) string {
+	path := o.paths[key]
+	if len(path) == 0 {
+		return ""
+	}
+	id := t.prefix + family(font) + "-" + strconv.Itoa(key)
+	if !t.symbols[id] {
+		t.Drw.Write.Out("<defs><symbol id=\"%s\" overflow=\"visible\">"+
+			"<path d=\"%s\"/></symbol></defs>\n", id, svgPath(path))
+		t.symbols[id] = true
+	}
+	return id
+}
+
+// t.paint() returns the paint attributes of the text render mode, "" for
+// invisible text.
+func (t *SvgTextT) paint(scale float64) string {
+	fill := t.Drw.ConfigD.FillColor
+	if fill == "" {
+		fill = "black"
+	}
+	stroke := "stroke=\"" + t.Drw.ConfigD.StrokeColor + "\" stroke-width=\"" +
+		num(float(t.Drw.ConfigD.LineWidth, 1)/scale) + "\""
+	switch strm.Int(t.Drw.TConfD.Render, 1) {
+	case 0, 4:
+		return "fill=\"" + fill + "\" stroke=\"none\""
+	case 1, 5:
+		return "fill=\"none\" " + stroke
+	case 2, 6:
+		return "fill=\"" + fill + "\" " + stroke
+	}
+	return ""
+}
+
+// t.showOutlines() shows a string as glyph outlines, false if the font has
+// none.
+func (t *SvgTextT) showOutlines(s []byte) bool {
+	font := t.Drw.TConfD.Font
+	o := t.outlines(font)
+	if o == nil || o.unitsPerEm <= 0 {
+		return false
+	}
+	tc := t.Drw.TConfD
+	fs := float(tc.FontSize, 0)
+	th := float(tc.Scale, 100) / 100
+	cs, ws := float(tc.CharSpace, 0), float(tc.WordSpace, 0)
+	rise := float(tc.Rise, 0)
+	W := t.widths(font)
+	var keys []int
+	vertical := false
+	if enc := t.encoding(font); enc != nil {
+		vertical = enc.WMode == 1
+		for _, c := range cmapi.Codes(s, enc) {
+			keys = append(keys, max(0, enc.CID.Code(c)))
+		}
+	} else {
+		for _, c := range s {
+			keys = append(keys, int(c))
+		}
+	}
+	scale := fs / float64(o.unitsPerEm)
+	paint := t.paint(scale)
+	clip := strm.Int(tc.Render, 1) >= 4
+	m := fmt.Sprintf("matrix(%s,%s,%s,%s,%s,%s)", t.matrix[0], t.matrix[1],
+		strm.Neg(t.matrix[2]), strm.Neg(t.matrix[3]), t.matrix[4], t.matrix[5])
+	t.show("<g transform=\"%s\"%s>\n", m, svgdraw.Transparency(t.Drw.ConfigD))
+	x, y := float(t.x, 0), float(t.y, 0) // y is downwards
+	for k, key := range keys {
+		w0 := float64(W.Code(key)) / WIDTH_DENSITY
+		gx, gy := x, y-rise
+		if vertical {
+			gx -= w0 / 2 * fs
+			gy += VERTICAL_ORIGIN / 1000.0 * fs
+		}
+		if id := t.symbol(font, o, key); id != "" && paint != "" {
+			t.show("<use xlink:href=\"#%s\" transform=\"matrix(%s,0,0,%s,%s,%s)\" %s/>\n",
+				id, coef(scale*th), coef(-scale), num(gx), num(gy), paint)
+		}
+		if len(o.paths[key]) > 0 && clip {
+			t.clip = append(t.clip, fmt.Sprintf("<path transform=\"%s matrix(%s,0,0,%s,%s,%s)\" d=\"%s\"/>",
+				m, coef(scale*th), coef(-scale), num(gx), num(gy), svgPath(o.paths[key])))
+		}
+		space := 0.0
+		if len(keys) == len(s) && s[k] == 32 {
+			space = ws
+		}
+		if vertical {
+			y -= float64(t.fontw2[font].Code(key))/WIDTH_DENSITY*fs + cs + space
+		} else {
+			x += (w0*fs + cs + space) * th
+		}
+	}
+	t.show("</g>\n")
+	t.x, t.y = num(x), num(y)
+	return true
+}
+
+// t.EndText() clips by the glyphs of the clip render modes at ET.
+func (t *SvgTextT) EndText() {
+	if s, ok := t.Drw.Draw.(*svgdraw.SvgT); ok && len(t.clip) > 0 {
+		s.ClipBy(strings.Join(t.clip, ""))
+	}
+	t.clip = nil
+}
@@ -10,28 +10,55 @@ package svgtext
 
 import (
 	"os"
+	"strconv"
 
 	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/afm"
+	"github.com/grokify/pdfreader/cff"
 	"github.com/grokify/pdfreader/cmapi"
 	"github.com/grokify/pdfreader/cmapt"
+	"github.com/grokify/pdfreader/encoding"
 	"github.com/grokify/pdfreader/fancy"
 	"github.com/grokify/pdfreader/graf"
+	"github.com/grokify/pdfreader/limits"
 	"github.com/grokify/pdfreader/ps"
 	"github.com/grokify/pdfreader/strm"
+	"github.com/grokify/pdfreader/svgdraw"
+	"github.com/grokify/pdfreader/truetype"
+	"github.com/grokify/pdfreader/type1"
 	"github.com/grokify/pdfreader/util"
 )
 
 const WIDTH_DENSITY = 10000
 
+// adjustments of TJ larger than this, in thousandths of the font size, are
+// spaces for TextOut.
+const TEXT_GAP = 250
+
 type SvgTextT struct {
-	Pdf      *pdfreader.PDFReader
-	Drw      *graf.PdfDrawerT
-	Page     int
-	matrix   []string
-	fonts    pdfreader.Dictionary
-	fontw    map[string]*cmapt.CMapT
-	x0, x, y string
-	cmaps    map[string]*cmapi.CharMapperT
+	Pdf         *pdfreader.PDFReader
+	Drw         *graf.PdfDrawerT
+	Page        int
+	EmbedFonts  bool              // embed the fonts as @font-face, see fontface.go
+	OutlineText bool              // draw glyphs as outlines, see outline.go
+	TextOut     func(text []byte) // gets the text shown as UTF-8, for extraction
+	matrix      []string
+	fonts       pdfreader.Dictionary
+	fontw       map[string]*cmapt.CMapT
+	fontw2      map[string]*cmapt.CMapT // vertical advances of CID fonts
+	x0, x, y    string
+	cmaps       map[string]*cmapi.CharMapperT
+	encs        map[string]*cmapi.CharMapperT // CMaps of composite fonts
+	cids        map[string]*cmapi.CharMapperT // CID to Unicode of composite fonts
+	ttfs        map[string]*truetype.FontT    // embedded TrueType fonts by /FontFile2
+	cffs        map[string]*cff.FontT         // embedded CFF fonts by /FontFile3
+	faces       map[string]*fontFaceT         // fonts written as @font-face
+	glyphs      map[string]*outlinesT         // glyph outlines of the fonts
+	symbols     map[string]bool               // glyphs written as <symbol>
+	clip        []string                      // glyphs of the clip render modes, see outline.go
+	hidden      bool                          // strings only move, see TMove()
+	prefix      string                        // of ids in glyphs of Type 3 fonts
+	depth       int                           // of nesting in Type 3 glyphs
 }
 
 func New(pdf *pdfreader.PDFReader, drw *graf.PdfDrawerT) *SvgTextT {
@@ -41,9 +68,27 @@ func New(pdf *pdfreader.PDFReader, drw *graf.PdfDrawerT) *SvgTextT {
 	r.Pdf = pdf
 	r.TSetMatrix(nil)
 	r.cmaps = make(map[string]*cmapi.CharMapperT)
+	r.encs = make(map[string]*cmapi.CharMapperT)
+	r.cids = make(map[string]*cmapi.CharMapperT)
+	r.fontw2 = make(map[string]*cmapt.CMapT)
+	r.ttfs = make(map[string]*truetype.FontT)
+	r.cffs = make(map[string]*cff.FontT)
+	r.faces = make(map[string]*fontFaceT)
+	r.glyphs = make(map[string]*outlinesT)
+	r.symbols = make(map[string]bool)
 	return r
 }
 
+// t.UseResources() takes the fonts of a /Resources dictionary, like the one
+// of a tiling pattern, instead of the ones of the page. The ids t writes get
+// prefix.
+func (t *SvgTextT) UseResources(resources []byte, prefix string) {
+	if f, ok := t.Pdf.Dic(resources)["/Font"]; ok {
+		t.fonts = t.Pdf.Dic(f)
+	}
+	t.prefix = prefix
+}
+
 // ------------------------------------------------ Font Substitution
 
 const DEFAULT_FSTYLE = "font-family:Arial;"
@@ -122,62 +167,335 @@ func FStyle(f string) string {
 
 // ------------------------------------------------
 
-func (t *SvgTextT) Style(font string) (r string) {
-	r = DEFAULT_FSTYLE
+// t.fontDic() returns the dictionary of a font of the page, nil if there is
+// no such font.
+func (t *SvgTextT) fontDic(font string) pdfreader.Dictionary {
 	if t.fonts == nil {
 		t.fonts = t.Pdf.PageFonts(t.Pdf.Pages()[t.Page])
 		if t.fonts == nil {
-			return
+			return nil
 		}
 	}
 	if dr, ok := t.fonts[font]; ok {
-		d := t.Pdf.Dic(dr)
-		if fd, ok := d["/FontDescriptor"]; ok { // FIXME: Too simple...
-			return FStyle(string(t.Pdf.Dic(fd)["/FontName"]))
+		return t.Pdf.Dic(dr)
+	}
+	return nil
+}
+
+// t.descendant() returns the CIDFont dictionary of a composite font.
+func (t *SvgTextT) descendant(d pdfreader.Dictionary) pdfreader.Dictionary {
+	if df := t.Pdf.Arr(d["/DescendantFonts"]); len(df) > 0 {
+		return t.Pdf.Dic(df[0])
+	}
+	return pdfreader.Dictionary{}
+}
+
+func (t *SvgTextT) Style(font string) (r string) {
+	r = DEFAULT_FSTYLE
+	d := t.fontDic(font)
+	if d == nil {
+		return
+	}
+	if string(d["/Subtype"]) == "/Type0" {
+		d = t.descendant(d)
+	}
+	if fd, ok := d["/FontDescriptor"]; ok { // FIXME: Too simple...
+		r = FStyle(string(t.Pdf.Dic(fd)["/FontName"]))
+	}
+	if f := t.face(font); f != nil {
+		r = "font-family:'" + f.family + "';"
+	}
+	if e := t.encoding(font); e != nil && e.WMode == 1 {
+		r += "writing-mode:tb;"
+	}
+	return
+}
+
+// t.encoding() returns the CMap of a composite font, nil for simple fonts.
+func (t *SvgTextT) encoding(font string) (r *cmapi.CharMapperT) {
+	var ok bool
+	if r, ok = t.encs[font]; ok {
+		return
+	}
+	if d := t.fontDic(font); d != nil && string(d["/Subtype"]) == "/Type0" {
+		e := d["/Encoding"]
+		switch n := string(t.Pdf.Obj(e)); {
+		case n == "/Identity-H":
+			r = cmapi.Identity(2)
+		case n == "/Identity-V":
+			r = cmapi.Identity(2)
+			r.WMode = 1
+		case len(n) > 0 && n[0] == '/':
+			if r = cmapi.Predefined(n); r == nil {
+				r = cmapi.Identity(2)
+			}
+		default:
+			dic, cm := t.Pdf.DecodedStream(e)
+			r = cmapi.Read(fancy.SliceReader(cm))
+			if u := cmapi.Predefined(string(t.Pdf.Obj(dic["/UseCMap"]))); u != nil {
+				r.Use(u)
+			}
+		}
+	}
+	t.encs[font] = r
+	return
+}
+
+// t.cidUnicode() returns the mapping of CIDs to Unicode for composite
+// fonts without /ToUnicode. It is found by the /CIDSystemInfo of the
+// CIDFont, nil if there is none for it.
+func (t *SvgTextT) cidUnicode(font string) (r *cmapi.CharMapperT) {
+	var ok bool
+	if r, ok = t.cids[font]; ok {
+		return
+	}
+	if d := t.fontDic(font); d != nil && d["/ToUnicode"] == nil {
+		si := t.Pdf.Dic(t.descendant(d)["/CIDSystemInfo"])
+		if reg, ord := si["/Registry"], si["/Ordering"]; reg != nil && ord != nil &&
+			string(ps.String(reg)) == "Adobe" {
+			o := string(ps.String(ord))
+			if o == "KR" || o == "Korea1" || o == "Japan1" || o == "GB1" || o == "CNS1" {
+				r = cmapi.Predefined("Adobe-" + o + "-UCS2")
+			}
+		}
+		if r == nil {
+			r = t.trueTypeCIDs(t.descendant(d))
 		}
 	}
+	t.cids[font] = r
 	return
 }
 
+// cidWidths() reads /W (vertical=false) or /W2 arrays of a CIDFont. For
+// /W2 only the vertical advance w1y is kept.
+func (t *SvgTextT) cidWidths(r *cmapt.CMapT, w []byte, vertical bool) {
+	n := 1
+	if vertical {
+		n = 3
+	}
+	a := t.Pdf.Arr(w)
+	for k := 0; k+1 < len(a); {
+		c := strm.Int(string(t.Pdf.Obj(a[k])), 1)
+		if l := t.Pdf.Obj(a[k+1]); len(l) > 0 && l[0] == '[' {
+			v := t.Pdf.Arr(l)
+			for i := 0; i < len(v); i += n {
+				r.Add(c+i/n, strm.Int(string(t.Pdf.Obj(v[i])), WIDTH_DENSITY/1000))
+			}
+			k += 2
+			continue
+		}
+		if k+2 >= len(a) {
+			break
+		}
+		l := strm.Int(string(t.Pdf.Obj(a[k+1])), 1)
+		r.AddDef(c, l+1, strm.Int(string(t.Pdf.Obj(a[k+2])), WIDTH_DENSITY/1000))
+		k += 2 + n
+	}
+}
+
+// t.compositeWidths() sets up horizontal and vertical widths of a
+// composite font, both indexed by CID.
+func (t *SvgTextT) compositeWidths(font string, d pdfreader.Dictionary) *cmapt.CMapT {
+	d = t.descendant(d)
+	dw := 1000
+	if w, ok := d["/DW"]; ok {
+		dw = strm.Int(string(t.Pdf.Obj(w)), 1)
+	}
+	r := cmapt.New()
+	r.AddDef(0, 1<<16, dw*WIDTH_DENSITY/1000)
+	if w, ok := d["/W"]; ok {
+		t.cidWidths(r, w, false)
+	}
+	w1y := -1000
+	if w, ok := d["/DW2"]; ok {
+		if a := t.Pdf.Arr(w); len(a) == 2 {
+			w1y = strm.Int(string(a[1]), 1)
+		}
+	}
+	r2 := cmapt.New()
+	r2.AddDef(0, 1<<16, w1y*WIDTH_DENSITY/1000)
+	if w, ok := d["/W2"]; ok {
+		t.cidWidths(r2, w, true)
+	}
+	t.fontw[font] = r
+	t.fontw2[font] = r2
+	return r
+}
+
 func (t *SvgTextT) widths(font string) (r *cmapt.CMapT) {
 	if t.fontw == nil {
 		t.fontw = make(map[string]*cmapt.CMapT)
 	} else if r, ok := t.fontw[font]; ok {
 		return r
 	}
+	d := t.fontDic(font)
+	if d != nil && string(d["/Subtype"]) == "/Type0" {
+		return t.compositeWidths(font, d)
+	}
+	if d != nil && string(d["/Subtype"]) == "/Type3" {
+		return t.type3Widths(font, d)
+	}
 	// initialize like for Courier.
 	r = cmapt.New()
 	r.AddDef(0, 256, 600*WIDTH_DENSITY/1000)
-	if t.fonts == nil {
-		t.fonts = t.Pdf.PageFonts(t.Pdf.Pages()[t.Page])
-		if t.fonts == nil {
-			return
-		}
+	t.fontw[font] = r
+	if d == nil {
+		return
 	}
-	if dr, ok := t.fonts[font]; ok {
-		d := t.Pdf.Dic(dr)
-		fc, ok := d["/FirstChar"]
-		if !ok {
-			return
+	// Kerning pairs are not applied, PDF positions glyphs by widths only.
+	if m := afm.Standard(string(d["/BaseFont"])); m != nil {
+		enc := encoding.Font(t.Pdf, d)
+		if enc == nil {
+			enc = &m.Encoding
 		}
-		lc, ok := d["/LastChar"]
-		if !ok {
-			return
+		for k, n := range enc {
+			if w, ok := m.Widths[n]; ok {
+				r.Add(k, w*WIDTH_DENSITY/1000)
+			}
 		}
-		wd, ok := d["/Widths"]
-		if !ok {
-			return
+	}
+	if tt := t.trueType(d); tt != nil && tt.UnitsPerEm > 0 {
+		enc, sym := encoding.Font(t.Pdf, d), t.symbolic(d)
+		for k := 0; k < 256; k++ {
+			n := ""
+			if enc != nil {
+				n = enc[k]
+			}
+			if g := tt.CodeToGlyph(k, n, sym); g > 0 {
+				r.Add(k, tt.Advance(g)*WIDTH_DENSITY/tt.UnitsPerEm)
+			}
+		}
+	}
+	if c, enc := t.cffFont(d), encoding.Font(t.Pdf, d); c != nil && c.CIDs == nil && enc != nil {
+		scale := c.FontMatrix[0] * WIDTH_DENSITY
+		for k, n := range enc {
+			if w := c.Width(c.GlyphIndex(n)); n != "" && w >= 0 {
+				r.Add(k, int(w*scale))
+			}
 		}
-		p := strm.Int(string(fc), 1)
-		q := strm.Int(string(lc), 1)
-		a := t.Pdf.Arr(wd)
-		for k := p; k < q; k++ {
-			r.Add(k, strm.Int(string(a[k-p]), WIDTH_DENSITY/1000))
+	}
+	if g, enc := t.type1Glyphs(d), encoding.Font(t.Pdf, d); g != nil && enc != nil {
+		scale := g.FontMatrix[0] * WIDTH_DENSITY
+		for k, n := range enc {
+			if w := g.Width(n); w >= 0 {
+				r.Add(k, int(w*scale))
+			}
 		}
 	}
+	fc, ok := d["/FirstChar"]
+	if !ok {
+		return
+	}
+	lc, ok := d["/LastChar"]
+	if !ok {
+		return
+	}
+	wd, ok := d["/Widths"]
+	if !ok {
+		return
+	}
+	p := strm.Int(string(fc), 1)
+	q := strm.Int(string(lc), 1)
+	a := t.Pdf.Arr(wd)
+	for k := p; k <= q && k-p < len(a); k++ {
+		r.Add(k, strm.Int(string(a[k-p]), WIDTH_DENSITY/1000))
+	}
+	return
+}
+
+// t.type1Glyphs() reads the glyphs of an embedded Type 1 font, nil if there
+// is none or it can not be read.
+func (t *SvgTextT) type1Glyphs(d pdfreader.Dictionary) (g *type1.GlyphsT) {
+	fd, ok := d["/FontDescriptor"]
+	if !ok {
+		return nil
+	}
+	ff, ok := t.Pdf.Dic(fd)["/FontFile"]
+	if !ok {
+		return nil
+	}
+	defer limits.Recover(func(interface{}) { g = nil })
+	_, prg := t.Pdf.DecodedStream(ff)
+	if g = type1.NewGlyphs(type1.Read(fancy.SliceReader(prg))); g != nil && len(g.FontMatrix) < 4 {
+		g = nil
+	}
 	return
 }
 
+// t.trueType() reads the embedded TrueType font of a simple font or a
+// CIDFont, nil if there is none or it can not be read.
+func (t *SvgTextT) trueType(d pdfreader.Dictionary) *truetype.FontT {
+	fd, ok := d["/FontDescriptor"]
+	if !ok {
+		return nil
+	}
+	ff, ok := t.Pdf.Dic(fd)["/FontFile2"]
+	if !ok {
+		// OpenType fonts with TrueType outlines
+		if ff, ok = t.Pdf.Dic(fd)["/FontFile3"]; !ok {
+			return nil
+		}
+	}
+	if r, ok := t.ttfs[string(ff)]; ok {
+		return r
+	}
+	_, prg := t.Pdf.DecodedStream(ff)
+	r := truetype.Read(prg)
+	t.ttfs[string(ff)] = r
+	return r
+}
+
+// t.cffFont() reads the embedded CFF font (/FontFile3) of a simple font or
+// a CIDFont, nil if there is none or it can not be read.
+func (t *SvgTextT) cffFont(d pdfreader.Dictionary) *cff.FontT {
+	fd, ok := d["/FontDescriptor"]
+	if !ok {
+		return nil
+	}
+	ff, ok := t.Pdf.Dic(fd)["/FontFile3"]
+	if !ok {
+		return nil
+	}
+	if r, ok := t.cffs[string(ff)]; ok {
+		return r
+	}
+	_, prg := t.Pdf.DecodedStream(ff)
+	r := cff.Read(prg)
+	t.cffs[string(ff)] = r
+	return r
+}
+
+// t.symbolic() tells if the font descriptor of a font has the symbolic flag.
+func (t *SvgTextT) symbolic(d pdfreader.Dictionary) bool {
+	fl := t.Pdf.Dic(d["/FontDescriptor"])["/Flags"]
+	return fl != nil && strm.Int(string(t.Pdf.Obj(fl)), 1)&4 != 0
+}
+
+// t.trueTypeCIDs() maps the CIDs of a CIDFontType2 to Unicode by the cmaps
+// of its embedded font and /CIDToGIDMap, nil if there is no such font.
+func (t *SvgTextT) trueTypeCIDs(d pdfreader.Dictionary) *cmapi.CharMapperT {
+	tt := t.trueType(d)
+	if tt == nil {
+		return nil
+	}
+	r := cmapi.NewCharMapperT()
+	if m, ok := d["/CIDToGIDMap"]; ok && string(t.Pdf.Obj(m)) != "/Identity" {
+		_, gids := t.Pdf.DecodedStream(m)
+		for k := 0; 2*k+1 < len(gids); k++ {
+			if u := tt.Unicode(int(gids[2*k])<<8 | int(gids[2*k+1])); u >= 0 {
+				r.Uni.Add(k, u)
+			}
+		}
+		return r
+	}
+	for k := 0; k < tt.NumGlyphs; k++ {
+		if u := tt.Unicode(k); u >= 0 {
+			r.Uni.Add(k, u)
+		}
+	}
+	return r
+}
+
 var cm_identity = cmapi.Read(nil)
 
 func (t *SvgTextT) cmap(font string) (r *cmapi.CharMapperT) {
@@ -197,19 +515,106 @@ func (t *SvgTextT) cmap(font string) (r *cmapi.CharMapperT) {
 		if tu, ok := d["/ToUnicode"]; ok {
 			_, cm := t.Pdf.DecodedStream(tu)
 			r = cmapi.Read(fancy.SliceReader(cm))
-			t.cmaps[font] = r
+		} else if enc := encoding.Font(t.Pdf, d); enc != nil && string(d["/Subtype"]) == "/Type3" {
+			r = type3Mapper(enc)
+		} else if enc != nil {
+			r = encodingMapper(enc)
+		} else if tt := t.trueType(d); tt != nil {
+			r = trueTypeMapper(tt, t.symbolic(d))
+		} else if e := t.encoding(font); e != nil {
+			r = e
 		}
+		t.cmaps[font] = r
 	}
 	return
 }
 
+// encodingMapper() maps the codes of a simple font to Unicode by the glyph
+// names of its encoding, ligatures to all of their characters. Codes
+// without known glyph stay as they are.
+func encodingMapper(enc *[256]string) *cmapi.CharMapperT {
+	r := cmapi.NewCharMapperT()
+	r.Ranges.AddDef(0, 256, 1)
+	for k := range enc {
+		var u []rune
+		if enc[k] != "" {
+			u = encoding.Text(enc[k])
+		}
+		switch len(u) {
+		case 0:
+			r.Uni.Add(k, k)
+		case 1:
+			r.Uni.Add(k, int(u[0]))
+		default:
+			if r.Strings == nil {
+				r.Strings = make(map[int][]rune)
+			}
+			r.Strings[k] = u
+		}
+	}
+	return r
+}
+
+// trueTypeMapper() maps the codes of a simple TrueType font without encoding
+// to Unicode by the glyphs of the font program.
+func trueTypeMapper(tt *truetype.FontT, symbolic bool) *cmapi.CharMapperT {
+	r := cmapi.NewCharMapperT()
+	r.Ranges.AddDef(0, 256, 1)
+	for k := 0; k < 256; k++ {
+		u := tt.Unicode(tt.CodeToGlyph(k, "", symbolic))
+		if u < 0 {
+			u = k
+		}
+		r.Uni.Add(k, u)
+	}
+	return r
+}
+
+// t.Utf8TsAdvance() decodes a string shown with the current font and
+// returns its advance in writing direction - downwards for vertical fonts.
 func (t *SvgTextT) Utf8TsAdvance(s []byte) ([]byte, int64) {
-	W := t.widths(t.Drw.TConfD.Font)
+	font := t.Drw.TConfD.Font
+	W := t.widths(font)
 	width := int64(0)
-	for k := range s {
-		width += int64(W.Code(int(s[k])))
+	enc := t.encoding(font)
+	if enc == nil {
+		codes := make([]int, len(s))
+		for k := range s {
+			codes[k] = int(s[k])
+			width += int64(W.Code(codes[k]))
+		}
+		if f := t.face(font); f != nil {
+			return f.text(codes), width
+		}
+		return cmapi.Decode(s, t.cmap(font)), width
+	}
+	if enc.WMode == 1 {
+		W = t.fontw2[font]
+	}
+	codes := cmapi.Codes(s, enc)
+	cids := make([]int, len(codes))
+	for k, c := range codes {
+		if cids[k] = enc.CID.Code(c); cids[k] < 0 {
+			cids[k] = 0
+		}
+		w := int64(W.Code(cids[k]))
+		if enc.WMode == 1 {
+			w = -w
+		}
+		width += w
+	}
+	if f := t.face(font); f != nil {
+		return f.text(cids), width
 	}
-	return cmapi.Decode(s, t.cmap(t.Drw.TConfD.Font)), width
+	if cu := t.cidUnicode(font); cu != nil {
+		return cmapi.UnicodeOf(cids, cu), width
+	}
+	return cmapi.UnicodeOf(codes, t.cmap(font)), width
+}
+
+func (t *SvgTextT) vertical() bool {
+	e := t.encoding(t.Drw.TConfD.Font)
+	return e != nil && e.WMode == 1
 }
 
 func (t *SvgTextT) Utf8Advance(s []byte) ([]byte, string) {
@@ -218,12 +623,18 @@ func (t *SvgTextT) Utf8Advance(s []byte) ([]byte, string) {
 }
 
 func (t *SvgTextT) TMoveTo(s [][]byte) {
+	if t.TextOut != nil && strm.Int(string(s[1]), 1000) != 0 {
+		t.TextOut([]byte{'\n'})
+	}
 	t.x0 = strm.Add(t.x0, string(s[0]))
 	t.x = t.x0
 	t.y = strm.Sub(t.y, string(s[1]))
 }
 
 func (t *SvgTextT) TNextLine() {
+	if t.TextOut != nil {
+		t.TextOut([]byte{'\n'})
+	}
 	t.x = t.x0
 	t.y = strm.Add(t.y, t.Drw.TConfD.Leading)
 }
@@ -268,16 +679,69 @@ func space_split(a []byte) [][]byte {
 	return r
 }
 
+// t.adjustment() converts a number of a TJ array to text space. Outline
+// text and Type 3 fonts honor the horizontal scaling.
+func (t *SvgTextT) adjustment(n []byte) string {
+	r := strm.Mul(strm.Mul(string(n), "0.001"), t.Drw.TConfD.FontSize)
+	glyphs := t.OutlineText || t.type3(t.Drw.TConfD.Font) != nil
+	if glyphs && !t.vertical() && t.Drw.TConfD.Scale != "" {
+		r = strm.Mul(r, strm.Mul(t.Drw.TConfD.Scale, "0.01"))
+	}
+	return r
+}
+
+// t.textOut() passes the text of an element of TJ to t.TextOut, large
+// adjustments as space. New lines are passed by TMoveTo() and TNextLine().
+func (t *SvgTextT) textOut(e []byte) {
+	if e[0] == '(' || e[0] == '<' {
+		s, _ := t.Utf8TsAdvance(ps.String(e))
+		t.TextOut(s)
+	} else if v, err := strconv.ParseFloat(string(e), 64); err == nil && v < -TEXT_GAP {
+		t.TextOut([]byte{' '})
+	}
+}
+
+// t.show() writes shown text, nothing for hidden text. Definitions like
+// fonts and glyphs are written as they are needed.
+func (t *SvgTextT) show(f string, args ...interface{}) {
+	if !t.hidden {
+		t.Drw.Write.Out(f, args...)
+	}
+}
+
+// t.TMove() moves over the strings of Tj or TJ like TShow() without
+// showing them, for hidden optional content.
+func (t *SvgTextT) TMove(a []byte) {
+	out := t.TextOut
+	t.hidden, t.TextOut = true, nil
+	defer func() { t.hidden, t.TextOut = false, out }()
+	t.TShow(a)
+}
+
 func (t *SvgTextT) TShow(a []byte) {
 	tx := t.Pdf.ForcedArray(a) // FIXME: Should be "ForcedSimpleArray()"
 	for k := range tx {
+		if t.TextOut != nil {
+			t.textOut(tx[k])
+		}
+		if str := tx[k][0] == '(' || tx[k][0] == '<'; str && t.showType3(ps.String(tx[k])) ||
+			str && t.OutlineText && t.showOutlines(ps.String(tx[k])) {
+			continue
+		}
 		if tx[k][0] == '(' || tx[k][0] == '<' {
-			part := space_split(ps.String(tx[k]))
+			part := [][]byte{ps.String(tx[k])}
+			composite := t.encoding(t.Drw.TConfD.Font) != nil
+			if !composite {
+				part = space_split(part[0])
+			}
 			for y := range part {
 				tmp, adv := t.Utf8Advance(part[y])
 				res := strm.Add(t.x, adv)
+				if t.vertical() {
+					res = t.x
+				}
 				p := 0
-				for len(tmp) > p && tmp[p] == 32 {
+				for !composite && len(tmp) > p && tmp[p] == 32 {
 					p++
 				}
 				if p > 0 {
@@ -285,8 +749,8 @@ func (t *SvgTextT) TShow(a []byte) {
 					t.x = strm.Add(t.x, ta)
 					tmp = tmp[p:]
 				}
-				t.Drw.Write.Out(
-					"<g transform=\"matrix(%s,%s,%s,%s,%s,%s)\">\n"+
+				t.show(
+					"<g transform=\"matrix(%s,%s,%s,%s,%s,%s)\"%s>\n"+
 						"<text x=\"%s\" y=\"%s\""+
 						" font-size=\"%s\""+
 						" style=\"stroke:none;%v\""+
@@ -294,16 +758,21 @@ func (t *SvgTextT) TShow(a []byte) {
 						"</g>\n",
 					t.matrix[0], t.matrix[1],
 					strm.Neg(t.matrix[2]), strm.Neg(t.matrix[3]),
-					t.matrix[4], t.matrix[5],
+					t.matrix[4], t.matrix[5], svgdraw.Transparency(t.Drw.ConfigD),
 					t.x, t.y,
 					t.Drw.TConfD.FontSize,
 					t.Style(t.Drw.TConfD.Font),
 					t.Drw.ConfigD.FillColor,
 					util.ToXML(tmp))
 				t.x = res
+				if t.vertical() {
+					t.y = strm.Add(t.y, adv)
+				}
 			}
+		} else if adj := t.adjustment(tx[k]); t.vertical() {
+			t.y = strm.Add(t.y, adj)
 		} else {
-			t.x = strm.Sub(t.x, strm.Mul(string(tx[k]), "0.01"))
+			t.x = strm.Sub(t.x, adj)
 		}
 	}
 }
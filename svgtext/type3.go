@@ -0,0 +1,194 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package svgtext
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/grokify/pdfreader"
+	"github.com/grokify/pdfreader/cmapi"
+	"github.com/grokify/pdfreader/cmapt"
+	"github.com/grokify/pdfreader/colorspace"
+	"github.com/grokify/pdfreader/encoding"
+	"github.com/grokify/pdfreader/extgstate"
+	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/strm"
+	"github.com/grokify/pdfreader/svgdraw"
+	"github.com/grokify/pdfreader/util"
+)
+
+// Type 3 fonts: the glyphs are content streams (/CharProcs) which are
+// interpreted by a nested drawer into a <symbol> each. Their colors are
+// inherited from the <use>, so a symbol serves any text color. The text
+// itself is written transparent on top for search and selection.
+
+// glyphs of Type 3 fonts can show text in other Type 3 fonts.
+const MAX_TYPE3_DEPTH = 4
+
+// t.type3() returns the dictionary of a Type 3 font, nil for other fonts.
+func (t *SvgTextT) type3(font string) pdfreader.Dictionary {
+	if d := t.fontDic(font); d != nil && string(d["/Subtype"]) == "/Type3" {
+		return d
+	}
+	return nil
+}
+
+// t.fontMatrix() returns the /FontMatrix of a Type 3 font.
+func (t *SvgTextT) fontMatrix(d pdfreader.Dictionary) []float64 {
+	r := []float64{0.001, 0, 0, 0.001, 0, 0}
+	if a := t.Pdf.Arr(d["/FontMatrix"]); len(a) == 6 {
+		for k := range a {
+			r[k] = float(string(t.Pdf.Obj(a[k])), r[k])
+		}
+	}
+	return r
+}
+
+// t.type3Widths() reads the /Widths of a Type 3 font, they are in glyph
+// space.
+func (t *SvgTextT) type3Widths(font string, d pdfreader.Dictionary) *cmapt.CMapT {
+	r := cmapt.New()
+	r.AddDef(0, 256, 0)
+	t.fontw[font] = r
+	scale := t.fontMatrix(d)[0] * WIDTH_DENSITY
+	p := strm.Int(string(t.Pdf.Obj(d["/FirstChar"])), 1)
+	a := t.Pdf.Arr(d["/Widths"])
+	for k := range a {
+		r.Add(p+k, int(math.Round(float(string(t.Pdf.Obj(a[k])), 0)*scale)))
+	}
+	return r
+}
+
+// t.fontResources() returns the fonts of the /Resources of a Type 3 font,
+// nil if it has none and the ones of the page apply.
+func (t *SvgTextT) fontResources(d pdfreader.Dictionary) pdfreader.Dictionary {
+	if res, ok := d["/Resources"]; ok {
+		if f, ok := t.Pdf.Dic(res)["/Font"]; ok {
+			return t.Pdf.Dic(f)
+		}
+	}
+	return nil
+}
+
+// t.type3Symbol() returns the id of the <symbol> of a glyph of a Type 3
+// font, it is written out at first use. "" if the font has no such glyph.
+func (t *SvgTextT) type3Symbol(font string, d pdfreader.Dictionary, code int) string {
+	enc := encoding.Font(t.Pdf, d)
+	if enc == nil || enc[code] == "" {
+		return ""
+	}
+	cp, ok := t.Pdf.Dic(d["/CharProcs"])["/"+enc[code]]
+	if !ok {
+		return ""
+	}
+	id := t.prefix + family(font) + "-" + strconv.Itoa(code)
+	if t.symbols[id] {
+		return id
+	}
+	t.symbols[id] = true
+	drw := svgdraw.NewTestSvg()
+	drw.Draw.(*svgdraw.SvgT).IdPrefix = id + "-"
+	drw.Nest(t.Drw)
+	drw.Spaces = t.Drw.Spaces
+	drw.GStates = t.Drw.GStates
+	if res, ok := d["/Resources"]; ok {
+		drw.GStates = extgstate.New(t.Pdf, res)
+		var opts *colorspace.Options
+		if r, ok := t.Drw.Spaces.(*colorspace.ResourcesT); ok {
+			opts = r.Opts
+		}
+		drw.Spaces = colorspace.NewWith(t.Pdf, res, opts)
+	}
+	if s, ok := t.Drw.Draw.(*svgdraw.SvgT); ok {
+		drw.Draw.(*svgdraw.SvgT).CMYKProfile = s.CMYKProfile
+	}
+	drw.ConfigD.FillColor = "inherit"
+	drw.ConfigD.StrokeColor = "inherit"
+	drw.ConfigD.LineWidth = "1"
+	sub := New(t.Pdf, drw)
+	sub.Page = t.Page
+	sub.EmbedFonts, sub.OutlineText = t.EmbedFonts, t.OutlineText
+	sub.fonts = t.fontResources(d)
+	sub.prefix = id + "-"
+	sub.depth = t.depth + 1
+	if sub.depth <= MAX_TYPE3_DEPTH {
+		_, proc := t.Pdf.DecodedStream(cp)
+		drw.Interpret(fancy.SliceReader(proc))
+		drw.Draw.CloseDrawing()
+	}
+	t.Drw.Write.Out("<defs><symbol id=\"%s\" overflow=\"visible\">\n%s</symbol></defs>\n",
+		id, drw.Write.Content)
+	return id
+}
+
+// t.showType3() shows a string in a Type 3 font, false if the current font
+// is none.
+func (t *SvgTextT) showType3(s []byte) bool {
+	font := t.Drw.TConfD.Font
+	d := t.type3(font)
+	if d == nil {
+		return false
+	}
+	tc := t.Drw.TConfD
+	fs := float(tc.FontSize, 0)
+	th := float(tc.Scale, 100) / 100
+	cs, ws := float(tc.CharSpace, 0), float(tc.WordSpace, 0)
+	rise := float(tc.Rise, 0)
+	fm := t.fontMatrix(d)
+	W := t.widths(font)
+	fill, stroke := t.Drw.ConfigD.FillColor, t.Drw.ConfigD.StrokeColor
+	if fill == "" {
+		fill = "black"
+	}
+	if stroke == "" {
+		stroke = "none"
+	}
+	invisible := strm.Int(tc.Render, 1)&3 == 3
+	t.show("<g transform=\"matrix(%s,%s,%s,%s,%s,%s)\"%s>\n",
+		t.matrix[0], t.matrix[1],
+		strm.Neg(t.matrix[2]), strm.Neg(t.matrix[3]),
+		t.matrix[4], t.matrix[5], svgdraw.Transparency(t.Drw.ConfigD))
+	x0, y := float(t.x, 0), float(t.y, 0) // y is downwards
+	x := x0
+	for _, c := range s {
+		if id := t.type3Symbol(font, d, int(c)); id != "" && !invisible {
+			t.show("<use xlink:href=\"#%s\" transform=\"matrix(%s,%s,%s,%s,%s,%s)\""+
+				" fill=\"%s\" stroke=\"%s\"/>\n",
+				id, coef(fm[0]*fs*th), coef(-fm[1]*fs), coef(fm[2]*fs*th), coef(-fm[3]*fs),
+				num(x+fm[4]*fs*th), num(y-fm[5]*fs-rise), fill, stroke)
+		}
+		space := 0.0
+		if c == 32 {
+			space = ws
+		}
+		x += (float64(W.Code(int(c)))/WIDTH_DENSITY*fs + cs + space) * th
+	}
+	if txt := cmapi.Decode(s, t.cmap(font)); len(txt) > 0 && x > x0 {
+		t.show("<text x=\"%s\" y=\"%s\" font-size=\"%s\" textLength=\"%s\""+
+			" lengthAdjust=\"spacingAndGlyphs\" style=\"stroke:none;%s\" fill=\"none\">%s</text>\n",
+			num(x0), num(y-rise), tc.FontSize, num(x-x0), DEFAULT_FSTYLE, util.ToXML(txt))
+	}
+	t.show("</g>\n")
+	t.x = num(x)
+	return true
+}
+
+// type3Mapper() maps the codes of a Type 3 font to Unicode by the glyph
+// names of its encoding. Names like /a65, as used for bitmap fonts, name the
+// code and not the dingbat of the glyph list.
+func type3Mapper(enc *[256]string) *cmapi.CharMapperT {
+	names := *enc
+	for k, n := range names {
+		if len(n) > 1 && n[0] == 'a' && strings.Trim(n[1:], "0123456789") == "" {
+			names[k] = ""
+		}
+	}
+	return encodingMapper(&names)
+}
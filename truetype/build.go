@@ -0,0 +1,482 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package truetype
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Writing of TrueType fonts from outlines, as needed to hand the glyphs of
+// Type 1 fonts to a browser. embed.go writes the other font programs.
+
+const (
+	MAX_QUAD_SPLIT = 6   // subdivisions of a cubic curve at most
+	QUAD_TOLERANCE = 0.5 // in font units
+)
+
+// GlyphT is a glyph for Build(): its advance and its outline as PDF path
+// operators (m, l, c, h) in font units like f.Outline() returns them.
+type GlyphT struct {
+	Advance int
+	Path    []byte
+}
+
+type ptT struct {
+	x, y float64
+	on   bool
+}
+
+// quads() approximates a cubic curve by quadratic ones and appends their
+// control and end points. Curves made of quadratic ones by f.Outline() are
+// turned back exactly.
+func quads(r []ptT, p0, c1, c2, p3 ptT, depth int) []ptT {
+	ex := p3.x - 3*c2.x + 3*c1.x - p0.x
+	ey := p3.y - 3*c2.y + 3*c1.y - p0.y
+	if math.Sqrt(3)/36*math.Hypot(ex, ey) <= QUAD_TOLERANCE || depth >= MAX_QUAD_SPLIT {
+		q := ptT{(3*(c1.x+c2.x) - p0.x - p3.x) / 4, (3*(c1.y+c2.y) - p0.y - p3.y) / 4, false}
+		return append(r, q, p3)
+	}
+	mid := func(a, b ptT) ptT { return ptT{(a.x + b.x) / 2, (a.y + b.y) / 2, true} }
+	ab, bc, cd := mid(p0, c1), mid(c1, c2), mid(c2, p3)
+	abc, bcd := mid(ab, bc), mid(bc, cd)
+	m := mid(abc, bcd)
+	r = quads(r, p0, ab, abc, m, depth+1)
+	return quads(r, m, bcd, cd, p3, depth+1)
+}
+
+// contours() reads PDF path operators into contours of on- and off-curve
+// points.
+func contours(path []byte) [][]ptT {
+	var r [][]ptT
+	var cur []ptT
+	var st []float64
+	end := func() {
+		if len(cur) > 1 && cur[len(cur)-1] == cur[0] {
+			cur = cur[:len(cur)-1]
+		}
+		// on-curve points between two off-curve ones may be implied
+		c := cur[:0]
+		for k, q := range cur {
+			if k > 0 && k+1 < len(cur) && q.on && !cur[k-1].on && !cur[k+1].on &&
+				math.Abs(cur[k-1].x+cur[k+1].x-2*q.x) < 0.01 && math.Abs(cur[k-1].y+cur[k+1].y-2*q.y) < 0.01 {
+				continue
+			}
+			c = append(c, q)
+		}
+		if len(c) > 0 {
+			r = append(r, c)
+		}
+		cur = nil
+	}
+	last := func() ptT {
+		if len(cur) == 0 {
+			return ptT{on: true}
+		}
+		return cur[len(cur)-1]
+	}
+	for _, t := range strings.Fields(string(path)) {
+		switch t {
+		case "m":
+			end()
+			if len(st) >= 2 {
+				cur = []ptT{{st[0], st[1], true}}
+			}
+		case "l":
+			if len(st) >= 2 {
+				cur = append(cur, ptT{st[0], st[1], true})
+			}
+		case "c":
+			if len(st) >= 6 {
+				cur = quads(cur, last(), ptT{st[0], st[1], false},
+					ptT{st[2], st[3], false}, ptT{st[4], st[5], true}, 0)
+			}
+		case "h":
+			end()
+		default:
+			v, _ := strconv.ParseFloat(t, 64)
+			st = append(st, v)
+			continue
+		}
+		st = st[0:0]
+	}
+	end()
+	return r
+}
+
+type writerT struct{ b []byte }
+
+func (w *writerT) u8(v int)  { w.b = append(w.b, byte(v)) }
+func (w *writerT) u16(v int) { w.b = append(w.b, byte(v>>8), byte(v)) }
+func (w *writerT) u32(v int) { w.u16(v >> 16); w.u16(v & 0xffff) }
+
+type bboxT struct{ xMin, yMin, xMax, yMax int }
+
+// glyf() encodes a simple glyph, nil if it has no contours.
+func glyf(cs [][]ptT) ([]byte, bboxT, int) {
+	var bb bboxT
+	n := 0
+	for _, c := range cs {
+		for _, p := range c {
+			x, y := int(math.Round(p.x)), int(math.Round(p.y))
+			if n == 0 || x < bb.xMin {
+				bb.xMin = x
+			}
+			if n == 0 || y < bb.yMin {
+				bb.yMin = y
+			}
+			if n == 0 || x > bb.xMax {
+				bb.xMax = x
+			}
+			if n == 0 || y > bb.yMax {
+				bb.yMax = y
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return nil, bb, 0
+	}
+	w := new(writerT)
+	w.u16(len(cs))
+	w.u16(bb.xMin)
+	w.u16(bb.yMin)
+	w.u16(bb.xMax)
+	w.u16(bb.yMax)
+	e := -1
+	for _, c := range cs {
+		e += len(c)
+		w.u16(e)
+	}
+	w.u16(0) // no instructions
+	for _, c := range cs {
+		for _, p := range c {
+			if p.on {
+				w.u8(1)
+			} else {
+				w.u8(0)
+			}
+		}
+	}
+	for _, xy := range []bool{true, false} {
+		v := 0
+		for _, c := range cs {
+			for _, p := range c {
+				q := int(math.Round(p.y))
+				if xy {
+					q = int(math.Round(p.x))
+				}
+				w.u16(q - v)
+				v = q
+			}
+		}
+	}
+	if len(w.b)&1 == 1 {
+		w.u8(0)
+	}
+	return w.b, bb, n
+}
+
+// cmapTable() writes format 4 (3,1) and format 12 (3,10) subtables.
+func cmapTable(cmap map[int]int) []byte {
+	codes := make([]int, 0, len(cmap))
+	for c := range cmap {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	type segT struct{ start, end, gid int }
+	var segs []segT
+	for _, c := range codes {
+		if n := len(segs); n > 0 && segs[n-1].end+1 == c && segs[n-1].gid+c-segs[n-1].start == cmap[c] {
+			segs[n-1].end = c
+		} else {
+			segs = append(segs, segT{c, c, cmap[c]})
+		}
+	}
+	var bmp []segT
+	for _, s := range segs {
+		if s.end < 0xFFFF {
+			bmp = append(bmp, s)
+		}
+	}
+	bmp = append(bmp, segT{0xFFFF, 0xFFFF, 0})
+	f4 := new(writerT)
+	n := len(bmp)
+	f4.u16(4)
+	f4.u16(16 + 8*n)
+	f4.u16(0)
+	f4.u16(2 * n)
+	sr := 1
+	for sr*2 <= n {
+		sr *= 2
+	}
+	f4.u16(2 * sr)
+	f4.u16(int(math.Log2(float64(sr))))
+	f4.u16(2*n - 2*sr)
+	for _, s := range bmp {
+		f4.u16(s.end)
+	}
+	f4.u16(0)
+	for _, s := range bmp {
+		f4.u16(s.start)
+	}
+	for _, s := range bmp {
+		f4.u16((s.gid - s.start) & 0xFFFF)
+	}
+	for range bmp {
+		f4.u16(0)
+	}
+	f12 := new(writerT)
+	f12.u16(12)
+	f12.u16(0)
+	f12.u32(16 + 12*len(segs))
+	f12.u32(0)
+	f12.u32(len(segs))
+	for _, s := range segs {
+		f12.u32(s.start)
+		f12.u32(s.end)
+		f12.u32(s.gid)
+	}
+	w := new(writerT)
+	w.u16(0)
+	w.u16(2)
+	w.u16(3)
+	w.u16(1)
+	w.u32(20)
+	w.u16(3)
+	w.u16(10)
+	w.u32(20 + len(f4.b))
+	return append(append(w.b, f4.b...), f12.b...)
+}
+
+// nameTable() names the font for the Windows platform only.
+func nameTable(name string) []byte {
+	strs := []string{"", name, "Regular", name, name, "Version 1.0", name}
+	w := new(writerT)
+	w.u16(0)
+	w.u16(len(strs) - 1)
+	w.u16(6 + 12*(len(strs)-1))
+	var data []byte
+	for k := 1; k < len(strs); k++ {
+		s := utf16.Encode([]rune(strs[k]))
+		w.u16(3)
+		w.u16(1)
+		w.u16(0x409)
+		w.u16(k)
+		w.u16(2 * len(s))
+		w.u16(len(data))
+		for _, c := range s {
+			data = append(data, byte(c>>8), byte(c))
+		}
+	}
+	return append(w.b, data...)
+}
+
+func checksum(b []byte) int {
+	s := uint32(0)
+	for k := 0; k < len(b); k += 4 {
+		v := uint32(0)
+		for i := 0; i < 4; i++ {
+			v <<= 8
+			if k+i < len(b) {
+				v |= uint32(b[k+i])
+			}
+		}
+		s += v
+	}
+	return int(s)
+}
+
+// metricsT are the extents of the glyphs of a font for its tables.
+type metricsT struct {
+	all                            bboxT
+	maxPts, maxCnt                 int
+	maxAdv, minLsb, minRsb, maxExt int
+}
+
+// m.add() adds a glyph with its bounding box and n points in cnt contours.
+func (m *metricsT) add(adv int, bb bboxT, n, cnt int) {
+	m.maxAdv = max(m.maxAdv, adv)
+	if n == 0 {
+		return
+	}
+	if m.maxPts == 0 {
+		m.all, m.minLsb, m.minRsb, m.maxExt = bb, bb.xMin, adv-bb.xMax, bb.xMax
+	}
+	m.all = bboxT{min(m.all.xMin, bb.xMin), min(m.all.yMin, bb.yMin), max(m.all.xMax, bb.xMax), max(m.all.yMax, bb.yMax)}
+	m.maxPts, m.maxCnt = max(m.maxPts, n), max(m.maxCnt, cnt)
+	m.minLsb, m.minRsb, m.maxExt = min(m.minLsb, bb.xMin), min(m.minRsb, adv-bb.xMax), max(m.maxExt, bb.xMax)
+}
+
+func headTable(unitsPerEm int, all bboxT, locaFormat int) []byte {
+	head := new(writerT)
+	head.u32(0x00010000)
+	head.u32(0x00010000)
+	head.u32(0) // checkSumAdjustment
+	head.u32(0x5F0F3CF5)
+	head.u16(1)
+	head.u16(unitsPerEm)
+	head.b = append(head.b, make([]byte, 16)...) // created, modified
+	head.u16(all.xMin)
+	head.u16(all.yMin)
+	head.u16(all.xMax)
+	head.u16(all.yMax)
+	head.u16(0)
+	head.u16(8)
+	head.u16(2)
+	head.u16(locaFormat)
+	head.u16(0)
+	return head.b
+}
+
+func hheaTable(m *metricsT, numberOfHMetrics int) []byte {
+	hhea := new(writerT)
+	hhea.u32(0x00010000)
+	hhea.u16(m.all.yMax)
+	hhea.u16(m.all.yMin)
+	hhea.u16(0)
+	hhea.u16(m.maxAdv)
+	hhea.u16(m.minLsb)
+	hhea.u16(m.minRsb)
+	hhea.u16(m.maxExt)
+	hhea.u16(1)
+	hhea.b = append(hhea.b, make([]byte, 12)...)
+	hhea.u16(0)
+	hhea.u16(numberOfHMetrics)
+	return hhea.b
+}
+
+func os2Table(unitsPerEm, maxAdv int, all bboxT, cmap map[int]int) []byte {
+	first, last := 0xFFFF, 0
+	for c := range cmap {
+		first, last = min(first, c), max(last, c)
+	}
+	os2 := new(writerT)
+	os2.u16(3)
+	os2.u16(maxAdv / 2)
+	os2.u16(400)
+	os2.u16(5)
+	os2.u16(0)
+	for _, v := range []int{unitsPerEm / 2, unitsPerEm / 2, 0, unitsPerEm / 10,
+		unitsPerEm / 2, unitsPerEm / 2, 0, unitsPerEm / 3, unitsPerEm / 20, unitsPerEm / 4} {
+		os2.u16(v)
+	}
+	os2.u16(0)                                    // sFamilyClass
+	os2.b = append(os2.b, make([]byte, 10+16)...) // panose, ulUnicodeRange
+	os2.b = append(os2.b, "PDFR"...)
+	os2.u16(0x40)
+	os2.u16(min(first, 0xFFFF))
+	os2.u16(min(last, 0xFFFF))
+	os2.u16(all.yMax)
+	os2.u16(all.yMin)
+	os2.u16(0)
+	os2.u16(all.yMax)
+	os2.u16(max(0, -all.yMin))
+	os2.u32(1) // ulCodePageRange1: Latin 1
+	os2.u32(0)
+	os2.u16(unitsPerEm / 2)
+	os2.u16(unitsPerEm * 7 / 10)
+	os2.u16(0)
+	os2.u16(32)
+	os2.u16(1)
+	return os2.b
+}
+
+// postTable() writes a post table without glyph names.
+func postTable(unitsPerEm int) []byte {
+	post := new(writerT)
+	post.u32(0x00030000)
+	post.u32(0)
+	post.u16(-unitsPerEm / 10)
+	post.u16(unitsPerEm / 20)
+	post.b = append(post.b, make([]byte, 20)...)
+	return post.b
+}
+
+type sfntTableT struct {
+	tag  string
+	data []byte
+}
+
+// sfnt() writes a font of the tables, sorted by tag, and sets the
+// checksum adjustment of its head table.
+func sfnt(version int, tables []sfntTableT) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+	w := new(writerT)
+	n := len(tables)
+	sel := 0
+	for 2<<sel <= n {
+		sel++
+	}
+	w.u32(version)
+	w.u16(n)
+	w.u16(16 << sel) // searchRange
+	w.u16(sel)
+	w.u16(16*n - 16<<sel)
+	off := 12 + 16*n
+	headAt := -1
+	for _, t := range tables {
+		if t.tag == "head" {
+			headAt = off
+		}
+		w.b = append(w.b, t.tag...)
+		w.u32(checksum(t.data))
+		w.u32(off)
+		w.u32(len(t.data))
+		off += (len(t.data) + 3) &^ 3
+	}
+	for _, t := range tables {
+		w.b = append(w.b, t.data...)
+		for len(w.b)&3 != 0 {
+			w.u8(0)
+		}
+	}
+	if headAt >= 0 && headAt+12 <= len(w.b) {
+		adj := uint32(0xB1B0AFBA) - uint32(checksum(w.b))
+		w.b[headAt+8], w.b[headAt+9], w.b[headAt+10], w.b[headAt+11] =
+			byte(adj>>24), byte(adj>>16), byte(adj>>8), byte(adj)
+	}
+	return w.b
+}
+
+// Build() writes a TrueType font with the glyphs g - the first should be
+// the .notdef glyph - and cmap mapping Unicode to glyph indexes. Cubic
+// curves are approximated by quadratic ones, hints are not kept.
+func Build(name string, unitsPerEm int, g []GlyphT, cmap map[int]int) []byte {
+	var m metricsT
+	glf, loca, hmtx := new(writerT), new(writerT), new(writerT)
+	for k := range g {
+		cs := contours(g[k].Path)
+		b, bb, n := glyf(cs)
+		loca.u32(len(glf.b))
+		glf.b = append(glf.b, b...)
+		hmtx.u16(g[k].Advance)
+		hmtx.u16(bb.xMin)
+		m.add(g[k].Advance, bb, n, len(cs))
+	}
+	loca.u32(len(glf.b))
+
+	maxp := new(writerT)
+	maxp.u32(0x00010000)
+	maxp.u16(len(g))
+	maxp.u16(m.maxPts)
+	maxp.u16(m.maxCnt)
+	maxp.b = append(maxp.b, make([]byte, 4)...)
+	maxp.u16(2)
+	maxp.b = append(maxp.b, make([]byte, 16)...)
+
+	return sfnt(0x00010000, []sfntTableT{
+		{"OS/2", os2Table(unitsPerEm, m.maxAdv, m.all, cmap)}, {"cmap", cmapTable(cmap)},
+		{"glyf", glf.b}, {"head", headTable(unitsPerEm, m.all, 1)}, {"hhea", hheaTable(&m, len(g))},
+		{"hmtx", hmtx.b}, {"loca", loca.b}, {"maxp", maxp.b}, {"name", nameTable(name)},
+		{"post", postTable(unitsPerEm)},
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package truetype
+
+// Embedding of TrueType, OpenType and CFF font programs as they are. The
+// glyphs keep their outlines and hints, the tables addressing them are
+// replaced: cmap maps Unicode to glyph indexes, the advances are the ones
+// of the PDF and name names the font. Layout tables are dropped, PDF
+// positions glyphs by advances only.
+
+// the tables kept from the font program.
+var keep = map[string]bool{
+	"glyf": true, "loca": true, "CFF ": true, "maxp": true, "cvt ": true,
+	"fpgm": true, "prep": true, "gasp": true, "post": true, "OS/2": true,
+	"vhea": true, "vmtx": true,
+}
+
+// Rewrite() writes a TrueType or OpenType font with its glyphs as they are
+// for cmap, mapping Unicode to glyph indexes, and the advances by glyph
+// index, the others keep theirs. nil if data is no such font.
+func Rewrite(name string, data []byte, cmap map[int]int, advances map[int]int) (r []byte) {
+	defer func() {
+		if recover() != nil {
+			r = nil
+		}
+	}()
+	f := &FontT{data: data, tables: make(map[string]tableT)}
+	version := f.u32(0)
+	if version != 0x00010000 && version != 0x74727565 && version != 0x4F54544F { // "true", "OTTO"
+		return nil
+	}
+	tables := make(map[string][]byte)
+	for k := 0; k < f.u16(4); k++ {
+		p := 12 + k*16
+		off, n := f.u32(p+8), f.u32(p+12)
+		tables[string(data[p:p+4])] = data[off : off+n]
+	}
+	head, hhea, hmtx, maxp := tables["head"], tables["hhea"], tables["hmtx"], tables["maxp"]
+	if head == nil || hhea == nil || hmtx == nil || maxp == nil ||
+		tables["CFF "] == nil && (tables["glyf"] == nil || tables["loca"] == nil) {
+		return nil
+	}
+	u16 := func(b []byte, p int) int { return int(b[p])<<8 | int(b[p+1]) }
+	s16 := func(b []byte, p int) int { return int(int16(u16(b, p))) }
+	unitsPerEm, numGlyphs, nMetrics := u16(head, 18), u16(maxp, 4), u16(hhea, 34)
+	if nMetrics == 0 || 4*nMetrics > len(hmtx) {
+		return nil
+	}
+	m := metricsT{all: bboxT{s16(head, 36), s16(head, 38), s16(head, 40), s16(head, 42)}}
+	w := new(writerT)
+	for g := 0; g < numGlyphs; g++ {
+		adv, lsb := u16(hmtx, 4*min(g, nMetrics-1)), 0
+		if g < nMetrics {
+			lsb = s16(hmtx, 4*g+2)
+		} else if p := 4*nMetrics + 2*(g-nMetrics); p+2 <= len(hmtx) {
+			lsb = s16(hmtx, p)
+		}
+		if a, ok := advances[g]; ok {
+			adv = a
+		}
+		w.u16(adv)
+		w.u16(lsb)
+		m.maxAdv = max(m.maxAdv, adv)
+	}
+	hh := append([]byte(nil), hhea...)
+	hh[10], hh[11] = byte(m.maxAdv>>8), byte(m.maxAdv)
+	hh[34], hh[35] = byte(numGlyphs>>8), byte(numGlyphs)
+	hd := append([]byte(nil), head...)
+	hd[8], hd[9], hd[10], hd[11] = 0, 0, 0, 0
+	out := []sfntTableT{{"cmap", cmapTable(cmap)}, {"head", hd}, {"hhea", hh},
+		{"hmtx", w.b}, {"name", nameTable(name)}}
+	for tag, t := range tables {
+		if keep[tag] {
+			out = append(out, sfntTableT{tag, t})
+		}
+	}
+	if tables["OS/2"] == nil {
+		out = append(out, sfntTableT{"OS/2", os2Table(unitsPerEm, m.maxAdv, m.all, cmap)})
+	}
+	if tables["post"] == nil {
+		out = append(out, sfntTableT{"post", postTable(unitsPerEm)})
+	}
+	return sfnt(version, out)
+}
+
+// WrapCFF() writes an OpenType font of a CFF font program with the glyphs
+// g by glyph index, their paths give the bounding boxes, and cmap mapping
+// Unicode to glyph indexes.
+func WrapCFF(name string, data []byte, unitsPerEm int, g []GlyphT, cmap map[int]int) []byte {
+	var m metricsT
+	hmtx := new(writerT)
+	for k := range g {
+		cs := contours(g[k].Path)
+		_, bb, n := glyf(cs)
+		hmtx.u16(g[k].Advance)
+		hmtx.u16(bb.xMin)
+		m.add(g[k].Advance, bb, n, len(cs))
+	}
+	maxp := new(writerT)
+	maxp.u32(0x00005000)
+	maxp.u16(len(g))
+	return sfnt(0x4F54544F, []sfntTableT{
+		{"CFF ", data}, {"OS/2", os2Table(unitsPerEm, m.maxAdv, m.all, cmap)},
+		{"cmap", cmapTable(cmap)}, {"head", headTable(unitsPerEm, m.all, 0)},
+		{"hhea", hheaTable(&m, len(g))}, {"hmtx", hmtx.b}, {"maxp", maxp.b},
+		{"name", nameTable(name)}, {"post", postTable(unitsPerEm)},
+	})
+}
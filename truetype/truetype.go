@@ -0,0 +1,517 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+// TrueType fonts (FontFile2) - metrics, cmaps, glyph names and outlines.
+package truetype
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader/encoding"
+)
+
+const MAX_COMPOSITE_DEPTH = 8
+
+type tableT struct{ off, len int }
+
+// CmapT is a (sub)table of the cmap table.
+type CmapT struct {
+	Platform, Encoding int
+	Map                map[int]int // character code -> glyph index
+}
+
+type FontT struct {
+	data       []byte
+	tables     map[string]tableT
+	UnitsPerEm int
+	NumGlyphs  int
+	Advances   []int    // advance widths by glyph index
+	Cmaps      []*CmapT // supported subtables
+	Names      []string // glyph names of the post table, nil if none
+	loca       []int
+	unicode    map[int]int // glyph index -> Unicode, see f.Unicode()
+}
+
+// reading of big-endian values - a short font crashes by index out of range.
+
+func (f *FontT) u8(p int) int  { return int(f.data[p]) }
+func (f *FontT) u16(p int) int { return int(f.data[p])<<8 | int(f.data[p+1]) }
+func (f *FontT) s16(p int) int { return int(int16(f.u16(p))) }
+func (f *FontT) u32(p int) int { return f.u16(p)<<16 | f.u16(p+2) }
+
+func (f *FontT) table(tag string) (int, bool) {
+	t, ok := f.tables[tag]
+	return t.off, ok && t.off+t.len <= len(f.data)
+}
+
+// Read() parses a TrueType font, nil if it is none or too broken.
+func Read(data []byte) (f *FontT) {
+	defer func() {
+		if recover() != nil {
+			f = nil
+		}
+	}()
+	f = &FontT{data: data, tables: make(map[string]tableT)}
+	if v := f.u32(0); v != 0x00010000 && v != 0x74727565 { // "true"
+		return nil
+	}
+	for k := 0; k < f.u16(4); k++ {
+		p := 12 + k*16
+		f.tables[string(data[p:p+4])] = tableT{f.u32(p + 8), f.u32(p + 12)}
+	}
+	head, ok := f.table("head")
+	if !ok {
+		return nil
+	}
+	f.UnitsPerEm = f.u16(head + 18)
+	if p, ok := f.table("maxp"); ok {
+		f.NumGlyphs = f.u16(p + 4)
+	}
+	f.readHmtx()
+	f.readLoca(f.s16(head + 50))
+	f.readCmap()
+	f.readPost()
+	return f
+}
+
+func (f *FontT) readHmtx() {
+	hhea, ok := f.table("hhea")
+	hmtx, ok2 := f.table("hmtx")
+	if !ok || !ok2 {
+		return
+	}
+	n := f.u16(hhea + 34)
+	f.Advances = make([]int, f.NumGlyphs)
+	w := 0
+	for k := range f.Advances {
+		if k < n {
+			w = f.u16(hmtx + 4*k)
+		}
+		f.Advances[k] = w
+	}
+}
+
+func (f *FontT) readLoca(format int) {
+	loca, ok := f.table("loca")
+	if _, ok2 := f.table("glyf"); !ok || !ok2 {
+		return
+	}
+	f.loca = make([]int, f.NumGlyphs+1)
+	for k := range f.loca {
+		if format == 0 {
+			f.loca[k] = 2 * f.u16(loca+2*k)
+		} else {
+			f.loca[k] = f.u32(loca + 4*k)
+		}
+	}
+}
+
+// f.subtable() reads cmap subtables of formats 0, 4, 6 and 12.
+func (f *FontT) subtable(p int) map[int]int {
+	m := make(map[int]int)
+	switch f.u16(p) {
+	case 0:
+		for c := 0; c < 256; c++ {
+			m[c] = f.u8(p + 6 + c)
+		}
+	case 4:
+		n := f.u16(p+6) / 2
+		ends, starts, deltas, offs := p+14, p+16+2*n, p+16+4*n, p+16+6*n
+		for k := 0; k < n; k++ {
+			end, start := f.u16(ends+2*k), f.u16(starts+2*k)
+			delta, ro := f.u16(deltas+2*k), f.u16(offs+2*k)
+			for c := start; c <= end && c != 0xFFFF; c++ {
+				g := 0
+				if ro == 0 {
+					g = (c + delta) & 0xFFFF
+				} else if g = f.u16(offs + 2*k + ro + 2*(c-start)); g != 0 {
+					g = (g + delta) & 0xFFFF
+				}
+				if g != 0 {
+					m[c] = g
+				}
+			}
+		}
+	case 6:
+		first, n := f.u16(p+6), f.u16(p+8)
+		for k := 0; k < n; k++ {
+			if g := f.u16(p + 10 + 2*k); g != 0 {
+				m[first+k] = g
+			}
+		}
+	case 12:
+		n := f.u32(p + 12)
+		for k := 0; k < n; k++ {
+			q := p + 16 + 12*k
+			start, end, g := f.u32(q), f.u32(q+4), f.u32(q+8)
+			for c := start; c <= end && c-start < 0x10000; c++ {
+				m[c] = g + c - start
+			}
+		}
+	default:
+		return nil
+	}
+	return m
+}
+
+func (f *FontT) readCmap() {
+	cmap, ok := f.table("cmap")
+	if !ok {
+		return
+	}
+	for k := 0; k < f.u16(cmap+2); k++ {
+		p := cmap + 4 + 8*k
+		if m := f.subtable(cmap + f.u32(p+4)); m != nil {
+			f.Cmaps = append(f.Cmaps, &CmapT{f.u16(p), f.u16(p + 2), m})
+		}
+	}
+}
+
+func (f *FontT) readPost() {
+	post, ok := f.table("post")
+	if !ok {
+		return
+	}
+	switch f.u32(post) {
+	case 0x00010000:
+		f.Names = macGlyphNames[:]
+	case 0x00020000:
+		n := f.u16(post + 32)
+		var strs []string
+		for p := post + 34 + 2*n; p < post+f.tables["post"].len; {
+			l := f.u8(p)
+			strs = append(strs, string(f.data[p+1:p+1+l]))
+			p += 1 + l
+		}
+		f.Names = make([]string, n)
+		for k := range f.Names {
+			i := f.u16(post + 34 + 2*k)
+			if i < 258 {
+				f.Names[k] = macGlyphNames[i]
+			} else if i-258 < len(strs) {
+				f.Names[k] = strs[i-258]
+			}
+		}
+	}
+}
+
+// f.Cmap() returns the mapping of a cmap subtable, nil if there is none.
+func (f *FontT) Cmap(platform, enc int) map[int]int {
+	for _, c := range f.Cmaps {
+		if c.Platform == platform && c.Encoding == enc {
+			return c.Map
+		}
+	}
+	return nil
+}
+
+// f.Advance() returns the advance width of a glyph in font units.
+func (f *FontT) Advance(gid int) int {
+	if gid < 0 || gid >= len(f.Advances) {
+		return 0
+	}
+	return f.Advances[gid]
+}
+
+// f.GlyphByName() finds a glyph by the post table, -1 if it is not there.
+func (f *FontT) GlyphByName(name string) int {
+	for k, n := range f.Names {
+		if n == name {
+			return k
+		}
+	}
+	return -1
+}
+
+// f.Unicode() maps a glyph back to Unicode by the Unicode cmaps or its
+// glyph name, -1 if this fails.
+func (f *FontT) Unicode(gid int) int {
+	if f.unicode == nil {
+		f.unicode = make(map[int]int)
+		for _, c := range f.Cmaps {
+			if c.Platform == 0 || c.Platform == 3 && (c.Encoding == 1 || c.Encoding == 10) {
+				for u, g := range c.Map {
+					if o, ok := f.unicode[g]; !ok || u < o {
+						f.unicode[g] = u
+					}
+				}
+			}
+		}
+	}
+	if u, ok := f.unicode[gid]; ok {
+		return u
+	}
+	if gid >= 0 && gid < len(f.Names) && f.Names[gid] != "" {
+		return encoding.Unicode(f.Names[gid])
+	}
+	return -1
+}
+
+// the codes of MacRomanEncoding by glyph name.
+var macRoman = make(map[string]int)
+
+func init() {
+	for c, n := range encoding.MacRoman {
+		if n != "" {
+			macRoman[n] = c
+		}
+	}
+}
+
+// f.CodeToGlyph() finds the glyph for a code of a simple TrueType font as
+// described in the PDF Reference. name is the glyph name of the code by
+// the encoding of the font, "" if it has none.
+func (f *FontT) CodeToGlyph(code int, name string, symbolic bool) int {
+	if name != "" && !symbolic {
+		if m := f.Cmap(3, 1); m != nil {
+			if g, ok := m[encoding.Unicode(name)]; ok {
+				return g
+			}
+		}
+		if m := f.Cmap(1, 0); m != nil {
+			if c, ok := macRoman[name]; ok {
+				if g, ok := m[c]; ok {
+					return g
+				}
+			}
+		}
+		if g := f.GlyphByName(name); g >= 0 {
+			return g
+		}
+	}
+	if m := f.Cmap(3, 0); m != nil {
+		for _, hi := range []int{0, 0xF000, 0xF100, 0xF200} {
+			if g, ok := m[hi|code]; ok {
+				return g
+			}
+		}
+	}
+	for _, c := range f.Cmaps {
+		if g, ok := c.Map[code]; ok {
+			return g
+		}
+	}
+	if name != "" {
+		if g := f.GlyphByName(name); g >= 0 {
+			return g
+		}
+	}
+	return 0
+}
+
+type pointT struct {
+	x, y float64
+	on   bool
+}
+
+// f.contours() reads the contours of a glyph, composite glyphs are
+// resolved.
+func (f *FontT) contours(gid, depth int) [][]pointT {
+	if gid < 0 || gid+1 >= len(f.loca) || f.loca[gid] >= f.loca[gid+1] || depth > MAX_COMPOSITE_DEPTH {
+		return nil
+	}
+	glyf, _ := f.table("glyf")
+	p := glyf + f.loca[gid]
+	n := f.s16(p)
+	if n < 0 {
+		return f.composite(p+10, depth)
+	}
+	ends := make([]int, n)
+	for k := range ends {
+		ends[k] = f.u16(p + 10 + 2*k)
+	}
+	if n == 0 {
+		return nil
+	}
+	np := ends[n-1] + 1
+	p += 10 + 2*n
+	p += 2 + f.u16(p)
+	flags := make([]int, 0, np)
+	for len(flags) < np {
+		fl := f.u8(p)
+		p++
+		flags = append(flags, fl)
+		if fl&8 != 0 {
+			for r := f.u8(p); r > 0 && len(flags) < np; r-- {
+				flags = append(flags, fl)
+			}
+			p++
+		}
+	}
+	pts := make([]pointT, np)
+	for _, xy := range []int{0, 1} {
+		short, same := 2<<xy, 16<<xy
+		v := 0
+		for k, fl := range flags {
+			switch {
+			case fl&short != 0 && fl&same != 0:
+				v += f.u8(p)
+				p++
+			case fl&short != 0:
+				v -= f.u8(p)
+				p++
+			case fl&same == 0:
+				v += f.s16(p)
+				p += 2
+			}
+			if xy == 0 {
+				pts[k].x = float64(v)
+			} else {
+				pts[k].y = float64(v)
+			}
+			pts[k].on = fl&1 != 0
+		}
+	}
+	r := make([][]pointT, n)
+	s := 0
+	for k, e := range ends {
+		if e+1 > s && e < np {
+			r[k] = pts[s : e+1]
+		}
+		s = e + 1
+	}
+	return r
+}
+
+// f.composite() reads the components of a composite glyph at p.
+func (f *FontT) composite(p, depth int) [][]pointT {
+	var r [][]pointT
+	for {
+		fl, gid := f.u16(p), f.u16(p+2)
+		p += 4
+		var dx, dy float64
+		if fl&1 != 0 {
+			dx, dy = float64(f.s16(p)), float64(f.s16(p+2))
+			p += 4
+		} else {
+			dx, dy = float64(int8(f.u8(p))), float64(int8(f.u8(p+1)))
+			p += 2
+		}
+		a, b, c, d := 1.0, 0.0, 0.0, 1.0
+		f2dot14 := func() float64 { v := float64(f.s16(p)) / 16384; p += 2; return v }
+		switch {
+		case fl&8 != 0:
+			a = f2dot14()
+			d = a
+		case fl&0x40 != 0:
+			a, d = f2dot14(), f2dot14()
+		case fl&0x80 != 0:
+			a, b, c, d = f2dot14(), f2dot14(), f2dot14(), f2dot14()
+		}
+		if fl&2 == 0 { // point matching is not supported
+			dx, dy = 0, 0
+		}
+		for _, cnt := range f.contours(gid, depth+1) {
+			t := make([]pointT, len(cnt))
+			for k, q := range cnt {
+				t[k] = pointT{a*q.x + c*q.y + dx, b*q.x + d*q.y + dy, q.on}
+			}
+			r = append(r, t)
+		}
+		if fl&0x20 == 0 {
+			return r
+		}
+	}
+}
+
+func number(f float64) string {
+	return strconv.FormatFloat(math.Round(f*1000)/1000, 'f', -1, 64)
+}
+
+// f.Outline() returns the outline of a glyph as PDF path operators in font
+// units, quadratic curves converted to cubic ones. nil if the glyph is
+// empty.
+func (f *FontT) Outline(gid int) (r []byte) {
+	defer func() {
+		if recover() != nil {
+			r = nil
+		}
+	}()
+	for _, cnt := range f.contours(gid, 0) {
+		if len(cnt) == 0 {
+			continue
+		}
+		// start at an on-curve point, implied or not.
+		start, rest := cnt[0], cnt[1:]
+		if l := cnt[len(cnt)-1]; !start.on && l.on {
+			start, rest = l, cnt[:len(cnt)-1]
+		} else if !start.on {
+			start, rest = pointT{(start.x + l.x) / 2, (start.y + l.y) / 2, true}, cnt
+		}
+		r = append(r, number(start.x)+" "+number(start.y)+" m\n"...)
+		cur, ctl, off := start, pointT{}, false
+		quad := func(q pointT) {
+			r = append(r, number(cur.x+2*(ctl.x-cur.x)/3)+" "+number(cur.y+2*(ctl.y-cur.y)/3)+" "+
+				number(q.x+2*(ctl.x-q.x)/3)+" "+number(q.y+2*(ctl.y-q.y)/3)+" "+
+				number(q.x)+" "+number(q.y)+" c\n"...)
+		}
+		for _, q := range append(append([]pointT{}, rest...), start) {
+			switch {
+			case q.on && off:
+				quad(q)
+			case q.on:
+				if q.x != cur.x || q.y != cur.y {
+					r = append(r, number(q.x)+" "+number(q.y)+" l\n"...)
+				}
+			case off:
+				m := pointT{(ctl.x + q.x) / 2, (ctl.y + q.y) / 2, true}
+				quad(m)
+				cur, ctl = m, q
+				continue
+			default:
+				ctl, off = q, true
+				continue
+			}
+			cur, off = q, false
+		}
+		r = append(r, "h\n"...)
+	}
+	return r
+}
+
+// the 258 standard glyph names of the Macintosh, see the post table.
+var macGlyphNames = [258]string{
+	".notdef", ".null", "nonmarkingreturn", "space", "exclam", "quotedbl",
+	"numbersign", "dollar", "percent", "ampersand", "quotesingle",
+	"parenleft", "parenright", "asterisk", "plus", "comma", "hyphen",
+	"period", "slash", "zero", "one", "two", "three", "four", "five", "six",
+	"seven", "eight", "nine", "colon", "semicolon", "less", "equal",
+	"greater", "question", "at", "A", "B", "C", "D", "E", "F", "G", "H", "I",
+	"J", "K", "L", "M", "N", "O", "P", "Q", "R", "S", "T", "U", "V", "W", "X",
+	"Y", "Z", "bracketleft", "backslash", "bracketright", "asciicircum",
+	"underscore", "grave", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j",
+	"k", "l", "m", "n", "o", "p", "q", "r", "s", "t", "u", "v", "w", "x", "y",
+	"z", "braceleft", "bar", "braceright", "asciitilde", "Adieresis", "Aring",
+	"Ccedilla", "Eacute", "Ntilde", "Odieresis", "Udieresis", "aacute",
+	"agrave", "acircumflex", "adieresis", "atilde", "aring", "ccedilla",
+	"eacute", "egrave", "ecircumflex", "edieresis", "iacute", "igrave",
+	"icircumflex", "idieresis", "ntilde", "oacute", "ograve", "ocircumflex",
+	"odieresis", "otilde", "uacute", "ugrave", "ucircumflex", "udieresis",
+	"dagger", "degree", "cent", "sterling", "section", "bullet", "paragraph",
+	"germandbls", "registered", "copyright", "trademark", "acute", "dieresis",
+	"notequal", "AE", "Oslash", "infinity", "plusminus", "lessequal",
+	"greaterequal", "yen", "mu", "partialdiff", "summation", "product", "pi",
+	"integral", "ordfeminine", "ordmasculine", "Omega", "ae", "oslash",
+	"questiondown", "exclamdown", "logicalnot", "radical", "florin",
+	"approxequal", "Delta", "guillemotleft", "guillemotright", "ellipsis",
+	"nonbreakingspace", "Agrave", "Atilde", "Otilde", "OE", "oe", "endash",
+	"emdash", "quotedblleft", "quotedblright", "quoteleft", "quoteright",
+	"divide", "lozenge", "ydieresis", "Ydieresis", "fraction", "currency",
+	"guilsinglleft", "guilsinglright", "fi", "fl", "daggerdbl",
+	"periodcentered", "quotesinglbase", "quotedblbase", "perthousand",
+	"Acircumflex", "Ecircumflex", "Aacute", "Edieresis", "Egrave", "Iacute",
+	"Icircumflex", "Idieresis", "Igrave", "Oacute", "Ocircumflex", "apple",
+	"Ograve", "Uacute", "Ucircumflex", "Ugrave", "dotlessi", "circumflex",
+	"tilde", "macron", "breve", "dotaccent", "ring", "cedilla",
+	"hungarumlaut", "ogonek", "caron", "Lslash", "lslash", "Scaron", "scaron",
+	"Zcaron", "zcaron", "brokenbar", "Eth", "eth", "Yacute", "yacute",
+	"Thorn", "thorn", "minus", "multiply", "onesuperior", "twosuperior",
+	"threesuperior", "onehalf", "onequarter", "threequarters", "franc",
+	"Gbreve", "gbreve", "Idotaccent", "Scedilla", "scedilla", "Cacute",
+	"cacute", "Ccaron", "ccaron", "dcroat",
+}
@@ -32,13 +32,13 @@ func dumpT1(i *type1.TypeOneI) {
 		for l := range d {
 			fmt.Printf("  %s %s\n", l, d[l])
 		}
-		/*
-		   fmt.Printf("\n\nCharStrings:");
-		   d = i.Dic(string(df["/CharStrings"]));
-		   for l := range d {
-		     fmt.Printf("  %s %v\n", l, d[l])
-		   }
-		*/
+	}
+	if g := type1.NewGlyphs(i); g != nil {
+		fmt.Printf("\nCharStrings:\n")
+		for n := range g.CharStrings {
+			r := g.Glyph(n)
+			fmt.Printf("  %s %v\n%s", n, r.Wx, r.Path)
+		}
 	}
 }
 
@@ -0,0 +1,430 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package type1
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/grokify/pdfreader/strm"
+)
+
+// Type 1 charstring "interpreter" - hints are ignored.
+
+const (
+	MAX_CHARSTRING_STACK = 24
+	MAX_SUBR_DEPTH       = 10
+)
+
+// GlyphT is the outline of a glyph, of Type 1 and of CFF fonts. Path holds
+// PDF path operators (m, l, c, h) in glyph space, so it can be run through
+// graf like page content.
+type GlyphT struct {
+	Wx, Wy float64 // advance
+	Path   []byte
+}
+
+// GlyphsT gives access to the glyphs of a font read by Read().
+type GlyphsT struct {
+	CharStrings map[string][]byte // decrypted charstrings by glyph name
+	Subrs       [][]byte          // decrypted subroutines
+	FontMatrix  []float64
+}
+
+// Fractional values of div have to be representable.
+func number(f float64) []byte {
+	return strconv.AppendFloat(nil, math.Round(f*1000)/1000, 'f', -1, 64)
+}
+
+func decrypt(s []byte, lenIV int) []byte {
+	if lenIV < 0 {
+		return s
+	}
+	if lenIV > len(s) {
+		return nil
+	}
+	return T1Decrypt(CHARSTRING_KEY, s)[lenIV:]
+}
+
+// NewGlyphs() decrypts the /CharStrings and /Subrs of the first font
+// defined in i. It returns nil if there is none.
+func NewGlyphs(i *TypeOneI) *GlyphsT {
+	var font map[string][]byte
+	for _, id := range i.Fonts {
+		if len(id) > 0 && id[0] == 'D' {
+			font = i.Dic(id)
+		}
+	}
+	if font == nil {
+		for k := 0; k < i.DicNo; k++ {
+			if _, ok := i.Dicts[k].Defs["/CharStrings"]; ok {
+				font = i.Dicts[k].Defs
+			}
+		}
+	}
+	cs, ok := font["/CharStrings"]
+	if !ok || len(cs) < 2 || cs[0] != 'D' {
+		return nil
+	}
+	r := new(GlyphsT)
+	r.FontMatrix = []float64{0.001, 0, 0, 0.001, 0, 0}
+	if fm := font["/FontMatrix"]; len(fm) > 2 {
+		r.FontMatrix = r.FontMatrix[0:0]
+		for _, v := range splitNumbers(fm[1 : len(fm)-1]) {
+			r.FontMatrix = append(r.FontMatrix, v)
+		}
+	}
+	lenIV := 4
+	var subrs [][]byte
+	if p := font["/Private"]; len(p) > 1 && p[0] == 'D' {
+		priv := i.Dic(string(p))
+		if l, ok := priv["/lenIV"]; ok {
+			lenIV = strm.Int(string(l), 1)
+		}
+		if s := priv["/Subrs"]; len(s) > 1 && s[0] == 'A' {
+			subrs = i.Array(string(s))
+		}
+	}
+	r.CharStrings = make(map[string][]byte)
+	for n, s := range i.Dic(string(cs)) {
+		r.CharStrings[n[1:]] = decrypt(s, lenIV)
+	}
+	r.Subrs = make([][]byte, len(subrs))
+	for k := range subrs {
+		r.Subrs[k] = decrypt(subrs[k], lenIV)
+	}
+	return r
+}
+
+func splitNumbers(s []byte) []float64 {
+	var r []float64
+	for p := 0; p < len(s); {
+		for ; p < len(s) && s[p] <= 32; p++ {
+		}
+		q := p
+		for ; q < len(s) && s[q] > 32; q++ {
+		}
+		if q > p {
+			v, _ := strconv.ParseFloat(string(s[p:q]), 64)
+			r = append(r, v)
+		}
+		p = q
+	}
+	return r
+}
+
+// glyph names of StandardEncoding needed for seac: letters and accents.
+var seacAccents = []string{"grave", "acute", "circumflex", "tilde", "macron",
+	"breve", "dotaccent", "dieresis", "", "ring", "cedilla", "",
+	"hungarumlaut", "ogonek", "caron"}
+
+func seacName(c int) string {
+	switch {
+	case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		return string(rune(c))
+	case c >= 193 && c <= 207:
+		return seacAccents[c-193]
+	case c == 245:
+		return "dotlessi"
+	}
+	return ""
+}
+
+type charStringT struct {
+	g          *GlyphsT
+	r          *GlyphT
+	st         []float64
+	ps         []float64 // results of callothersubr for pop
+	x, y       float64
+	dx, dy     float64 // offset of seac accents
+	sbx, sby   float64
+	open       bool // path is started
+	flex       bool
+	flexPts    []float64 // reference point and the six points of a flex
+	fx, fy     float64   // current point at the start of a flex
+	done, seac bool
+}
+
+func (c *charStringT) out(v ...float64) {
+	for k := range v {
+		if k&1 == 0 {
+			v[k] += c.dx
+		} else {
+			v[k] += c.dy
+		}
+		c.r.Path = append(c.r.Path, number(v[k])...)
+		c.r.Path = append(c.r.Path, ' ')
+	}
+}
+
+func (c *charStringT) op(o string) {
+	c.r.Path = append(c.r.Path, o...)
+	c.r.Path = append(c.r.Path, '\n')
+}
+
+func (c *charStringT) moveTo(dx, dy float64) {
+	c.x += dx
+	c.y += dy
+	if c.flex {
+		c.flexPts = append(c.flexPts, c.x, c.y)
+		return
+	}
+	c.open = false
+}
+
+func (c *charStringT) start() {
+	if !c.open {
+		c.out(c.x, c.y)
+		c.op("m")
+		c.open = true
+	}
+}
+
+func (c *charStringT) lineTo(dx, dy float64) {
+	c.start()
+	c.x += dx
+	c.y += dy
+	c.out(c.x, c.y)
+	c.op("l")
+}
+
+func (c *charStringT) curveTo(dx1, dy1, dx2, dy2, dx3, dy3 float64) {
+	c.start()
+	x1, y1 := c.x+dx1, c.y+dy1
+	x2, y2 := x1+dx2, y1+dy2
+	c.x, c.y = x2+dx3, y2+dy3
+	c.out(x1, y1, x2, y2, c.x, c.y)
+	c.op("c")
+}
+
+func (c *charStringT) closePath() {
+	if c.open {
+		c.op("h")
+		c.open = false
+	}
+}
+
+// c.endFlex() draws the two curves of a flex from the collected points.
+func (c *charStringT) endFlex() {
+	c.flex = false
+	p := c.flexPts
+	c.flexPts = nil
+	if len(p) < 14 {
+		return
+	}
+	c.x, c.y = c.fx, c.fy
+	c.start()
+	c.out(p[2], p[3], p[4], p[5], p[6], p[7])
+	c.op("c")
+	c.out(p[8], p[9], p[10], p[11], p[12], p[13])
+	c.op("c")
+	c.x, c.y = p[12], p[13]
+}
+
+func (c *charStringT) args(n int) []float64 {
+	if len(c.st) < n {
+		panic("charstring stack underflow\n")
+	}
+	return c.st[len(c.st)-n:]
+}
+
+func (c *charStringT) othersubr() {
+	a := c.args(2)
+	o, n := int(a[1]), int(a[0])
+	c.st = c.st[0 : len(c.st)-2]
+	if n < 0 {
+		n = 0
+	}
+	a = c.args(n)
+	c.st = c.st[0 : len(c.st)-n]
+	c.ps = c.ps[0:0]
+	for k := n - 1; k >= 0; k-- {
+		c.ps = append(c.ps, a[k])
+	}
+	switch o {
+	case 0: // end of flex, "pop pop setcurrentpoint" follows
+		c.endFlex()
+		c.ps = append(c.ps[0:0], c.y, c.x)
+	case 1: // start of flex
+		c.flex = true
+		c.flexPts = c.flexPts[0:0]
+		c.fx, c.fy = c.x, c.y
+	}
+}
+
+func (c *charStringT) seacGlyph(name string, depth int) {
+	s, ok := c.g.CharStrings[name]
+	if ok {
+		c.run(s, depth)
+	}
+}
+
+// c.run() executes a charstring.
+func (c *charStringT) run(s []byte, depth int) {
+	if depth > MAX_SUBR_DEPTH {
+		panic("charstring subroutines nested too deep\n")
+	}
+	for p := 0; p < len(s) && !c.done; {
+		v := int(s[p])
+		p++
+		switch {
+		case v >= 32 && v <= 246:
+			c.push(float64(v - 139))
+			continue
+		case v >= 247 && v <= 250 && p < len(s):
+			c.push(float64((v-247)*256 + int(s[p]) + 108))
+			p++
+			continue
+		case v >= 251 && v <= 254 && p < len(s):
+			c.push(float64(-(v-251)*256 - int(s[p]) - 108))
+			p++
+			continue
+		case v == 255 && p+4 <= len(s):
+			c.push(float64(int32(uint32(s[p])<<24 | uint32(s[p+1])<<16 | uint32(s[p+2])<<8 | uint32(s[p+3]))))
+			p += 4
+			continue
+		case v == 12 && p < len(s):
+			v = 1200 + int(s[p])
+			p++
+		}
+		switch v {
+		case 1, 3, 1200, 1201, 1202: // hints, dotsection
+		case 4: // vmoveto
+			c.moveTo(0, c.args(1)[0])
+		case 5: // rlineto
+			a := c.args(2)
+			c.lineTo(a[0], a[1])
+		case 6: // hlineto
+			c.lineTo(c.args(1)[0], 0)
+		case 7: // vlineto
+			c.lineTo(0, c.args(1)[0])
+		case 8: // rrcurveto
+			a := c.args(6)
+			c.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		case 9: // closepath
+			c.closePath()
+		case 10: // callsubr
+			a := c.args(1)
+			n := int(a[0])
+			c.st = c.st[0 : len(c.st)-1]
+			if n >= 0 && n < len(c.g.Subrs) {
+				c.run(c.g.Subrs[n], depth+1)
+			}
+			continue
+		case 11: // return
+			return
+		case 13: // hsbw
+			a := c.args(2)
+			c.hsbw(a[0], 0, a[1], 0)
+		case 14: // endchar
+			c.closePath()
+			c.done = true
+		case 21: // rmoveto
+			a := c.args(2)
+			c.moveTo(a[0], a[1])
+		case 22: // hmoveto
+			c.moveTo(c.args(1)[0], 0)
+		case 30: // vhcurveto
+			a := c.args(4)
+			c.curveTo(0, a[0], a[1], a[2], a[3], 0)
+		case 31: // hvcurveto
+			a := c.args(4)
+			c.curveTo(a[0], 0, a[1], a[2], 0, a[3])
+		case 1206: // seac
+			a := c.args(5)
+			c.doSeac(a[0], a[1], a[2], int(a[3]), int(a[4]), depth)
+		case 1207: // sbw
+			a := c.args(4)
+			c.hsbw(a[0], a[1], a[2], a[3])
+		case 1212: // div
+			a := c.args(2)
+			r := 0.0
+			if a[1] != 0 {
+				r = a[0] / a[1]
+			}
+			c.st = append(c.st[0:len(c.st)-2], r)
+			continue
+		case 1216: // callothersubr
+			c.othersubr()
+			continue
+		case 1217: // pop
+			if n := len(c.ps); n > 0 {
+				c.push(c.ps[n-1])
+				c.ps = c.ps[0 : n-1]
+			} else {
+				c.push(0)
+			}
+			continue
+		case 1233: // setcurrentpoint
+			a := c.args(2)
+			c.x, c.y = a[0], a[1]
+		}
+		c.st = c.st[0:0]
+	}
+}
+
+func (c *charStringT) push(v float64) {
+	if len(c.st) >= MAX_CHARSTRING_STACK {
+		panic("charstring stack overflow\n")
+	}
+	c.st = append(c.st, v)
+}
+
+func (c *charStringT) hsbw(sbx, sby, wx, wy float64) {
+	if c.seac {
+		c.x, c.y = sbx, sby
+		return
+	}
+	c.sbx, c.sby = sbx, sby
+	c.x, c.y = sbx, sby
+	c.r.Wx, c.r.Wy = wx, wy
+}
+
+// c.doSeac() composes an accented glyph of two glyphs of StandardEncoding.
+func (c *charStringT) doSeac(asb, adx, ady float64, bchar, achar, depth int) {
+	if c.seac {
+		return
+	}
+	c.seac = true
+	c.done = false
+	c.seacGlyph(seacName(bchar), depth)
+	c.closePath()
+	c.done = false
+	c.st = c.st[0:0]
+	c.dx, c.dy = c.sbx+adx-asb, ady
+	c.seacGlyph(seacName(achar), depth)
+	c.closePath()
+	c.dx, c.dy = 0, 0
+	c.done = true
+}
+
+// g.Glyph() decodes the outline of a glyph, nil if there is no such glyph
+// or its charstring can not be interpreted.
+func (g *GlyphsT) Glyph(name string) (r *GlyphT) {
+	s, ok := g.CharStrings[name]
+	if !ok {
+		return nil
+	}
+	defer func() {
+		if recover() != nil {
+			r = nil
+		}
+	}()
+	c := &charStringT{g: g, r: new(GlyphT)}
+	c.run(s, 0)
+	return c.r
+}
+
+// g.Width() returns the advance width of a glyph in glyph space, -1 if
+// there is no such glyph or it is broken.
+func (g *GlyphsT) Width(name string) float64 {
+	if r := g.Glyph(name); r != nil {
+		return r.Wx
+	}
+	return -1
+}
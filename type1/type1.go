@@ -326,3 +326,10 @@ func (i *TypeOneI) Dic(id string) map[string][]byte {
 	idn := strm.Int(id[1:], 1)
 	return i.Dicts[idn].Defs
 }
+
+func (i *TypeOneI) Array(id string) [][]byte {
+	if id[0] != 'A' {
+		panic("Wrong array!\n")
+	}
+	return i.Arrays[strm.Int(id[1:], 1)]
+}
@@ -10,6 +10,7 @@ package util
 
 import (
 	"fmt"
+	"unicode/utf16"
 
 	"github.com/grokify/pdfreader/xchar"
 )
@@ -101,20 +102,48 @@ func ToXML(s []byte) []byte {
 	return r
 }
 
+// the characters of PDFDocEncoding differing from Latin-1.
+var pdfDoc = map[byte]rune{
+	0x18: 0x02D8, 0x19: 0x02C7, 0x1A: 0x02C6, 0x1B: 0x02D9, 0x1C: 0x02DD,
+	0x1D: 0x02DB, 0x1E: 0x02DA, 0x1F: 0x02DC, 0x80: 0x2022, 0x81: 0x2020,
+	0x82: 0x2021, 0x83: 0x2026, 0x84: 0x2014, 0x85: 0x2013, 0x86: 0x0192,
+	0x87: 0x2044, 0x88: 0x2039, 0x89: 0x203A, 0x8A: 0x2212, 0x8B: 0x2030,
+	0x8C: 0x201E, 0x8D: 0x201C, 0x8E: 0x201D, 0x8F: 0x2018, 0x90: 0x2019,
+	0x91: 0x201A, 0x92: 0x2122, 0x93: 0xFB01, 0x94: 0xFB02, 0x95: 0x0141,
+	0x96: 0x0152, 0x97: 0x0160, 0x98: 0x0178, 0x99: 0x017D, 0x9A: 0x0131,
+	0x9B: 0x0142, 0x9C: 0x0153, 0x9D: 0x0161, 0x9E: 0x017E, 0xA0: 0x20AC,
+}
+
+// util.TextString() converts the bytes of a PDF text string, UTF-16BE or
+// UTF-8 with byte order mark or PDFDocEncoding, to UTF-8.
+func TextString(s []byte) string {
+	switch {
+	case len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF:
+		u := make([]uint16, (len(s)-2)/2)
+		for k := range u {
+			u[k] = uint16(s[2+2*k])<<8 | uint16(s[3+2*k])
+		}
+		return string(utf16.Decode(u))
+	case len(s) >= 3 && s[0] == 0xEF && s[1] == 0xBB && s[2] == 0xBF:
+		return string(s[3:])
+	}
+	r := make([]rune, len(s))
+	for k, c := range s {
+		if u, ok := pdfDoc[c]; ok {
+			r[k] = u
+		} else {
+			r[k] = rune(c)
+		}
+	}
+	return string(r)
+}
+
 type OutT struct {
 	Content []byte
 }
 
+// t.Out() appends formatted output, the buffer grows by doubling so large
+// drawings take linear time.
 func (t *OutT) Out(f string, args ...interface{}) {
-	p := fmt.Sprintf(f, args...)
-	q := len(t.Content)
-	if cap(t.Content)-q < len(p) {
-		n := make([]byte, cap(t.Content)+(len(p)/512+2)*512)
-		copy(n, t.Content)
-		t.Content = n[0:q]
-	}
-	t.Content = t.Content[0 : q+len(p)]
-	for k := 0; k < len(p); k++ {
-		t.Content[q+k] = p[k]
-	}
+	t.Content = fmt.Appendf(t.Content, f, args...)
 }
@@ -0,0 +1,361 @@
+// Copyright (c) 2009 Helmar Wodtke. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+// The MIT License is an OSI approved license and can
+// be found at
+//   http://www.opensource.org/licenses/mit-license.php
+
+package pdfreader
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/grokify/pdfreader/fancy"
+	"github.com/grokify/pdfreader/hex"
+	"github.com/grokify/pdfreader/limits"
+	"github.com/grokify/pdfreader/ps"
+)
+
+// Structural validation of PDF files.
+
+type Severity int
+
+const (
+	SEV_INFO Severity = iota
+	SEV_WARNING
+	SEV_ERROR
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SEV_INFO:
+		return "info"
+	case SEV_WARNING:
+		return "warning"
+	}
+	return "error"
+}
+
+// Problem is a finding of pd.Validate(). Object is -1 for problems which
+// are not bound to a single object.
+type Problem struct {
+	Severity Severity
+	Object   int
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Object < 0 {
+		return fmt.Sprintf("%s: %s", p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s: object %d: %s", p.Severity, p.Object, p.Message)
+}
+
+// filters known to the PDF specification; false if not supported here.
+var knownFilters = map[string]bool{
+	"/FlateDecode":     true,
+	"/LZWDecode":       true,
+	"/ASCII85Decode":   true,
+	"/ASCIIHexDecode":  true,
+	"/RunLengthDecode": false,
+	"/CCITTFaxDecode":  false,
+	"/JBIG2Decode":     false,
+	"/DCTDecode":       true,
+	"/JPXDecode":       false,
+	"/Crypt":           false,
+}
+
+// validator reads the objects by the xref table and trailer of the reader
+// when the validation starts, it never repairs them.
+type validator struct {
+	pd       *PDFReader
+	xref     map[int]int
+	trailer  Dictionary
+	problems []Problem
+	seen     map[int]bool
+	todo     []int
+}
+
+func (v *validator) report(sev Severity, o int, f string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{sev, o, fmt.Sprintf(f, args...)})
+}
+
+func isRef(s []byte) bool {
+	return len(s) >= 5 && isDigit(s[0]) && s[len(s)-1] == 'R'
+}
+
+// v.at() reads object o like pd.object(), -1 if it can not be read.
+func (v *validator) at(o int) (int, []byte) {
+	p, ok := v.xref[o]
+	if !ok {
+		return -1, _Bytes
+	}
+	n, r, ok := objectAt(v.pd.cursor(), p, o, v.pd.opts.Limits.MaxDepth)
+	if !ok {
+		return -1, _Bytes
+	}
+	return n, r
+}
+
+// v.obj() resolves a reference like pd.Obj().
+func (v *validator) obj(s []byte) []byte {
+	done := make(map[int]bool)
+	for isRef(s) && !done[num(s)] {
+		done[num(s)] = true
+		_, s = v.at(num(s))
+	}
+	if isRef(s) {
+		return _Bytes
+	}
+	return s
+}
+
+func (v *validator) dic(s []byte) Dictionary { return dictionary(v.obj(s)) }
+
+func (v *validator) arr(s []byte) [][]byte { return array(v.obj(s)) }
+
+// v.reference() queues the object of a reference for checking.
+func (v *validator) reference(o int, s []byte) {
+	r := num(s)
+	if _, ok := v.xref[r]; !ok {
+		v.report(SEV_ERROR, o, "dangling reference %s", s)
+		return
+	}
+	if !v.seen[r] {
+		v.seen[r] = true
+		v.todo = append(v.todo, r)
+	}
+}
+
+func validName(s []byte) bool {
+	for k := 1; k < len(s); k++ {
+		if s[k] < 33 || s[k] > 126 {
+			return false
+		}
+		if s[k] == '#' {
+			if k+2 >= len(s) || !hex.IsHex(s[k+1]) || !hex.IsHex(s[k+2]) {
+				return false
+			}
+			k += 2
+		}
+	}
+	return true
+}
+
+func validHexString(s []byte) bool {
+	if s[len(s)-1] != '>' {
+		return false
+	}
+	for k := 1; k < len(s)-1; k++ {
+		if !hex.IsHex(s[k]) && s[k] > 32 {
+			return false
+		}
+	}
+	return true
+}
+
+// v.value() checks a (direct) value of object o recursively.
+func (v *validator) value(o int, s []byte) {
+	switch {
+	case len(s) == 0:
+	case isRef(s):
+		v.reference(o, s)
+	case s[0] == '/':
+		if !validName(s) {
+			v.report(SEV_ERROR, o, "invalid name %q", s)
+		}
+	case s[0] == '(':
+		if len(s) < 2 || s[len(s)-1] != ')' {
+			v.report(SEV_ERROR, o, "unterminated string")
+		}
+	case len(s) > 1 && s[0] == '<' && s[1] == '<':
+		if dictionary(s) == nil {
+			v.report(SEV_ERROR, o, "malformed dictionary")
+			return
+		}
+		v.composite(o, s[2:len(s)-2])
+	case s[0] == '<':
+		if !validHexString(s) {
+			v.report(SEV_ERROR, o, "invalid hex string")
+		}
+	case s[0] == '[':
+		if s[len(s)-1] != ']' {
+			v.report(SEV_ERROR, o, "unterminated array")
+			return
+		}
+		v.composite(o, s[1:len(s)-1])
+	}
+}
+
+func (v *validator) composite(o int, s []byte) {
+	rdr := fancy.SliceReader(s)
+	for {
+		t, _ := refToken(rdr)
+		if len(t) == 0 {
+			break
+		}
+		v.value(o, t)
+	}
+}
+
+// v.stream() checks /Length and /Filter of a stream object.
+func (v *validator) stream(o, p int, d Dictionary) {
+	pd := v.pd
+	f := pd.cursor()
+	f.Seek(int64(p), 0)
+	ps.Token(f)
+	ps.SkipLE(f)
+	q, _ := f.Seek(0, 1)
+	l, ok := d["/Length"]
+	if !ok {
+		v.report(SEV_ERROR, o, "stream without /Length")
+	} else if ln := num(v.obj(l)); !pd.endstreamAt(q + int64(ln)) {
+		v.report(SEV_WARNING, o, "/Length %d mismatch, endstream found after %d bytes",
+			ln, pd.streamLength(q))
+	}
+	if f, ok := d["/Filter"]; ok {
+		filters := v.arr(f)
+		if filters == nil {
+			filters = [][]byte{v.obj(f)}
+		}
+		for _, n := range filters {
+			supported, known := knownFilters[string(n)]
+			if !known {
+				v.report(SEV_ERROR, o, "unknown filter %s", n)
+			} else if !supported {
+				v.report(SEV_INFO, o, "filter %s is not supported", n)
+			}
+		}
+	}
+}
+
+// v.object() checks a single object.
+func (v *validator) object(o int) {
+	p, s := v.at(o)
+	if p < 0 {
+		v.report(SEV_ERROR, o, "object can not be read")
+		return
+	}
+	if isRef(s) {
+		done := map[int]bool{o: true}
+		for r := s; isRef(r); {
+			if done[num(r)] {
+				v.report(SEV_ERROR, o, "reference cycle via %s", r)
+				return
+			}
+			done[num(r)] = true
+			_, r = v.at(num(r))
+		}
+	}
+	v.value(o, s)
+	f := v.pd.cursor()
+	f.Seek(int64(p), 0)
+	if t, _ := ps.Token(f); string(t) == "stream" {
+		if d := dictionary(s); d != nil {
+			v.stream(o, p, d)
+		} else {
+			v.report(SEV_ERROR, o, "stream without dictionary")
+		}
+	}
+}
+
+// v.xrefTable() checks that the xref table points at the declared objects.
+func (v *validator) xrefTable() {
+	pd := v.pd
+	f := pd.cursor()
+	for o, p := range v.xref {
+		if int64(p) >= f.Size() {
+			v.report(SEV_ERROR, o, "xref offset %d beyond end of file", p)
+			continue
+		}
+		if _, _, ok := objectAt(f, p, o, pd.opts.Limits.MaxDepth); !ok {
+			v.report(SEV_ERROR, o, "xref offset %d does not point at the object", p)
+		}
+	}
+}
+
+// v.pageTree() compares /Count of page tree nodes with the leaves found.
+func (v *validator) pageTree() {
+	root, ok := v.dic(v.trailer["/Root"])["/Pages"]
+	if !ok {
+		v.report(SEV_ERROR, num(v.trailer["/Root"]), "catalog without /Pages")
+		return
+	}
+	done := make(map[string]bool)
+	var count func(node []byte) int
+	count = func(node []byte) int {
+		if done[string(node)] {
+			v.report(SEV_ERROR, num(node), "page tree node used twice (cycle)")
+			return 0
+		}
+		done[string(node)] = true
+		d := v.dic(node)
+		kids, ok := d["/Kids"]
+		if !ok {
+			return 1
+		}
+		n := 0
+		for _, k := range v.arr(kids) {
+			n += count(k)
+		}
+		if c := num(v.obj(d["/Count"])); c != n {
+			v.report(SEV_ERROR, num(node), "page tree /Count %d, but %d pages found", c, n)
+		}
+		return n
+	}
+	count(root)
+}
+
+// pd.Validate() walks all objects reachable from the trailer and reports
+// structural problems, sorted by object. The xref table is not repaired
+// while walking. Exceeded limits of pd end the walk with an error.
+func (pd *PDFReader) Validate() (r []Problem) {
+	pd.mu.Lock()
+	v := &validator{pd: pd, xref: pd.Xref, trailer: pd.Trailer, seen: make(map[int]bool)}
+	pd.mu.Unlock()
+	var err error
+	defer func() {
+		if err != nil {
+			v.report(SEV_ERROR, -1, "%s", err)
+		}
+		sort.Slice(v.problems, func(i, j int) bool {
+			a, b := v.problems[i], v.problems[j]
+			if a.Object != b.Object {
+				return a.Object < b.Object
+			}
+			if a.Severity != b.Severity {
+				return a.Severity > b.Severity
+			}
+			return a.Message < b.Message
+		})
+		r = v.problems
+	}()
+	defer limits.Catch(&err)
+	v.xrefTable()
+	if v.trailer["/Root"] == nil {
+		v.report(SEV_ERROR, -1, "trailer without /Root")
+	}
+	keys := make([]string, 0, len(v.trailer))
+	for k := range v.trailer {
+		if k != "/Prev" && k != "/XRefStm" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v.value(-1, v.trailer[k])
+	}
+	for len(v.todo) > 0 {
+		o := v.todo[0]
+		v.todo = v.todo[1:]
+		v.object(o)
+	}
+	if v.trailer["/Root"] != nil {
+		v.pageTree()
+	}
+	if pd.repaired() {
+		v.report(SEV_WARNING, -1, "xref table was rebuilt by scanning the file")
+	}
+	return
+}